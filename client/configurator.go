@@ -3,7 +3,10 @@ package client
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gdamore/tcell/v2"
@@ -21,6 +24,8 @@ type Configurator struct {
 	gBattery     protocol.BatteryChargeLimitClient
 	gKeyboard    protocol.KeyboardBrightnessClient
 	gManager     protocol.ManagerControlClient
+	gFan         protocol.FanSpeedClient
+	gCaps        protocol.CapabilityClient
 
 	ctx      context.Context
 	cancelFn context.CancelFunc
@@ -45,7 +50,8 @@ type Configurator struct {
 	configView       *tview.TextView
 	infoView         *tview.TextView
 
-	batteryEdit *tview.Form
+	batteryEdit  *tview.Form
+	profilesEdit *tview.Form
 
 	fnLists     *tview.List
 	fnListItems []listItem
@@ -81,6 +87,7 @@ func NewInterface() *Configurator {
 		configView:           tview.NewTextView(),
 		infoView:             tview.NewTextView(),
 		batteryEdit:          tview.NewForm(),
+		profilesEdit:         tview.NewForm(),
 		fnLists:              tview.NewList(),
 		dataBinding:          data{},
 	}
@@ -99,6 +106,8 @@ func (i *Configurator) connect(haltCtx context.Context) error {
 	i.gBattery = protocol.NewBatteryChargeLimitClient(c)
 	i.gKeyboard = protocol.NewKeyboardBrightnessClient(c)
 	i.gManager = protocol.NewManagerControlClient(c)
+	i.gFan = protocol.NewFanSpeedClient(c)
+	i.gCaps = protocol.NewCapabilityClient(c)
 
 	i.updateInfoView()
 	return nil
@@ -194,6 +203,13 @@ func (i *Configurator) setupFnList() {
 			Shortcut:  't',
 			Callback:  i.selectThermal,
 		},
+		{
+			Main:          "Share Profiles",
+			Secondary:     "Import/Export profiles",
+			Shortcut:      's',
+			Callback:      i.selectProfiles,
+			EditPrimitive: i.profilesEdit,
+		},
 		{
 			Main:      "Keyboard Backlight",
 			Secondary: "Get/Set backlight level",
@@ -207,11 +223,24 @@ func (i *Configurator) setupFnList() {
 			Callback:      i.selectBattery,
 			EditPrimitive: i.batteryEdit,
 		},
+		{
+			Main:      "Fan Speed",
+			Secondary: "Get current fan speed",
+			Shortcut:  'f',
+			Callback:  i.selectFan,
+		},
+		{
+			Main:      "Capabilities",
+			Secondary: "Features supported by the firmware",
+			Shortcut:  'p',
+			Callback:  i.selectCapabilities,
+		},
 		{
 			Main:      "Exit",
 			Secondary: "Exit the Configurator",
 			Shortcut:  'q',
 			Callback: func() {
+				i.confirmationModal.SetText("Are you sure?")
 				i.confirmNo = "container"
 				i.confirmYes = i.cancelFn
 				i.layers.SwitchToPage("confirmation")
@@ -265,6 +294,132 @@ func (i *Configurator) setupForms() {
 		}).
 		SetButtonBackgroundColor(tcell.Color104).
 		SetFieldBackgroundColor(tcell.Color104)
+
+	i.profilesEdit.
+		AddInputField("File ", "", 50, nil, nil).
+		AddDropDown("Format ", profilesFormats, 0, nil).
+		AddCheckbox("Merge with current profiles ", false, nil).
+		AddCheckbox("Allow command hooks ", false, nil).
+		AddButton("Cancel", func() {
+			i.clearConfigEdit()
+			i.showEditTooltip()
+		}).
+		AddButton("Export", func() {
+			path, format := i.profilesFile()
+			if format == protocol.ProfilesFormat_AUTO {
+				format = protocol.ProfilesFormat_YAML
+				if strings.EqualFold(filepath.Ext(path), ".json") {
+					format = protocol.ProfilesFormat_JSON
+				}
+			}
+			e, err := i.gConfigsList.ExportProfiles(context.Background(), &protocol.ExportProfilesRequest{
+				Format: format,
+			})
+			if err != nil {
+				i.showMessage(err.Error(), tcell.ColorRed)
+				return
+			}
+			if e.GetSuccess() == false {
+				i.showMessage(e.GetMessage(), tcell.ColorRed)
+				return
+			}
+			if err := ioutil.WriteFile(path, e.GetData(), 0644); err != nil {
+				i.showMessage(err.Error(), tcell.ColorRed)
+				return
+			}
+
+			i.showMessage(fmt.Sprintf("Profiles exported to %s", path), tcell.ColorGreen)
+			i.clearConfigEdit()
+		}).
+		AddButton("Import", func() {
+			path, format := i.profilesFile()
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				i.showMessage(err.Error(), tcell.ColorRed)
+				return
+			}
+			req := &protocol.ImportProfilesRequest{
+				Format:        format,
+				Data:          b,
+				Merge:         i.profilesEdit.GetFormItem(2).(*tview.Checkbox).IsChecked(),
+				AllowCommands: i.profilesEdit.GetFormItem(3).(*tview.Checkbox).IsChecked(),
+				DryRun:        true,
+			}
+			r, err := i.gConfigsList.ImportProfiles(context.Background(), req)
+			if err != nil {
+				i.showMessage(err.Error(), tcell.ColorRed)
+				return
+			}
+			if r.GetSuccess() == false {
+				i.showMessage(r.GetMessage(), tcell.ColorRed)
+				return
+			}
+
+			// hooks run on profile switches, so they are shown before saving
+			hooks := profileHooks(r.GetProfiles())
+			if len(hooks) == 0 {
+				i.importProfiles(req, path)
+				return
+			}
+			i.confirmationModal.SetText(fmt.Sprintf("Import profiles with these hooks?\n\n%s", strings.Join(hooks, "\n")))
+			i.confirmNo = "container"
+			i.confirmYes = func() {
+				i.layers.SwitchToPage("container")
+				i.importProfiles(req, path)
+			}
+			i.layers.SwitchToPage("confirmation")
+		}).
+		SetButtonBackgroundColor(tcell.Color104).
+		SetFieldBackgroundColor(tcell.Color104)
+}
+
+var profilesFormats = []string{"Auto", "JSON", "YAML", "atrofac"}
+
+// importProfiles saves the profiles previewed with a dry run
+func (i *Configurator) importProfiles(req *protocol.ImportProfilesRequest, path string) {
+	req.DryRun = false
+	r, err := i.gConfigsList.ImportProfiles(context.Background(), req)
+	if err != nil {
+		i.showMessage(err.Error(), tcell.ColorRed)
+		return
+	}
+	if r.GetSuccess() == false {
+		i.showMessage(r.GetMessage(), tcell.ColorRed)
+		return
+	}
+
+	msg := fmt.Sprintf("%d profile(s) imported from %s", len(r.GetProfiles()), path)
+	if r.GetMessage() != "" {
+		// removed command hooks and resampled fan curves
+		msg = fmt.Sprintf("%s\n%s", msg, r.GetMessage())
+	}
+	i.showMessage(msg, tcell.ColorGreen)
+	i.clearConfigEdit()
+	i.selectProfiles()
+}
+
+// profileHooks describes the hooks of the profiles, one per line
+func profileHooks(profiles []*protocol.Profile) []string {
+	hooks := make([]string, 0)
+	for _, p := range profiles {
+		for _, h := range p.GetOnEnter() {
+			hooks = append(hooks, fmt.Sprintf("%s on enter: %s=%s", p.GetName(), h.GetAction(), h.GetValue()))
+		}
+		for _, h := range p.GetOnExit() {
+			hooks = append(hooks, fmt.Sprintf("%s on exit: %s=%s", p.GetName(), h.GetAction(), h.GetValue()))
+		}
+	}
+	return hooks
+}
+
+// profilesFile returns the file path and format in the profiles form
+func (i *Configurator) profilesFile() (string, protocol.ProfilesFormat) {
+	path := i.profilesEdit.GetFormItem(0).(*tview.InputField).GetText()
+	index, _ := i.profilesEdit.GetFormItem(1).(*tview.DropDown).GetCurrentOption()
+	if index < 0 {
+		index = 0
+	}
+	return path, protocol.ProfilesFormat(index)
 }
 
 func (i *Configurator) keyBindings() {
@@ -375,7 +530,48 @@ func (i *Configurator) selectThermal() {
 		i.configView.SetText(err.Error())
 		return
 	}
-	i.configView.SetText(fmt.Sprintf("%+v", t))
+	txt := fmt.Sprintf("%+v\n\n", t)
+	if a := t.GetApplied(); a != nil {
+		txt = fmt.Sprintf("%sApplied (as read back):\n  Throttle plan: %s (%s)\n  CPU: %s (%s)\n  GPU: %s (%s)\n\n", txt,
+			a.GetThrottlePlan(), a.GetThrottlePlanReadBack(),
+			a.GetCPUFanCurve(), a.GetCPUFanCurveReadBack(),
+			a.GetGPUFanCurve(), a.GetGPUFanCurveReadBack())
+		if e := a.GetReadBackError(); e != "" {
+			txt = fmt.Sprintf("%sRead back: %s\n\n", txt, e)
+		}
+	}
+
+	f, err := i.gThermal.GetFactoryCurves(context.Background(), &empty.Empty{})
+	if err != nil {
+		i.configView.SetText(err.Error())
+		return
+	}
+	if f.GetSuccess() == false {
+		txt = fmt.Sprintf("%sCannot read factory fan curves: %s\n", txt, f.GetMessage())
+	} else {
+		for _, c := range f.GetCurves() {
+			txt = fmt.Sprintf("%sFactory fan curves of %s:\n  CPU: %s\n  GPU: %s\n", txt, c.GetThrottlePlan(), c.GetCPUFanCurve(), c.GetGPUFanCurve())
+		}
+	}
+	i.configView.SetText(txt)
+	i.app.SetFocus(i.configView)
+}
+
+func (i *Configurator) selectProfiles() {
+	e, err := i.gConfigsList.ExportProfiles(context.Background(), &protocol.ExportProfilesRequest{
+		Format: protocol.ProfilesFormat_YAML,
+	})
+	if err != nil {
+		i.showMessage(err.Error(), tcell.ColorRed)
+		return
+	}
+
+	if e.GetSuccess() == false {
+		i.showMessage(e.GetMessage(), tcell.ColorRed)
+		return
+	}
+
+	i.configView.SetText(string(e.GetData()))
 	i.app.SetFocus(i.configView)
 }
 
@@ -412,6 +608,65 @@ func (i *Configurator) selectBattery() {
 	i.app.SetFocus(i.configView)
 }
 
+func (i *Configurator) selectFan() {
+	f, err := i.gFan.GetHistory(context.Background(), &empty.Empty{})
+	if err != nil {
+		i.showMessage(err.Error(), tcell.ColorRed)
+		return
+	}
+
+	if f.GetSuccess() == false {
+		i.showMessage(f.GetMessage(), tcell.ColorRed)
+		return
+	}
+
+	samples := f.GetSamples()
+	if len(samples) == 0 {
+		i.configView.SetText("Fan speed is not available yet")
+		i.app.SetFocus(i.configView)
+		return
+	}
+
+	var txt string
+	current := samples[len(samples)-1]
+	txt = fmt.Sprintf("%sCurrent CPU fan speed: %d RPM\n", txt, current.GetCPU())
+	txt = fmt.Sprintf("%sCurrent GPU fan speed: %d RPM\n\n", txt, current.GetGPU())
+
+	var cpuMax, gpuMax uint32
+	for _, s := range samples {
+		if s.GetCPU() > cpuMax {
+			cpuMax = s.GetCPU()
+		}
+		if s.GetGPU() > gpuMax {
+			gpuMax = s.GetGPU()
+		}
+	}
+	window := time.Duration(f.GetInterval()) * time.Millisecond * time.Duration(len(samples))
+	txt = fmt.Sprintf("%sPeak in the last %s: CPU %d RPM, GPU %d RPM\n", txt, window, cpuMax, gpuMax)
+	i.configView.SetText(txt)
+	i.app.SetFocus(i.configView)
+}
+
+func (i *Configurator) selectCapabilities() {
+	c, err := i.gCaps.GetCapabilities(context.Background(), &empty.Empty{})
+	if err != nil {
+		i.showMessage(err.Error(), tcell.ColorRed)
+		return
+	}
+
+	if c.GetSuccess() == false {
+		i.showMessage(c.GetMessage(), tcell.ColorRed)
+		return
+	}
+
+	var txt string
+	for _, cap := range c.GetCapabilities() {
+		txt = fmt.Sprintf("%s%s (0x%08x): supported %t\n", txt, cap.GetName(), cap.GetDevice(), cap.GetSupported())
+	}
+	i.configView.SetText(txt)
+	i.app.SetFocus(i.configView)
+}
+
 func (i *Configurator) Serve(haltCtx context.Context) error {
 
 	i.setup()
@@ -9,6 +9,7 @@ import (
 	_ "net/http/pprof"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
@@ -17,6 +18,7 @@ import (
 	"github.com/zllovesuki/G14Manager/supervisor"
 	"github.com/zllovesuki/G14Manager/supervisor/background"
 	"github.com/zllovesuki/G14Manager/system/shared"
+	"github.com/zllovesuki/G14Manager/system/thermal"
 	"github.com/zllovesuki/G14Manager/util"
 
 	suture "github.com/thejerf/suture/v4"
@@ -51,9 +53,15 @@ func main() {
 		log.Fatalf("[supervisor] cannot get version checker")
 	}
 
+	floor := fanSafetyFloor()
+
 	controllerConfig := controller.RunConfig{
-		DryRun:     os.Getenv("DRY_RUN") != "",
-		NotifierCh: notifier.C,
+		DryRun:         os.Getenv("DRY_RUN") != "",
+		Simulate:       os.Getenv("SIMULATE_EC") != "",
+		TracePath:      os.Getenv("WMI_TRACE"),
+		ModelsPath:     modelsPath(),
+		NotifierCh:     notifier.C,
+		FanSafetyFloor: floor,
 	}
 
 	dep, err := controller.GetDependencies(controllerConfig)
@@ -64,8 +72,9 @@ func main() {
 	managerCtrl := make(chan server.ManagerSupervisorRequest, 1)
 
 	grpcServer, err := supervisor.NewGRPCServer(supervisor.GRPCRunConfig{
-		ManagerReqCh: managerCtrl,
-		Dependencies: dep,
+		ManagerReqCh:   managerCtrl,
+		Dependencies:   dep,
+		FanSafetyFloor: floor,
 	})
 	if err != nil {
 		log.Fatalf("[supervisor] cannot create gRPCServer: %+v\n", err)
@@ -90,36 +99,56 @@ func main() {
 			ManagerResponder:	supervisor/responder.go
 			versionChecker:		supervisor/background/version.go
 			osdNotifier:		supervisor/background/notifier.go
+			fanSampler:			system/fan/sampler.go
+			batteryMonitor:		system/battery/monitor.go
 			controller:			controller
+			driftWatchdog:		system/drift/watchdog.go
+			softwareFan:		system/thermal/software.go
 
 								rootSupervisor  +----+  pprof
 									+    +
 									|    |
 									|    |
 				gRPCSupervisor  +---+    +---+   backgroundSupervisor
-				+ + +                            + +
-				| | |                            | |
-				| | +-> gRPCServer               | +-> versionChecker
-				| |                              |
-				| |                              |
-				| +---> ManagerResponder         +---> osdNotifier
-				|
+				+ + +                            + + +
+				| | |                            | | |
+				| | +-> gRPCServer               | | +-> versionChecker
+				| |                              | |
+				| |                              | |
+				| +---> ManagerResponder         | +---> osdNotifier
+				|                                |
+				|                                +-----> fanSampler
+				|                                |
+				|                                +-----> batteryMonitor
 				|
 				+-----> controllerSupervisor
-							+
+							+ + +
+							| | |
+							| | +-> Controller
+							| |
+							| +---> driftWatchdog
 							|
-							+-> Controller
+							+-----> softwareFan
 
 		Since the gRPCServer can control the lifecycle of the Controller,
 		we need a two-way communication between the gRPCSupervisor and
 		the gRPC ManagerServer via ManagerReqCh. The coordination is handled
 		by ManagerResponder
 
+		The driftWatchdog and softwareFan run alongside the Controller, so that hardware state
+		is not reapplied (or rewritten) while the Controller is stopped
+
 	*/
 
 	backgroundSupervisor := suture.New("backgroundSupervisor", suture.Spec{})
 	backgroundSupervisor.Add(versionChecker)
 	backgroundSupervisor.Add(notifier)
+	if dep.FanSampler != nil {
+		backgroundSupervisor.Add(dep.FanSampler)
+	}
+	if dep.BatteryMonitor != nil {
+		backgroundSupervisor.Add(dep.BatteryMonitor)
+	}
 
 	grpcSupervisor := suture.New("gRPCSupervisor", suture.Spec{})
 	managerResponder.SetSupervisor(grpcSupervisor)
@@ -166,6 +195,33 @@ func main() {
 	time.Sleep(time.Second) // 1 second for grace period
 }
 
+// modelsPath returns the path to the user overrides of model descriptors: MODELS_PATH if set,
+// otherwise models.json next to the executable
+func modelsPath() string {
+	if p := os.Getenv("MODELS_PATH"); p != "" {
+		return p
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(exe), "models.json")
+}
+
+// fanSafetyFloor returns the safety floor of fan curves: FAN_SAFETY_FLOOR (e.g. 85c:30%) if set,
+// otherwise thermal.DefaultSafetyFloor
+func fanSafetyFloor() thermal.SafetyFloor {
+	f := os.Getenv("FAN_SAFETY_FLOOR")
+	if f == "" {
+		return thermal.DefaultSafetyFloor
+	}
+	floor, err := thermal.ParseSafetyFloor(f)
+	if err != nil {
+		log.Fatalf("[supervisor] invalid FAN_SAFETY_FLOOR %s: %+v\n", f, err)
+	}
+	return floor
+}
+
 type webDebugger struct {
 	Srv *http.Server
 }
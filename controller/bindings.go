@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"log"
+	"sync"
+
+	"github.com/zllovesuki/G14Manager/rpc/announcement"
+	"github.com/zllovesuki/G14Manager/system/keyboard"
+	"github.com/zllovesuki/G14Manager/system/shared"
+)
+
+const (
+	keyBindingsName = "KeyBindings"
+)
+
+// KeyBindings are the configurable hotkeys of the Controller, which are updated with the features
+type KeyBindings struct {
+	mu           sync.RWMutex
+	reverseCycle uint32
+}
+
+// NewKeyBindings returns KeyBindings with no configurable hotkeys bound
+func NewKeyBindings() *KeyBindings {
+	return &KeyBindings{}
+}
+
+// ReverseCycle returns the key code (on GA401) that cycles thermal profiles backward. ok is false if it is not bound
+func (k *KeyBindings) ReverseCycle() (code uint32, ok bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return k.reverseCycle, k.reverseCycle != 0
+}
+
+var _ announcement.Updatable = &KeyBindings{}
+
+// Name satisfies announcement.Updatable
+func (k *KeyBindings) Name() string {
+	return keyBindingsName
+}
+
+// ConfigUpdate satisfies announcement.Updatable
+func (k *KeyBindings) ConfigUpdate(u announcement.Update) {
+	if u.Type != announcement.FeaturesUpdate {
+		return
+	}
+
+	feats, ok := u.Config.(shared.Features)
+	if !ok {
+		return
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.reverseCycle = 0
+	if feats.ReverseCycleKey == "" {
+		return
+	}
+	code, ok := keyboard.KeyNames[feats.ReverseCycleKey]
+	if !ok || code == keyboard.KeyFnF5 {
+		log.Printf("[controller] cannot bind reverse cycle to key %s\n", feats.ReverseCycleKey)
+		return
+	}
+	k.reverseCycle = code
+}
@@ -2,6 +2,7 @@ package controller
 
 import (
 	"fmt"
+	"log"
 
 	"github.com/zllovesuki/G14Manager/cxx/plugin/gpu"
 	"github.com/zllovesuki/G14Manager/cxx/plugin/keyboard"
@@ -10,9 +11,14 @@ import (
 	"github.com/zllovesuki/G14Manager/rpc/announcement"
 	"github.com/zllovesuki/G14Manager/system/atkacpi"
 	"github.com/zllovesuki/G14Manager/system/battery"
+	"github.com/zllovesuki/G14Manager/system/drift"
+	"github.com/zllovesuki/G14Manager/system/fan"
+	"github.com/zllovesuki/G14Manager/system/model"
 	"github.com/zllovesuki/G14Manager/system/persist"
 	"github.com/zllovesuki/G14Manager/system/plugin"
 	"github.com/zllovesuki/G14Manager/system/power"
+	"github.com/zllovesuki/G14Manager/system/process"
+	"github.com/zllovesuki/G14Manager/system/setup"
 	"github.com/zllovesuki/G14Manager/system/thermal"
 	"github.com/zllovesuki/G14Manager/util"
 
@@ -22,28 +28,91 @@ import (
 // RunConfig contains the start up configuration for the controller
 type RunConfig struct {
 	DryRun     bool
+	Simulate   bool   // use the simulated embedded controller instead of ATKACPI
+	TracePath  string // if not empty, record all WMI calls to this file
+	ModelsPath string // if not empty, model descriptors in this file override the embedded ones
 	NotifierCh chan util.Notification
+	// FanSafetyFloor is kept by the fan curves the software fan control writes
+	FanSafetyFloor thermal.SafetyFloor
 }
 
 type Dependencies struct {
 	WMI            atkacpi.WMI
+	Capabilities   atkacpi.Capabilities
+	Model          model.Descriptor
 	Keyboard       *keyboard.Control
 	Battery        *battery.ChargeLimit
+	BatteryMonitor *battery.Monitor
 	Volume         *volume.Control
 	Thermal        *thermal.Control
 	GPU            *gpu.Control
 	RR             *rr.Control
+	FanSampler     *fan.Sampler
+	SoftwareFan    *thermal.SoftwareControl
+	DriftWatchdog  *drift.Watchdog
+	KeyBindings    *KeyBindings
+	Setups         *setup.Manager
 	ConfigRegistry persist.ConfigRegistry
 	Updatable      []announcement.Updatable
 }
 
 func GetDependencies(conf RunConfig) (*Dependencies, error) {
 
-	wmi, err := atkacpi.NewWMI(conf.DryRun)
+	var wmi atkacpi.WMI
+	var err error
+
+	if conf.Simulate {
+		wmi = atkacpi.NewSimulator()
+	} else {
+		wmi, err = atkacpi.NewWMI(conf.DryRun)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if conf.TracePath != "" {
+		wmi, err = atkacpi.NewRecorder(wmi, conf.TracePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	models, err := model.Load(conf.ModelsPath)
+	if err != nil {
+		return nil, err
+	}
+	descriptor := models.Default()
+	if !conf.Simulate {
+		board, err := model.BoardName()
+		if err != nil {
+			log.Printf("[controller] cannot read board name, assuming %s: %+v\n", descriptor.Name, err)
+		} else if m, ok := models.Lookup(board); ok {
+			descriptor = m
+		} else {
+			log.Printf("[controller] unknown board %s, assuming %s\n", board, descriptor.Name)
+		}
+	}
+	log.Printf("[controller] using model descriptor: %s\n", descriptor.Name)
+
+	profiles, err := modelProfiles(descriptor)
 	if err != nil {
 		return nil, err
 	}
 
+	// turn off what the firmware doesn't support instead of writing blindly
+	var caps atkacpi.Capabilities
+	if conf.DryRun && !conf.Simulate {
+		// the device returns zeros on a dry run, which would mark everything as unsupported
+		caps = atkacpi.AssumeCapabilities()
+	} else {
+		// the embedded controller may not report the devices before it is initialized
+		if _, err := atkacpi.Init().Execute(wmi); err != nil {
+			log.Printf("[controller] cannot initialize ATKACPI before probing: %+v\n", err)
+		}
+		caps = atkacpi.ProbeCapabilities(wmi)
+	}
+	caps = descriptor.Restrict(caps)
+
 	var config persist.ConfigRegistry
 
 	if conf.DryRun {
@@ -58,10 +127,24 @@ func GetDependencies(conf RunConfig) (*Dependencies, error) {
 		return nil, err
 	}
 
+	// disabled until enabled in the features
+	softwareFan, err := thermal.NewSoftwareControl(thermal.SoftwareConfig{
+		WMI:          wmi,
+		Capabilities: caps,
+		Source:       thermal.NewTemperatureSource(),
+		Floor:        conf.FanSafetyFloor,
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	thermalCfg := thermal.Config{
-		WMI:      wmi,
-		PowerCfg: powercfg,
-		Profiles: thermal.GetDefaultThermalProfiles(),
+		WMI:          wmi,
+		Capabilities: caps,
+		PowerCfg:     powercfg,
+		Profiles:     profiles,
+		Processes:    process.NewWatcher(),
+		Software:     softwareFan,
 	}
 
 	thermal, err := thermal.NewControl(thermalCfg)
@@ -69,15 +152,23 @@ func GetDependencies(conf RunConfig) (*Dependencies, error) {
 		return nil, err
 	}
 
-	battery, err := battery.NewChargeLimit(wmi)
-	if err != nil {
-		return nil, err
+	var batteryCtrl *battery.ChargeLimit
+	if caps.Supports(atkacpi.DevsBatteryChargeLimit) {
+		batteryCtrl, err = battery.NewChargeLimit(wmi)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	kbCtrl, err := keyboard.NewControl(keyboard.Config{
+	kbConfig := keyboard.Config{
 		DryRun: conf.DryRun,
+		Device: descriptor.Keyboard(),
 		RogKey: []string{"Taskmgr.exe"},
-	})
+	}
+	if caps.Supports(atkacpi.DstsKeyboardBacklight) {
+		kbConfig.WMI = wmi
+	}
+	kbCtrl, err := keyboard.NewControl(kbConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -97,23 +188,78 @@ func GetDependencies(conf RunConfig) (*Dependencies, error) {
 		return nil, err
 	}
 
-	config.Register(battery)
 	config.Register(thermal)
 	config.Register(kbCtrl)
 
+	keyBindings := NewKeyBindings()
+
 	updatable := []announcement.Updatable{
 		thermal,
 		kbCtrl,
+		keyBindings,
+	}
+
+	// setups are applied to the devices in this order, and the thermal profile goes first
+	devices := []setup.Device{thermal}
+	if batteryCtrl != nil {
+		config.Register(batteryCtrl)
+		devices = append(devices, batteryCtrl)
+	}
+	devices = append(devices, kbCtrl, rrCtrl, gpuCtrl, volCtrl)
+
+	setups, err := setup.NewManager(devices...)
+	if err != nil {
+		return nil, err
+	}
+	config.Register(setups)
+
+	batteryMonitor, err := battery.NewMonitor(battery.MonitorConfig{
+		Source: battery.NewStatusSource(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var fanSampler *fan.Sampler
+	if caps.Supports(atkacpi.DstsCurrentCPUFanSpeed) && caps.Supports(atkacpi.DstsCurrentGPUFanSpeed) {
+		fanSampler, err = fan.NewSampler(fan.Config{
+			WMI: wmi,
+		})
+		if err != nil {
+			return nil, err
+		}
+		updatable = append(updatable, fanSampler)
+	}
+
+	checkers := []drift.Checker{thermal, kbCtrl}
+	if batteryCtrl != nil {
+		checkers = append(checkers, batteryCtrl)
+	}
+	driftWatchdog, err := drift.NewWatchdog(drift.Config{
+		Checkers: checkers,
+		Notifier: conf.NotifierCh,
+	})
+	if err != nil {
+		return nil, err
 	}
+	updatable = append(updatable, driftWatchdog)
 
 	return &Dependencies{
 		WMI:            wmi,
+		Capabilities:   caps,
+		Model:          descriptor,
 		Keyboard:       kbCtrl,
-		Battery:        battery,
+		Battery:        batteryCtrl,
+		BatteryMonitor: batteryMonitor,
 		Volume:         volCtrl,
 		Thermal:        thermal,
 		GPU:            gpuCtrl,
 		RR:             rrCtrl,
+		FanSampler:     fanSampler,
+		SoftwareFan:    softwareFan,
+		DriftWatchdog:  driftWatchdog,
+		KeyBindings:    keyBindings,
+		Setups:         setups,
 		ConfigRegistry: config,
 		Updatable:      updatable,
 	}, nil
@@ -135,21 +281,35 @@ func New(conf RunConfig, dep *Dependencies) (*Controller, chan error, error) {
 		return nil, nil, errors.New("nil NotifierCh is invalid")
 	}
 
+	plugins := []plugin.Plugin{
+		dep.Keyboard,
+		dep.Volume,
+		dep.Thermal,
+		dep.GPU,
+		dep.RR,
+	}
+	if dep.Battery != nil {
+		plugins = append(plugins, dep.Battery)
+	}
+
+	var batteryStatus <-chan battery.Status
+	if dep.BatteryMonitor != nil {
+		batteryStatus = dep.BatteryMonitor.C
+	}
+
 	startErrorCh := make(chan error, 1)
 	control := &Controller{
 		Config: Config{
-			WMI: dep.WMI,
-
-			Plugins: []plugin.Plugin{
-				dep.Keyboard,
-				dep.Volume,
-				dep.Thermal,
-				dep.GPU,
-				dep.RR,
-			},
+			WMI:          dep.WMI,
+			Capabilities: dep.Capabilities,
+			Model:        dep.Model,
+
+			Plugins:  plugins,
 			Registry: dep.ConfigRegistry,
 
-			Notifier: conf.NotifierCh,
+			Notifier:      conf.NotifierCh,
+			BatteryStatus: batteryStatus,
+			KeyBindings:   dep.KeyBindings,
 		},
 
 		workQueueCh:  make(map[uint32]workQueue, 1),
@@ -157,10 +317,37 @@ func New(conf RunConfig, dep *Dependencies) (*Controller, chan error, error) {
 		startErrorCh: startErrorCh,
 
 		keyCodeCh:  make(chan uint32, 1),
+		keyCodes:   dep.Model.KeyCodeMap(),
 		acpiCh:     make(chan uint32, 1),
+		acpiDec:    atkacpi.NewDecoder(),
+		lidCh:      make(chan bool, 1),
 		powerEvCh:  make(chan uint32, 1),
 		pluginCbCh: make(chan plugin.Callback, 1),
+		hookCh:     make(chan []plugin.HookRequest, hookQueueSize),
 	}
 
 	return control, startErrorCh, nil
 }
+
+// modelProfiles returns the default thermal profiles of the model
+func modelProfiles(d model.Descriptor) ([]thermal.Profile, error) {
+	if len(d.Profiles) == 0 {
+		return thermal.GetDefaultThermalProfiles(), nil
+	}
+	specs := make([]thermal.ProfileSpec, 0, len(d.Profiles))
+	for _, p := range d.Profiles {
+		specs = append(specs, thermal.ProfileSpec{
+			ID:               p.ID,
+			Name:             p.Name,
+			WindowsPowerPlan: p.WindowsPowerPlan,
+			ThrottlePlan:     p.ThrottlePlan,
+			CPUFanCurve:      p.CPUFanCurve,
+			GPUFanCurve:      p.GPUFanCurve,
+		})
+	}
+	profiles, err := thermal.ParseProfiles(specs, thermal.DefaultSafetyFloor)
+	if err != nil {
+		return nil, fmt.Errorf("model %s: %w", d.Name, err)
+	}
+	return thermal.AssignIDs(profiles, nil), nil
+}
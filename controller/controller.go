@@ -6,7 +6,9 @@ import (
 	"time"
 
 	"github.com/zllovesuki/G14Manager/system/atkacpi"
+	"github.com/zllovesuki/G14Manager/system/battery"
 	"github.com/zllovesuki/G14Manager/system/keyboard"
+	"github.com/zllovesuki/G14Manager/system/model"
 	"github.com/zllovesuki/G14Manager/system/persist"
 	"github.com/zllovesuki/G14Manager/system/plugin"
 	"github.com/zllovesuki/G14Manager/system/power"
@@ -21,6 +23,9 @@ const (
 	AutoThermalDelay = time.Second * 5
 )
 
+// hookQueueSize is the number of hook batches that can wait for plugins
+const hookQueueSize = 8
+
 const (
 	fnPersistConfigs = iota // for debouncing persisting to Registry
 	fnCheckCharger          // for debouncing power input change acpi event
@@ -33,32 +38,27 @@ const (
 	fnAutoThermal           // for switching thermal on power source change
 )
 
-type chargerStatus int
-
-const (
-	chargerPluggedIn chargerStatus = iota
-	chargerUnplugged
-)
-
-// https://yourbasic.org/golang/iota/
-func (c chargerStatus) String() string {
-	return [...]string{"Plugged In", "Unplugged"}[c]
-}
-
 // Config contains the configurations for the controller
 type Config struct {
-	WMI atkacpi.WMI
+	WMI          atkacpi.WMI
+	Capabilities atkacpi.Capabilities
+	Model        model.Descriptor
 
 	Plugins  []plugin.Plugin
 	Registry persist.ConfigRegistry
 
 	LogoPath string
 	Notifier chan<- util.Notification
+	// BatteryStatus is forwarded to plugins as EvtBatteryLevel. It is optional
+	BatteryStatus <-chan battery.Status
+	// KeyBindings are optional
+	KeyBindings *KeyBindings
 }
 
 type workQueue struct {
-	noisy chan<- interface{}
-	clean <-chan util.DebounceEvent
+	noisy   chan<- interface{}
+	clean   <-chan util.DebounceEvent
+	preview <-chan util.DebounceEvent // only for work queues with steps
 }
 
 // Controller contains configuration for the controller loop
@@ -70,9 +70,13 @@ type Controller struct {
 	startErrorCh chan error
 
 	keyCodeCh  chan uint32
+	keyCodes   map[uint32]uint32
 	acpiCh     chan uint32
+	acpiDec    *atkacpi.Decoder
+	lidCh      chan bool
 	powerEvCh  chan uint32
 	pluginCbCh chan plugin.Callback
+	hookCh     chan []plugin.HookRequest
 }
 
 func (c *Controller) initialize(haltCtx context.Context) error {
@@ -82,7 +86,7 @@ func (c *Controller) initialize(haltCtx context.Context) error {
 		}
 	}
 
-	_, err := keyboard.NewHidListener(haltCtx, c.keyCodeCh)
+	_, err := keyboard.NewHidListener(haltCtx, c.Config.Model.Keyboard(), c.keyCodeCh)
 	if err != nil {
 		return errors.Wrap(err, "[controller] error initializing hid listener")
 	}
@@ -97,14 +101,17 @@ func (c *Controller) initialize(haltCtx context.Context) error {
 		return errors.Wrap(err, "[controller] error initializing power event listener")
 	}
 
-	initBuf := make([]byte, 4)
-	if _, err := c.Config.WMI.Evaluate(atkacpi.INIT, initBuf); err != nil {
+	if err := power.NewLidListener(haltCtx, c.lidCh); err != nil {
+		// not fatal, as the lid state is then tracked from the ACPI events
+		log.Printf("[controller] cannot listen for lid switch state: %+v\n", err)
+	}
+
+	if _, err := atkacpi.Init().Execute(c.Config.WMI); err != nil {
 		return errors.Wrap(err, "[controller] cannot initialize ATKD")
 	}
 
 	debounceKeys := []uint32{
 		fnUtilityKey,
-		fnThermalProfile,
 	}
 	for _, key := range debounceKeys {
 		// TODO: make debounce interval configurable for accessbility
@@ -115,6 +122,14 @@ func (c *Controller) initialize(haltCtx context.Context) error {
 		}
 	}
 
+	// Fn+F5 cycles forward and the reverse cycle key backward, and the upcoming profile is previewed
+	in, out, preview := util.DebounceSteps(haltCtx, time.Millisecond*500)
+	c.workQueueCh[fnThermalProfile] = workQueue{
+		noisy:   in,
+		clean:   out,
+		preview: preview,
+	}
+
 	workQueueImmediate := []uint32{
 		fnCheckCharger,
 		fnApplyConfigs,
@@ -197,10 +212,12 @@ func (c *Controller) Serve(haltCtx context.Context) error {
 
 	// defined in controller_loop.go
 	go c.handlePluginCallback(haltCtx)
+	go c.handleHooks(haltCtx)
 	go c.handleWorkQueue(haltCtx)
 	go c.handlePowerEvent(haltCtx)
 	go c.handleACPINotification(haltCtx)
 	go c.handleKeyPress(haltCtx)
+	go c.handleBatteryStatus(haltCtx)
 
 	for {
 		select {
@@ -2,7 +2,7 @@ package controller
 
 import (
 	"context"
-	"encoding/binary"
+	"fmt"
 	"log"
 	"runtime"
 
@@ -10,6 +10,7 @@ import (
 	kb "github.com/zllovesuki/G14Manager/system/keyboard"
 	"github.com/zllovesuki/G14Manager/system/plugin"
 	"github.com/zllovesuki/G14Manager/system/power"
+	"github.com/zllovesuki/G14Manager/system/shared"
 	"github.com/zllovesuki/G14Manager/util"
 
 	"github.com/pkg/errors"
@@ -19,23 +20,32 @@ func (c *Controller) handleACPINotification(haltCtx context.Context) {
 	for {
 		select {
 		case acpi := <-c.acpiCh:
-			switch acpi {
-			case 87, 88, 207: // ignore these events
+			ev := c.acpiDec.Decode(acpi)
+			switch ev.Event {
+			case atkacpi.EventChargerMisc: // ignore this event
 				continue
-			/*case 87:
+			case atkacpi.EventOnBattery:
+				// this is when you unplug the 180W charger
 				log.Println("acpi: On battery")
-			case 88:
-				log.Println("acpi: On AC power")
+				c.notifyPlugins(plugin.EvtOnBattery, nil)
+			case atkacpi.EventOnACPower:
 				// this is when you plug in the 180W charger
 				// However, plugging in the USB C PD will not show 88 (might need to detect it in user space)
-				// there's also this mysterious 207 code, that only pops up when 180W charger is plugged in/unplugged*/
-			case 123:
+				log.Println("acpi: On AC power")
+				c.notifyPlugins(plugin.EvtACPowerOn, nil)
+			case atkacpi.EventPowerInputChanged:
 				log.Println("acpi: Power input changed")
 				c.workQueueCh[fnCheckCharger].noisy <- false // indicating non initial (continuous) check
-			case 233:
-				log.Println("acpi: On Lid Open/Close")
+			case atkacpi.EventLidSwitch:
+				log.Printf("acpi: %s\n", ev.Lid)
+				switch ev.Lid {
+				case atkacpi.LidClosed:
+					c.notifyPlugins(plugin.EvtLidClosed, nil)
+				case atkacpi.LidOpened:
+					c.notifyPlugins(plugin.EvtLidOpened, nil)
+				}
 			default:
-				log.Printf("acpi: Unknown %d\n", acpi)
+				log.Printf("acpi: %s\n", ev.Event)
 			}
 		case <-haltCtx.Done():
 			log.Println("[controller] exiting handleACPINotification")
@@ -44,9 +54,34 @@ func (c *Controller) handleACPINotification(haltCtx context.Context) {
 	}
 }
 
+func (c *Controller) handleBatteryStatus(haltCtx context.Context) {
+	for {
+		select {
+		case s := <-c.Config.BatteryStatus:
+			log.Printf("[controller] battery: %s\n", s)
+			c.notifyPlugins(plugin.EvtBatteryLevel, s)
+		case <-haltCtx.Done():
+			log.Println("[controller] exiting handleBatteryStatus")
+			return
+		}
+	}
+}
+
 func (c *Controller) handlePowerEvent(haltCtx context.Context) {
 	for {
 		select {
+		case closed := <-c.lidCh:
+			// Windows reports the lid state on start up, and every change afterward
+			if !c.acpiDec.SetLidClosed(closed) {
+				continue
+			}
+			if closed {
+				log.Println("[controller] lid closed")
+				c.notifyPlugins(plugin.EvtLidClosed, nil)
+			} else {
+				log.Println("[controller] lid opened")
+				c.notifyPlugins(plugin.EvtLidOpened, nil)
+			}
 		case ev := <-c.powerEvCh:
 			switch ev {
 			case power.PBT_APMRESUMESUSPEND:
@@ -69,6 +104,17 @@ func (c *Controller) handleKeyPress(haltCtx context.Context) {
 	for {
 		select {
 		case keyCode := <-c.keyCodeCh:
+			// translate to GA401 key codes if the model uses different ones
+			if translated, ok := c.keyCodes[keyCode]; ok {
+				keyCode = translated
+			}
+			if c.Config.KeyBindings != nil {
+				if code, ok := c.Config.KeyBindings.ReverseCycle(); ok && keyCode == code {
+					log.Println("hid: reverse cycle key Pressed (debounced)")
+					c.workQueueCh[fnThermalProfile].noisy <- int64(-1)
+					continue
+				}
+			}
 			switch keyCode {
 			case kb.KeyROG:
 				log.Println("hid: ROG Key Pressed (debounced)")
@@ -76,7 +122,7 @@ func (c *Controller) handleKeyPress(haltCtx context.Context) {
 
 			case kb.KeyFnF5:
 				log.Println("hid: Fn + F5 Pressed (debounced)")
-				c.workQueueCh[fnThermalProfile].noisy <- struct{}{}
+				c.workQueueCh[fnThermalProfile].noisy <- int64(1)
 
 			case kb.KeyVolDown:
 				log.Println("hid: volume down Pressed")
@@ -139,42 +185,54 @@ func (c *Controller) handleWorkQueue(haltCtx context.Context) {
 			c.notifyPlugins(plugin.EvtSentinelUtilityKey, ev.Counter)
 
 		case ev := <-c.workQueueCh[fnThermalProfile].clean:
-			log.Printf("[controller] Fn + F5 pressed %d times\n", ev.Counter)
+			log.Printf("[controller] cycling thermal profile by %d step(s)\n", ev.Counter)
 			c.notifyPlugins(plugin.EvtSentinelCycleThermalProfile, ev.Counter)
 
+		case ev := <-c.workQueueCh[fnThermalProfile].preview:
+			c.notifyPlugins(plugin.EvtSentinelPreviewThermalProfile, ev.Counter)
+
 		case ev := <-c.workQueueCh[fnCheckCharger].clean:
-			function := make([]byte, 4)
-			binary.LittleEndian.PutUint32(function, atkacpi.DstsCheckCharger)
-			status, err := c.Config.WMI.Evaluate(atkacpi.DSTS, function)
+			if !c.Config.Capabilities.Supports(atkacpi.DstsCheckCharger) {
+				log.Println("[controller] charger status is not supported by the firmware")
+				continue
+			}
+			resp, err := atkacpi.DstsGet(atkacpi.DstsCheckCharger).Execute(c.Config.WMI)
 			if err != nil {
 				c.errorCh <- errors.New("[controller] cannot check charger status")
 				return
 			}
+			status, err := resp.Status()
+			if err != nil {
+				c.errorCh <- errors.Wrap(err, "[controller] cannot decode charger status")
+				return
+			}
 			isInitialCheck := ev.Data.(bool)
-			switch binary.LittleEndian.Uint32(status[0:4]) {
-			case 0x0:
-				log.Println("[controller] charger is not plugged in")
-				if !isInitialCheck {
-					c.workQueueCh[fnAutoThermal].noisy <- chargerUnplugged
-				}
-			case 0x10001:
-				log.Println("[controller] 180W charger plugged in")
-				if !isInitialCheck {
-					c.workQueueCh[fnAutoThermal].noisy <- chargerPluggedIn
-				}
-			case 0x10002:
-				log.Println("[controller] USB-C PD charger plugged in")
-				if !isInitialCheck {
-					c.workQueueCh[fnAutoThermal].noisy <- chargerPluggedIn
-				}
+			var source shared.PowerSource
+			switch uint32(status) {
+			case atkacpi.ChargerUnplugged:
+				source = shared.PowerSourceBattery
+			case atkacpi.Charger180W:
+				source = shared.PowerSourceBarrel
+			case atkacpi.ChargerUSBCPD:
+				source = shared.PowerSourceUSBCPD
+			default:
+				log.Printf("[controller] unknown charger status 0x%x\n", uint32(status))
+				continue
+			}
+			log.Printf("[controller] power source: %s\n", source)
+			if isInitialCheck {
+				// plugins only track the power source, as the profile was restored from the registry
+				c.notifyPlugins(plugin.EvtPowerSourceState, source)
+				continue
 			}
+			c.workQueueCh[fnAutoThermal].noisy <- source
 
 		case ev := <-c.workQueueCh[fnAutoThermal].clean:
-			pluggedInStatus := ev.Data.(chargerStatus)
-			if pluggedInStatus == chargerPluggedIn {
-				c.notifyPlugins(plugin.EvtChargerPluggedIn, nil)
-			} else {
+			source := ev.Data.(shared.PowerSource)
+			if source == shared.PowerSourceBattery {
 				c.notifyPlugins(plugin.EvtChargerUnplugged, nil)
+			} else {
+				c.notifyPlugins(plugin.EvtChargerPluggedIn, source)
 			}
 
 		case <-c.workQueueCh[fnPersistConfigs].clean:
@@ -196,13 +254,9 @@ func (c *Controller) handleWorkQueue(haltCtx context.Context) {
 
 		case ev := <-c.workQueueCh[fnHwCtrl].clean:
 			keyCode := ev.Data.(uint32)
-			args := make([]byte, 8)
 			log.Printf("hwCtrl: notification from keypress on %d\n", keyCode)
 
-			binary.LittleEndian.PutUint32(args[0:], atkacpi.DevsHardwareCtrl)
-			binary.LittleEndian.PutUint32(args[4:], keyCode)
-
-			_, err := c.Config.WMI.Evaluate(atkacpi.DEVS, args)
+			_, err := atkacpi.DevsSet(atkacpi.DevsHardwareCtrl, keyCode).Execute(c.Config.WMI)
 			if err != nil {
 				c.errorCh <- errors.Wrap(err, "hwCtrl: error sending key code to ATKACPI")
 				return
@@ -233,6 +287,53 @@ func (c *Controller) notifyPlugins(evt plugin.Event, val interface{}) {
 	}
 }
 
+// handleHooks notifies plugins of one batch of hooks at a time, in order, so each plugin runs its hooks
+// in the order of the profile switches. Hooks owned by different plugins may still run concurrently
+func (c *Controller) handleHooks(haltCtx context.Context) {
+	for {
+		select {
+		case requests := <-c.hookCh:
+			for _, r := range requests {
+				log.Printf("[controller] running %s\n", r)
+				t := plugin.Notification{
+					Event: plugin.EvtProfileHook,
+					Value: r,
+				}
+				// the battery plugin is not running without the charge limit, so the hook is answered here
+				if r.Hook.Action == plugin.HookChargeLimit && !c.Config.Capabilities.Supports(atkacpi.DevsBatteryChargeLimit) {
+					c.hookResult(plugin.HookResult{
+						Request: r,
+						Skipped: "battery charge limit is not supported",
+					})
+					continue
+				}
+				for _, p := range c.Config.Plugins {
+					p.Notify(t)
+				}
+			}
+		case <-haltCtx.Done():
+			log.Println("[controller] exiting handleHooks")
+			return
+		}
+	}
+}
+
+// hookResult reports the result of a hook. A failed hook is reported on its own, and does not affect
+// the profile or other hooks
+func (c *Controller) hookResult(result plugin.HookResult) {
+	switch {
+	case result.Skipped != "":
+		log.Printf("[controller] %s skipped: %s\n", result.Request, result.Skipped)
+	case result.Err == nil:
+		log.Printf("[controller] %s succeeded\n", result.Request)
+	default:
+		log.Printf("[controller] %s failed: %s\n", result.Request, result.Err)
+		c.Config.Notifier <- util.Notification{
+			Message: fmt.Sprintf("Profile %s: %s hook failed: %s", result.Request.Profile, result.Request.Hook.Action, result.Err),
+		}
+	}
+}
+
 func (c *Controller) handlePluginCallback(haltCtx context.Context) {
 	for {
 		select {
@@ -244,6 +345,22 @@ func (c *Controller) handlePluginCallback(haltCtx context.Context) {
 				if n, ok := t.Value.(util.Notification); ok {
 					c.Config.Notifier <- n
 				}
+			case plugin.CbRunHooks:
+				requests, ok := t.Value.([]plugin.HookRequest)
+				if !ok {
+					continue
+				}
+				select {
+				case c.hookCh <- requests:
+				default:
+					log.Printf("[controller] too many pending hooks, dropping %d hook(s)\n", len(requests))
+				}
+			case plugin.CbHookResult:
+				result, ok := t.Value.(plugin.HookResult)
+				if !ok {
+					continue
+				}
+				c.hookResult(result)
 			}
 		case <-haltCtx.Done():
 			log.Println("[controller] exiting handlePluginCallback")
@@ -10,13 +10,27 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"strings"
+	"sync"
 
+	"github.com/zllovesuki/G14Manager/system/persist"
 	"github.com/zllovesuki/G14Manager/system/plugin"
+	"github.com/zllovesuki/G14Manager/system/shared"
 	"github.com/zllovesuki/G14Manager/util"
 )
 
+const (
+	persistKey = "GPU"
+)
+
 type Control struct {
-	dryRun  bool
+	dryRun bool
+
+	// the GPU state is queried when it is first needed, and tracked after the GPU is enabled or disabled
+	mu      sync.Mutex
+	enabled bool
+	known   bool
+
 	queue   chan plugin.Notification
 	errChan chan error
 }
@@ -40,6 +54,7 @@ func (c *Control) RestartGPU() error {
 	if int(ret) == 0 {
 		return &gpuGeneralError{"cannot re-enable gpu"}
 	}
+	c.setState(true)
 	return nil
 }
 
@@ -49,8 +64,10 @@ func (c *Control) DisableGPU() error {
 	case 0:
 		return &gpuGeneralError{"cannot disable gpu"}
 	case 2:
+		c.setState(false)
 		return &gpuInvalidStateError{"GPU is already disabled"}
 	default:
+		c.setState(false)
 		return nil
 	}
 }
@@ -61,10 +78,49 @@ func (c *Control) EnableGPU() error {
 	case 0:
 		return &gpuGeneralError{"cannot enable gpu"}
 	case 2:
+		c.setState(true)
 		return &gpuInvalidStateError{"GPU is already enabled"}
 	default:
+		c.setState(true)
+		return nil
+	}
+}
+
+// QueryGPU returns true if the GPU is enabled
+func (c *Control) QueryGPU() (bool, error) {
+	switch int(C.queryGPU()) {
+	case 0:
+		return false, &gpuGeneralError{"cannot query gpu state"}
+	case 1:
+		c.setState(true)
+		return true, nil
+	default:
+		c.setState(false)
+		return false, nil
+	}
+}
+
+func (c *Control) setState(enabled bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.enabled = enabled
+	c.known = true
+}
+
+// setGPU turns the GPU on or off. The GPU already being in the requested state is not an error
+func (c *Control) setGPU(on bool) error {
+	var err error
+	if on {
+		err = c.EnableGPU()
+	} else {
+		err = c.DisableGPU()
+	}
+	var recoverable *gpuInvalidStateError
+	if errors.As(err, &recoverable) {
 		return nil
 	}
+	return err
 }
 
 func (c *Control) Initialize() error {
@@ -84,6 +140,27 @@ func (c *Control) loop(haltCtx context.Context, cb chan<- plugin.Callback) {
 		case evt := <-c.queue:
 			if c.dryRun {
 				log.Println("gpu: dry run, not controlling GPU state")
+				if evt.Event == plugin.EvtProfileHook {
+					cb <- plugin.Callback{
+						Event: plugin.CbHookResult,
+						Value: plugin.HookResult{
+							Request: evt.Value.(plugin.HookRequest),
+							Skipped: "dry run",
+						},
+					}
+				}
+				continue
+			}
+			if evt.Event == plugin.EvtProfileHook {
+				r := evt.Value.(plugin.HookRequest)
+				err := c.setGPU(strings.EqualFold(r.Hook.Value, "on"))
+				cb <- plugin.Callback{
+					Event: plugin.CbHookResult,
+					Value: plugin.HookResult{
+						Request: r,
+						Err:     err,
+					},
+				}
 				continue
 			}
 			var action string
@@ -136,9 +213,90 @@ func (c *Control) Run(haltCtx context.Context, cb chan<- plugin.Callback) <-chan
 }
 
 func (c *Control) Notify(t plugin.Notification) {
-	if t.Event != plugin.EvtSentinelEnableGPU && t.Event != plugin.EvtSentinelDisableGPU {
+	if t.Event == plugin.EvtProfileHook {
+		if r, ok := t.Value.(plugin.HookRequest); !ok || r.Hook.Action != plugin.HookGPU {
+			return
+		}
+	} else if t.Event != plugin.EvtSentinelEnableGPU && t.Event != plugin.EvtSentinelDisableGPU {
 		return
 	}
 
 	c.queue <- t
 }
+
+// The GPU state is not registered to be persisted: persist.Registry is used by setups
+// to restore the GPU state if a setup cannot be applied
+var _ persist.Registry = &Control{}
+
+// Name satisfies persist.Registry
+func (c *Control) Name() string {
+	return persistKey
+}
+
+// Value satisfies persist.Registry. The GPU state is queried if it is not known yet,
+// and the value is empty if it cannot be queried
+func (c *Control) Value() []byte {
+	c.mu.Lock()
+	known, enabled := c.known, c.enabled
+	c.mu.Unlock()
+
+	if !known && !c.dryRun {
+		var err error
+		enabled, err = c.QueryGPU()
+		if err != nil {
+			log.Printf("gpu: %s\n", err)
+			return nil
+		}
+		known = true
+	}
+	if !known {
+		return nil
+	}
+	if enabled {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// Load satisfies persist.Registry
+func (c *Control) Load(v []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.known = len(v) > 0
+	c.enabled = c.known && v[0] == 1
+	return nil
+}
+
+// Apply satisfies persist.Registry. Nothing is changed if the loaded value is empty
+func (c *Control) Apply() error {
+	c.mu.Lock()
+	known, enabled := c.known, c.enabled
+	c.mu.Unlock()
+
+	if !known {
+		return nil
+	}
+	return c.setGPU(enabled)
+}
+
+// Close satisfied persist.Registry
+func (c *Control) Close() error {
+	return nil
+}
+
+// ApplySetup satisfies system/setup.Device
+func (c *Control) ApplySetup(s shared.Setup) (bool, error) {
+	if s.GPU == "" {
+		return false, nil
+	}
+	if c.dryRun {
+		log.Println("gpu: dry run, not controlling GPU state")
+		return false, nil
+	}
+	// the previous state must be known to restore it if another device fails
+	if c.Value() == nil {
+		return false, &gpuGeneralError{"cannot query gpu state, so it could not be restored"}
+	}
+	return true, c.setGPU(strings.EqualFold(s.GPU, "on"))
+}
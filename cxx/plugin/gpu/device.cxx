@@ -193,4 +193,69 @@ GTFO:
     }
 
     return ret;
-}
\ No newline at end of file
+}
+
+/*
+    Return code:
+    0: Unrecoverable error
+    1: Enabled
+    2: Disabled
+*/
+
+int queryGPU(void)
+{
+    int ret = 0;
+    HDEVINFO deviceInfoSet;
+    deviceInfoSet = SetupDiGetClassDevsA(&GUID_DEVINTERFACE_DISPLAY_ADAPTER, NULL, NULL, DIGCF_DEVICEINTERFACE);
+    if (INVALID_HANDLE_VALUE == deviceInfoSet)
+    {
+        std::cerr << "gpu: SetupDiGetClassDevsA error: " << GetLastError() << std::endl;
+        return 0;
+    }
+
+    SP_DEVINFO_DATA deviceInfoData;
+    ZeroMemory(&deviceInfoData, sizeof(SP_DEVINFO_DATA));
+    deviceInfoData.cbSize = sizeof(SP_DEVINFO_DATA);
+
+    unsigned long status = 0;
+    unsigned long problem = 0;
+    char mfgName[MAX_LEN] = {0};
+    int foundDevice = 0;
+
+    int deviceMemberIndex = 0;
+    while (SetupDiEnumDeviceInfo(deviceInfoSet, deviceMemberIndex, &deviceInfoData))
+    {
+        deviceMemberIndex++;
+        deviceInfoData.cbSize = sizeof(deviceInfoData);
+
+        if (CR_SUCCESS != CM_Get_DevNode_Status(&status, &problem, deviceInfoData.DevInst, 0))
+        {
+            std::cerr << "gpu: CM_Get_DevNode_Status error: " << GetLastError() << std::endl;
+            goto GTFO;
+        }
+
+        SetupDiGetDeviceRegistryPropertyA(deviceInfoSet, &deviceInfoData, SPDRP_MFG, 0, (PBYTE)mfgName, MAX_LEN, NULL);
+
+        if (strncmp(mfgName, nvidiaMfgName, MAX_LEN) == 0)
+        {
+            foundDevice = 1;
+            break;
+        }
+    }
+
+    if (foundDevice == 0)
+    {
+        std::cerr << "gpu: Cannot found NVIDIA graphics card" << std::endl;
+        goto GTFO;
+    }
+
+    ret = (status & DN_STARTED) ? 1 : 2;
+
+GTFO:
+    if (!SetupDiDestroyDeviceInfoList(deviceInfoSet))
+    {
+        std::cerr << "gpu: SetupDiDestroyDeviceInfoList error: " << GetLastError() << std::endl;
+    }
+
+    return ret;
+}
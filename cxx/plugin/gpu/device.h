@@ -5,6 +5,7 @@ extern "C"
 
     int disableGPU(void);
     int enableGPU(void);
+    int queryGPU(void);
 
 #ifdef __cplusplus
 }
@@ -28,7 +28,9 @@ import (
 	"time"
 
 	"github.com/zllovesuki/G14Manager/rpc/announcement"
+	"github.com/zllovesuki/G14Manager/system/atkacpi"
 	"github.com/zllovesuki/G14Manager/system/device"
+	"github.com/zllovesuki/G14Manager/system/drift"
 	"github.com/zllovesuki/G14Manager/system/ioctl"
 	"github.com/zllovesuki/G14Manager/system/keyboard"
 	kb "github.com/zllovesuki/G14Manager/system/keyboard"
@@ -54,10 +56,6 @@ const (
 	initBufferLength                  = 64
 )
 
-const (
-	kbControlDevice = "mi_02&col01"
-)
-
 // TODO: reverse engineer this as well
 var (
 	brightnessControlBuffer = []byte{
@@ -104,31 +102,39 @@ type Control struct {
 	mu                sync.RWMutex
 	deviceCtrl        *device.Control
 	currentBrightness Level
+	verified          bool // whether the firmware reported currentBrightness after it was written
 
 	queue   chan plugin.Notification
 	errChan chan error
 }
 
 // Config defines the behavior of Keyboard Control. If DryRun is set to true,
-// no actual IOs will be performed. Remap defines the key remapping behavior or
-// Fn+ArrowLeft/ArrowRight (see system/keyboard) to standard key scancode.
+// no actual IOs will be performed. Device defines the HID interfaces of the
+// keyboard, and defaults to the GA401 keyboard. Remap defines the key remapping behavior or
+// Fn+ArrowLeft/ArrowRight (see system/keyboard) to standard key scancode. If WMI is set,
+// the brightness is read back from the firmware to check for drift.
 type Config struct {
 	DryRun bool
+	Device kb.Device
 	Remap  map[uint32]uint16
 	RogKey []string
+	WMI    atkacpi.WMI
 }
 
 var _ plugin.Plugin = &Control{}
 
 // NewControl checks if the computer has the hid control interface, and returns a control interface if it does
 func NewControl(config Config) (*Control, error) {
-	devices, err := usb.EnumerateHid(kb.VendorID, kb.ProductID)
+	if config.Device.VendorID == 0 {
+		config.Device = kb.DefaultDevice
+	}
+	devices, err := usb.EnumerateHid(config.Device.VendorID, config.Device.ProductID)
 	if err != nil {
 		return nil, err
 	}
 	var path string
 	for _, device := range devices {
-		if strings.Contains(device.Path, kbControlDevice) {
+		if strings.Contains(device.Path, config.Device.Control) {
 			path = device.Path
 		}
 	}
@@ -247,6 +253,50 @@ func (c *Control) loop(haltCtx context.Context, cb chan<- plugin.Callback) {
 				log.Println("kbCtrl: turning off keyboard backlight")
 				c.errChan <- c.SetBrightness(OFF)
 
+			case plugin.EvtProfileHook:
+				r, ok := t.Value.(plugin.HookRequest)
+				if !ok {
+					continue
+				}
+				var err error
+				switch r.Hook.Action {
+				case plugin.HookKeyboardBrightness:
+					err = c.setBrightnessByName(r.Hook.Value)
+					if err == nil {
+						cb <- plugin.Callback{
+							Event: plugin.CbPersistConfig,
+						}
+					}
+				case plugin.HookCommand:
+					log.Printf("kbCtrl: Running: %s\n", r.Hook.Value)
+					var cmd *exec.Cmd
+					cmd, err = start("cmd.exe", "/C", r.Hook.Value)
+					if err != nil {
+						break
+					}
+					// report the exit status once the command exits, without blocking the loop
+					go func(r plugin.HookRequest) {
+						result := plugin.HookResult{
+							Request: r,
+							Err:     cmd.Wait(),
+						}
+						select {
+						case cb <- plugin.Callback{Event: plugin.CbHookResult, Value: result}:
+						case <-haltCtx.Done():
+						}
+					}(r)
+					continue
+				default:
+					continue
+				}
+				cb <- plugin.Callback{
+					Event: plugin.CbHookResult,
+					Value: plugin.HookResult{
+						Request: r,
+						Err:     err,
+					},
+				}
+
 			case plugin.EvtSentinelUtilityKey:
 				counter, ok := t.Value.(int64)
 				if !ok {
@@ -308,9 +358,33 @@ func (c *Control) SetBrightness(v Level) error {
 
 	c.currentBrightness = v
 
+	if c.WMI != nil {
+		reported, err := c.readBrightness()
+		c.verified = err == nil && reported == v
+	}
+
 	return nil
 }
 
+// readBrightness reads the brightness back from the firmware. c.mu must be held
+func (c *Control) readBrightness() (Level, error) {
+	resp, err := atkacpi.DstsGet(atkacpi.DstsKeyboardBacklight).Execute(c.WMI)
+	if err != nil {
+		return OFF, err
+	}
+	level, err := resp.KeyboardBrightness()
+	return Level(level), err
+}
+
+func (c *Control) setBrightnessByName(name string) error {
+	for _, level := range []Level{OFF, LOW, MEDIUM, HIGH} {
+		if strings.EqualFold(level.String(), name) {
+			return c.SetBrightness(level)
+		}
+	}
+	return fmt.Errorf("kbCtrl: unknown brightness level %s", name)
+}
+
 // BrightnessUp increases the keyboard backlight by one level
 func (c *Control) BrightnessUp() error {
 	var targetLevel Level
@@ -433,6 +507,45 @@ func (c *Control) Apply() error {
 	return c.SetBrightness(c.currentBrightness)
 }
 
+// ApplySetup satisfies system/setup.Device
+func (c *Control) ApplySetup(s shared.Setup) (bool, error) {
+	if s.KeyboardBrightness == "" {
+		return false, nil
+	}
+	return true, c.setBrightnessByName(s.KeyboardBrightness)
+}
+
+var _ drift.Checker = &Control{}
+
+// CheckDrift satisfies system/drift.Checker. The brightness is only checked if it was verified when written
+func (c *Control) CheckDrift() ([]drift.Drift, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.verified {
+		return nil, nil
+	}
+	reported, err := c.readBrightness()
+	if err != nil {
+		return nil, err
+	}
+	if reported == c.currentBrightness {
+		return nil, nil
+	}
+	return []drift.Drift{
+		{
+			Setting:  "keyboard brightness",
+			Desired:  c.currentBrightness.String(),
+			Reported: reported.String(),
+		},
+	}, nil
+}
+
+// Reapply satisfies system/drift.Checker
+func (c *Control) Reapply() error {
+	return c.Apply()
+}
+
 // Close satisfied persist.Registry
 func (c *Control) Close() error {
 	c.mu.Lock()
@@ -442,7 +555,16 @@ func (c *Control) Close() error {
 }
 
 func run(commands ...string) error {
+	_, err := start(commands...)
+	return err
+}
+
+// start starts the command without a console window
+func start(commands ...string) (*exec.Cmd, error) {
 	cmd := exec.Command(commands[0], commands[1:]...)
 	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: 0x08000000}
-	return cmd.Start()
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return cmd, nil
 }
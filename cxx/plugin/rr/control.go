@@ -2,19 +2,31 @@ package rr
 
 import (
 	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"log"
 	"runtime"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/zllovesuki/G14Manager/cxx/rr"
+	"github.com/zllovesuki/G14Manager/system/persist"
 	"github.com/zllovesuki/G14Manager/system/plugin"
+	"github.com/zllovesuki/G14Manager/system/shared"
 	"github.com/zllovesuki/G14Manager/util"
 )
 
+const (
+	persistKey = "RefreshRate"
+)
+
 type Control struct {
 	dryRun   bool
+	mu       sync.Mutex
 	pDisplay *rr.Display
+	hz       int
 
 	queue   chan plugin.Notification
 	errChan chan error
@@ -66,9 +78,25 @@ func (c *Control) loop(haltCtx context.Context, cb chan<- plugin.Callback) {
 
 	for {
 		select {
-		case <-c.queue:
+		case t := <-c.queue:
 			if c.dryRun {
 				log.Println("rr: dry run, not changing refresh rate")
+				if t.Event == plugin.EvtProfileHook {
+					cb <- plugin.Callback{
+						Event: plugin.CbHookResult,
+						Value: plugin.HookResult{
+							Request: t.Value.(plugin.HookRequest),
+							Skipped: "dry run",
+						},
+					}
+				}
+				continue
+			}
+			if t.Event == plugin.EvtProfileHook {
+				cb <- plugin.Callback{
+					Event: plugin.CbHookResult,
+					Value: c.runHook(t.Value.(plugin.HookRequest)),
+				}
 				continue
 			}
 			n := util.Notification{
@@ -109,6 +137,40 @@ func (c *Control) loop(haltCtx context.Context, cb chan<- plugin.Callback) {
 	}
 }
 
+func (c *Control) runHook(r plugin.HookRequest) plugin.HookResult {
+	result := plugin.HookResult{
+		Request: r,
+	}
+	hz, err := strconv.Atoi(r.Hook.Value)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result.Err = c.setRefreshRate(hz)
+	return result
+}
+
+// setRefreshRate changes the refresh rate of the internal display. Caller must hold the lock
+func (c *Control) setRefreshRate(hz int) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if c.pDisplay == nil {
+		c.Initialize()
+		if c.pDisplay == nil {
+			return errors.New("internal display is not primary")
+		}
+	}
+	if c.pDisplay.SetRefreshRate(hz) == 0 {
+		return fmt.Errorf("unable to change refresh rate to %d Hz", hz)
+	}
+	return nil
+}
+
 // Run satisfies system/plugin.Plugin
 func (c *Control) Run(haltCtx context.Context, cb chan<- plugin.Callback) <-chan error {
 	log.Println("rr: Starting queue loop")
@@ -120,13 +182,80 @@ func (c *Control) Run(haltCtx context.Context, cb chan<- plugin.Callback) <-chan
 
 // Notify satisfies system/plugin.Plugin
 func (c *Control) Notify(t plugin.Notification) {
-	if c.dryRun {
+	if t.Event == plugin.EvtProfileHook {
+		if r, ok := t.Value.(plugin.HookRequest); !ok || r.Hook.Action != plugin.HookRefreshRate {
+			return
+		}
+	} else if t.Event != plugin.EvtSentinelCycleRefreshRate {
 		return
 	}
 
-	if t.Event != plugin.EvtSentinelCycleRefreshRate {
-		return
+	c.queue <- t
+}
+
+// The refresh rate is not registered to be persisted: persist.Registry is used by setups
+// to restore the refresh rate if a setup cannot be applied
+var _ persist.Registry = &Control{}
+
+// Name satisfies persist.Registry
+func (c *Control) Name() string {
+	return persistKey
+}
+
+// Value satisfies persist.Registry. The value is empty if the internal display is not primary
+func (c *Control) Value() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.pDisplay == nil {
+		return nil
 	}
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf, uint32(c.pDisplay.GetCurrent()))
+	return buf
+}
 
-	c.queue <- t
+// Load satisfies persist.Registry
+func (c *Control) Load(v []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.hz = 0
+	if len(v) < 4 {
+		return nil
+	}
+	c.hz = int(binary.LittleEndian.Uint32(v))
+	return nil
+}
+
+// Apply satisfies persist.Registry. Nothing is changed if no refresh rate was loaded
+func (c *Control) Apply() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.hz == 0 {
+		return nil
+	}
+	return c.setRefreshRate(c.hz)
+}
+
+// Close satisfied persist.Registry
+func (c *Control) Close() error {
+	return nil
+}
+
+// ApplySetup satisfies system/setup.Device
+func (c *Control) ApplySetup(s shared.Setup) (bool, error) {
+	if s.RefreshRate == 0 {
+		return false, nil
+	}
+	if c.dryRun {
+		log.Println("rr: dry run, not changing refresh rate")
+		return false, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return true, c.setRefreshRate(int(s.RefreshRate))
 }
@@ -9,14 +9,21 @@ import (
 	"fmt"
 	"log"
 	"runtime"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/zllovesuki/G14Manager/system/keyboard"
+	"github.com/zllovesuki/G14Manager/system/persist"
 	"github.com/zllovesuki/G14Manager/system/plugin"
+	"github.com/zllovesuki/G14Manager/system/shared"
 	"github.com/zllovesuki/G14Manager/util"
 )
 
+const (
+	persistKey = "MicMute"
+)
+
 type Control struct {
 	dryRun  bool
 	isMuted bool
@@ -135,20 +142,91 @@ func (c *Control) ToggleMuted() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	return c.setMuted(!c.isMuted)
+}
+
+// SetMuted sets the default recording device's muted status
+func (c *Control) SetMuted(muted bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.setMuted(muted)
+}
+
+// setMuted sets the muted status. Caller must hold the lock
+func (c *Control) setMuted(muted bool) error {
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
 
 	var to int
-	if !c.isMuted {
+	if muted {
 		to = 1
 	}
-	log.Printf("volCtrl: setting microphone mute to %t\n", to == 1)
+	log.Printf("volCtrl: setting microphone mute to %t\n", muted)
 	ret := C.SetMicrophoneMute(0, C.int(to))
 	switch ret {
 	case -1:
 		return fmt.Errorf("Cannot set microphone muted status")
 	default:
-		c.isMuted = !c.isMuted
+		c.isMuted = muted
+		return nil
+	}
+}
+
+// The muted status is not registered to be persisted: persist.Registry is used by setups
+// to restore the muted status if a setup cannot be applied
+var _ persist.Registry = &Control{}
+
+// Name satisfies persist.Registry
+func (c *Control) Name() string {
+	return persistKey
+}
+
+// Value satisfies persist.Registry. The value is empty if the muted status cannot be checked
+func (c *Control) Value() []byte {
+	muted, err := c.CheckMuted()
+	if err != nil {
+		return nil
+	}
+	if muted {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// Load satisfies persist.Registry
+func (c *Control) Load(v []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(v) == 0 {
 		return nil
 	}
+	c.isMuted = v[0] == 1
+	return nil
+}
+
+// Apply satisfies persist.Registry
+func (c *Control) Apply() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.setMuted(c.isMuted)
+}
+
+// Close satisfied persist.Registry
+func (c *Control) Close() error {
+	return nil
+}
+
+// ApplySetup satisfies system/setup.Device
+func (c *Control) ApplySetup(s shared.Setup) (bool, error) {
+	if s.MicMute == "" {
+		return false, nil
+	}
+	if c.dryRun {
+		log.Println("volCtrl: dry run, not changing microphone mute")
+		return false, nil
+	}
+	return true, c.SetMuted(strings.EqualFold(s.MicMute, "on"))
 }
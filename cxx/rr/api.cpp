@@ -70,4 +70,22 @@ int fnCycleRefreshRate(void *p)
     {
         return 0;
     }
+}
+
+int fnSetRefreshRate(void *p, int rate)
+{
+    Display *pDisplay = static_cast<Display *>(p);
+    auto rates = pDisplay->getSupportedRefreshRates();
+    if (rates.find(rate) == rates.end())
+    {
+        return 0;
+    }
+    if (pDisplay->setRefreshRate(rate))
+    {
+        return rate;
+    }
+    else
+    {
+        return 0;
+    }
 }
\ No newline at end of file
@@ -6,6 +6,7 @@ extern "C"
     void *fnGetDisplay(void);
     int fnCycleRefreshRate(void *);
     int fnGetCurrentRefreshRate(void *);
+    int fnSetRefreshRate(void *, int);
     void fnReleaseDisplay(void *);
 
 #ifdef __cplusplus
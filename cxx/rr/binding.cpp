@@ -24,6 +24,11 @@ extern "C"
         return fnGetCurrentRefreshRate(pDisplay);
     }
 
+    int SetRefreshRate(int rate)
+    {
+        return fnSetRefreshRate(pDisplay, rate);
+    }
+
     void ReleaseDisplay()
     {
         fnReleaseDisplay(pDisplay);
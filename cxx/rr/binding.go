@@ -23,6 +23,11 @@ func (d *Display) CycleRefreshRate() int {
 	return int(C.CycleRefreshRate())
 }
 
+// SetRefreshRate sets the refresh rate if the display supports it, and returns 0 otherwise
+func (d *Display) SetRefreshRate(hz int) int {
+	return int(C.SetRefreshRate(C.int(hz)))
+}
+
 func (d *Display) GetCurrent() int {
 	return int(C.GetCurrentRefreshRate())
 }
@@ -12,6 +12,7 @@ extern "C"
     int GetDisplay();
     int CycleRefreshRate();
     int GetCurrentRefreshRate();
+    int SetRefreshRate(int);
     void ReleaseDisplay();
 
 #ifdef __cplusplus
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/zllovesuki/G14Manager/rpc/protocol"
+	"github.com/zllovesuki/G14Manager/system/atkacpi"
+
+	empty "github.com/golang/protobuf/ptypes/empty"
+	"google.golang.org/grpc"
+)
+
+type CapabilityServer struct {
+	protocol.UnimplementedCapabilityServer
+
+	mu   sync.RWMutex
+	caps atkacpi.Capabilities
+}
+
+var _ protocol.CapabilityServer = &CapabilityServer{}
+
+func RegisterCapabilityServer(s *grpc.Server, caps atkacpi.Capabilities) *CapabilityServer {
+	server := &CapabilityServer{
+		caps: caps,
+	}
+	protocol.RegisterCapabilityServer(s, server)
+	return server
+}
+
+func (c *CapabilityServer) GetCapabilities(ctx context.Context, _ *empty.Empty) (*protocol.CapabilitiesResponse, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	list := c.caps.List()
+	caps := make([]*protocol.DeviceCapability, 0, len(list))
+	for _, cap := range list {
+		caps = append(caps, &protocol.DeviceCapability{
+			Name:      cap.Name,
+			Device:    cap.Device,
+			Supported: cap.Supported,
+		})
+	}
+
+	return &protocol.CapabilitiesResponse{
+		Success:      true,
+		Capabilities: caps,
+	}, nil
+}
+
+func (c *CapabilityServer) HotReload(caps atkacpi.Capabilities) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	log.Println("[gRPCServer] hot reloading capability server")
+
+	c.caps = caps
+}
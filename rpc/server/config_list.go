@@ -6,16 +6,23 @@ import (
 	"encoding/gob"
 	"fmt"
 	"log"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/zllovesuki/G14Manager/rpc/announcement"
 	"github.com/zllovesuki/G14Manager/rpc/protocol"
+	"github.com/zllovesuki/G14Manager/system/drift"
+	"github.com/zllovesuki/G14Manager/system/fan"
 	"github.com/zllovesuki/G14Manager/system/keyboard"
 	"github.com/zllovesuki/G14Manager/system/persist"
+	"github.com/zllovesuki/G14Manager/system/plugin"
 	"github.com/zllovesuki/G14Manager/system/shared"
 	"github.com/zllovesuki/G14Manager/system/thermal"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
 )
 
@@ -32,11 +39,16 @@ type ConfigListServer struct {
 	updatable []announcement.Updatable
 	features  shared.Features
 	profiles  []thermal.Profile
+	floor     thermal.SafetyFloor
 }
 
 var _ protocol.ConfigListServer = &ConfigListServer{}
 
-func RegisterConfigListServer(s *grpc.Server, u []announcement.Updatable) *ConfigListServer {
+// RegisterConfigListServer registers the server. Fan curves set by clients are validated against the safety floor
+func RegisterConfigListServer(s *grpc.Server, u []announcement.Updatable, defaultProfiles []thermal.Profile, floor thermal.SafetyFloor) *ConfigListServer {
+	if len(defaultProfiles) == 0 {
+		defaultProfiles = thermal.GetDefaultThermalProfiles()
+	}
 	server := &ConfigListServer{
 		updatable: u,
 		// sensible defaults
@@ -49,8 +61,15 @@ func RegisterConfigListServer(s *grpc.Server, u []announcement.Updatable) *Confi
 				Enabled: false,
 			},
 			RogRemap: []string{"Taskmgr.exe"},
+			FanSampler: shared.FanSampler{
+				Interval: fan.DefaultInterval,
+			},
+			DriftWatchdog: shared.DriftWatchdog{
+				Interval: drift.DefaultInterval,
+			},
 		},
-		profiles: thermal.GetDefaultThermalProfiles(),
+		profiles: defaultProfiles,
+		floor:    floor,
 	}
 	protocol.RegisterConfigListServer(s, server)
 	return server
@@ -64,25 +83,7 @@ func (f *ConfigListServer) GetCurrentConfigs(ctx context.Context, req *emptypb.E
 	for k, v := range f.features.FnRemap {
 		fnRemap[k] = uint32(v)
 	}
-	profiles := make([]*protocol.Profile, 0, 3)
-	for _, p := range f.profiles {
-		var val protocol.Profile_ThrottleValue
-		switch p.ThrottlePlan {
-		case thermal.ThrottlePlanPerformance:
-			val = protocol.Profile_PERFORMANCE
-		case thermal.ThrottlePlanSilent:
-			val = protocol.Profile_SILENT
-		case thermal.ThrottlePlanTurbo:
-			val = protocol.Profile_TURBO
-		}
-		profiles = append(profiles, &protocol.Profile{
-			Name:             p.Name,
-			WindowsPowerPlan: p.WindowsPowerPlan,
-			ThrottlePlan:     val,
-			CPUFanCurve:      p.CPUFanCurve.String(),
-			GPUFanCurve:      p.GPUFanCurve.String(),
-		})
-	}
+	profiles := toProtocolProfiles(f.profiles)
 	return &protocol.SetConfigsResponse{
 		Success: true,
 		Configs: &protocol.Configs{
@@ -91,9 +92,29 @@ func (f *ConfigListServer) GetCurrentConfigs(ctx context.Context, req *emptypb.E
 					Enabled:          f.features.AutoThermal.Enabled,
 					PluggedInProfile: f.features.AutoThermal.PluggedIn,
 					UnpluggedProfile: f.features.AutoThermal.Unplugged,
+					BarrelProfile:    f.features.AutoThermal.Barrel,
+					USBCPDProfile:    f.features.AutoThermal.USBCPD,
+					BatteryRules:     toProtocolBatteryRules(f.features.AutoThermal.BatteryRules),
 				},
 				FnRemap:  fnRemap,
 				RogRemap: f.features.RogRemap,
+				FanSampler: &protocol.FanSampler{
+					Interval: uint32(f.features.FanSampler.Interval / time.Millisecond),
+				},
+				DriftWatchdog: &protocol.DriftWatchdog{
+					Disabled: f.features.DriftWatchdog.Disabled,
+					Interval: uint32(f.features.DriftWatchdog.Interval / time.Millisecond),
+				},
+				SoftwareFan: &protocol.SoftwareFan{
+					Enabled:      f.features.SoftwareFan.Enabled,
+					Target:       f.features.SoftwareFan.Target,
+					ThrottlePlan: f.features.SoftwareFan.ThrottlePlan,
+				},
+				Schedules:       toProtocolSchedules(f.features.Schedules),
+				ProcessRules:    toProtocolProcessRules(f.features.ProcessRules),
+				CycleProfiles:   f.features.CycleProfiles,
+				ReverseCycleKey: f.features.ReverseCycleKey,
+				Boost:           toProtocolBoost(f.features.Boost),
 			},
 			Profiles: profiles,
 		},
@@ -133,9 +154,57 @@ func (f *ConfigListServer) Set(ctx context.Context, req *protocol.SetConfigsRequ
 				Enabled:   feats.AutoThermal.Enabled,
 				PluggedIn: feats.AutoThermal.PluggedInProfile,
 				Unplugged: feats.AutoThermal.UnpluggedProfile,
+				Barrel:    feats.AutoThermal.BarrelProfile,
+				USBCPD:    feats.AutoThermal.USBCPDProfile,
 			},
 			FnRemap:  fnRemap,
 			RogRemap: feats.GetRogRemap(),
+			FanSampler: shared.FanSampler{
+				Interval: fan.DefaultInterval,
+			},
+			DriftWatchdog: shared.DriftWatchdog{
+				Disabled: feats.GetDriftWatchdog().GetDisabled(),
+				Interval: drift.DefaultInterval,
+			},
+			SoftwareFan: shared.SoftwareFan{
+				Enabled:      feats.GetSoftwareFan().GetEnabled(),
+				Target:       feats.GetSoftwareFan().GetTarget(),
+				ThrottlePlan: feats.GetSoftwareFan().GetThrottlePlan(),
+			},
+			CycleProfiles:   feats.GetCycleProfiles(),
+			ReverseCycleKey: feats.GetReverseCycleKey(),
+			Boost:           fromProtocolBoost(feats.GetBoost()),
+		}
+		if err := validReverseCycleKey(newFeatures.ReverseCycleKey); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "Invalid reverse cycle key: %s", err.Error())
+		}
+		batteryRules, err := fromProtocolBatteryRules(feats.GetAutoThermal().GetBatteryRules())
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "Invalid battery rule: %s", err.Error())
+		}
+		newFeatures.AutoThermal.BatteryRules = batteryRules
+		if interval := feats.GetFanSampler().GetInterval(); interval > 0 {
+			newFeatures.FanSampler.Interval = time.Duration(interval) * time.Millisecond
+		}
+		if interval := feats.GetDriftWatchdog().GetInterval(); interval > 0 {
+			newFeatures.DriftWatchdog.Interval = time.Duration(interval) * time.Millisecond
+		}
+		if newFeatures.DriftWatchdog.Interval < drift.MinimumInterval {
+			return nil, status.Errorf(codes.InvalidArgument, "Invalid drift watchdog: interval must be at least %s", drift.MinimumInterval)
+		}
+		if err := thermal.ValidateSoftwareFan(newFeatures.SoftwareFan); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "Invalid software fan control: %s", err.Error())
+		}
+		schedules, err := fromProtocolSchedules(feats.GetSchedules())
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "Invalid schedule: %s", err.Error())
+		}
+		newFeatures.Schedules = schedules
+		for _, r := range feats.GetProcessRules() {
+			newFeatures.ProcessRules = append(newFeatures.ProcessRules, shared.ProcessRule{
+				Executable: r.GetExecutable(),
+				Profile:    r.GetProfile(),
+			})
 		}
 	}
 
@@ -159,45 +228,76 @@ func (f *ConfigListServer) Set(ctx context.Context, req *protocol.SetConfigsRequ
 				return nil, fmt.Errorf("Unrecognized throttle plan in profile")
 			}
 			profile := thermal.Profile{
+				ID:               p.GetID(),
 				Name:             p.GetName(),
 				ThrottlePlan:     val,
 				WindowsPowerPlan: p.GetWindowsPowerPlan(),
+				OnEnter:          fromProtocolHooks(p.GetOnEnter()),
+				OnExit:           fromProtocolHooks(p.GetOnExit()),
+			}
+			if err := thermal.ValidateHooks(profile); err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "Profile %s: %s", p.GetName(), err.Error())
 			}
 			if p.GetCPUFanCurve() != "" {
-				profile.CPUFanCurve, err = thermal.NewFanTable(p.GetCPUFanCurve())
+				profile.CPUFanCurve, err = thermal.ParseFanTable(p.GetCPUFanCurve(), f.floor)
 				if err != nil {
-					return nil, fmt.Errorf("CPU fan curve parse error: %s", err.Error())
+					return nil, status.Errorf(codes.InvalidArgument, "Profile %s: CPU %s", p.GetName(), err.Error())
 				}
 			}
 			if p.GetGPUFanCurve() != "" {
-				profile.GPUFanCurve, err = thermal.NewFanTable(p.GetGPUFanCurve())
+				profile.GPUFanCurve, err = thermal.ParseFanTable(p.GetGPUFanCurve(), f.floor)
 				if err != nil {
-					return nil, fmt.Errorf("GPU fan curve parse error: %s", err.Error())
+					return nil, status.Errorf(codes.InvalidArgument, "Profile %s: GPU %s", p.GetName(), err.Error())
 				}
 			}
 			newProfiles = append(newProfiles, profile)
 		}
-	}
-
-	if newFeatures != nil && newFeatures.AutoThermal.Enabled && len(newProfiles) > 0 {
-		var validPluggedInProfile bool
-		var validUnpluggedProfile bool
-		for _, p := range newProfiles {
-			if p.Name == newFeatures.AutoThermal.PluggedIn {
-				validPluggedInProfile = true
-			}
-			if p.Name == newFeatures.AutoThermal.Unplugged {
-				validUnpluggedProfile = true
+		// keep the IDs of existing profiles, so references to them still resolve
+		newProfiles = thermal.AssignIDs(newProfiles, f.profiles)
+		if !req.GetAllowCommands() {
+			if err := thermal.ValidateCommandHooks(newProfiles, f.profiles); err != nil {
+				return nil, status.Errorf(codes.PermissionDenied, "Invalid profiles: %s", err.Error())
 			}
 		}
-		if !validPluggedInProfile || !validUnpluggedProfile {
-			return nil, fmt.Errorf("AutoThermal must specify a valid profile if enabled")
+		if err := thermal.ValidateProfiles(newProfiles); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "Invalid profiles: %s", err.Error())
 		}
 	}
 
+	if newFeatures != nil && len(newProfiles) > 0 && !validAutoThermal(newFeatures.AutoThermal, newProfiles) {
+		return nil, fmt.Errorf("AutoThermal must specify a valid profile if enabled")
+	}
+
+	checkFeatures, checkProfiles := f.features, f.profiles
+	if newFeatures != nil {
+		checkFeatures = *newFeatures
+	}
+	if len(newProfiles) > 0 {
+		checkProfiles = newProfiles
+	}
+	if err := validSchedules(checkFeatures.Schedules, checkProfiles); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid schedule: %s", err.Error())
+	}
+	if err := validProcessRules(checkFeatures.ProcessRules, checkProfiles); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid process rule: %s", err.Error())
+	}
+	if err := validBatteryRules(checkFeatures.AutoThermal.BatteryRules, checkProfiles); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid battery rule: %s", err.Error())
+	}
+	if err := thermal.ValidateCycleProfiles(checkFeatures.CycleProfiles, checkProfiles); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid cycle list: %s", err.Error())
+	}
+	if err := thermal.ValidateBoost(checkFeatures.Boost, checkProfiles, checkFeatures.RogRemap); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid boost: %s", err.Error())
+	}
+
 	if newFeatures != nil {
+		resolved, err := thermal.ResolveFeatures(*newFeatures, checkProfiles)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "Invalid features: %s", err.Error())
+		}
 		fmt.Println("[gRPCServer] updating features config")
-		f.features = *newFeatures
+		f.features = resolved
 	}
 	if len(newProfiles) > 0 {
 		fmt.Println("[gRPCServer] updating profiles config")
@@ -209,9 +309,334 @@ func (f *ConfigListServer) Set(ctx context.Context, req *protocol.SetConfigsRequ
 	return &protocol.SetConfigsResponse{
 		Success: true,
 		Configs: req.GetConfigs(),
+		Message: thermal.ResampleReport(newProfiles),
+	}, nil
+}
+
+// ExportProfiles returns the current profiles in JSON or YAML
+func (f *ConfigListServer) ExportProfiles(ctx context.Context, req *protocol.ExportProfilesRequest) (*protocol.ExportProfilesResponse, error) {
+	if req == nil {
+		return nil, fmt.Errorf("nil request is invalid")
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	b, err := thermal.ExportProfiles(f.profiles, thermal.Format(req.GetFormat()))
+	if err != nil {
+		return &protocol.ExportProfilesResponse{
+			Success: false,
+			Message: err.Error(),
+		}, nil
+	}
+	return &protocol.ExportProfilesResponse{
+		Success: true,
+		Data:    b,
 	}, nil
 }
 
+// ImportProfiles replaces the current profiles with the imported ones (or only those with the same name
+// if Merge is set), and announces the updated profiles. Command hooks are removed unless AllowCommands is set,
+// and nothing is saved if DryRun is set, so the client can show the hooks before importing
+func (f *ConfigListServer) ImportProfiles(ctx context.Context, req *protocol.ImportProfilesRequest) (*protocol.ImportProfilesResponse, error) {
+	if req == nil {
+		return nil, fmt.Errorf("nil request is invalid")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	imported, err := thermal.ImportProfiles(req.GetData(), thermal.Format(req.GetFormat()), f.floor)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Cannot import profiles: %s", err.Error())
+	}
+	var report []string
+	if !req.GetAllowCommands() {
+		imported, report = thermal.StripCommandHooks(imported)
+	}
+	if resampled := thermal.ResampleReport(imported); resampled != "" {
+		report = append(report, resampled)
+	}
+
+	newProfiles := thermal.AssignIDs(imported, f.profiles)
+	if req.GetMerge() {
+		newProfiles = make([]thermal.Profile, len(f.profiles))
+		copy(newProfiles, f.profiles)
+	next:
+		for _, p := range imported {
+			// by ID if the file has one, otherwise by name
+			i := thermal.FindProfile(newProfiles, p.ID)
+			if p.ID == "" {
+				i = thermal.FindProfileByName(newProfiles, p.Name)
+			}
+			if i >= 0 {
+				p.ID = newProfiles[i].ID
+				newProfiles[i] = p
+				continue next
+			}
+			newProfiles = append(newProfiles, p)
+		}
+		newProfiles = thermal.AssignIDs(newProfiles, f.profiles)
+	}
+	if err := thermal.ValidateProfiles(newProfiles); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Cannot import profiles: %s", err.Error())
+	}
+
+	if !validAutoThermal(f.features.AutoThermal, newProfiles) {
+		return nil, status.Errorf(codes.FailedPrecondition, "Imported profiles must include the profiles of AutoThermal: %s and %s",
+			f.features.AutoThermal.PluggedIn, f.features.AutoThermal.Unplugged)
+	}
+	if err := validSchedules(f.features.Schedules, newProfiles); err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "Imported profiles must include the profiles of schedules: %s", err.Error())
+	}
+	if err := validProcessRules(f.features.ProcessRules, newProfiles); err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "Imported profiles must include the profiles of process rules: %s", err.Error())
+	}
+	if err := validBatteryRules(f.features.AutoThermal.BatteryRules, newProfiles); err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "Imported profiles must include the profiles of battery rules: %s", err.Error())
+	}
+	if err := thermal.ValidateCycleProfiles(f.features.CycleProfiles, newProfiles); err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "Imported profiles must include the profiles of the cycle list: %s", err.Error())
+	}
+	if err := thermal.ValidateBoost(f.features.Boost, newProfiles, f.features.RogRemap); err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "Imported profiles must include the profile of the boost: %s", err.Error())
+	}
+
+	if !req.GetDryRun() {
+		log.Printf("[gRPCServer] imported %d profile(s)\n", len(imported))
+		f.profiles = newProfiles
+		f.announceConfigs()
+	}
+
+	return &protocol.ImportProfilesResponse{
+		Success:  true,
+		Profiles: toProtocolProfiles(newProfiles),
+		Message:  strings.Join(report, "; "),
+	}, nil
+}
+
+// UpdateProfile replaces the profile with the same ID, and announces the updated profiles
+func (f *ConfigListServer) UpdateProfile(profile thermal.Profile) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, p := range f.profiles {
+		if p.ID != profile.ID {
+			continue
+		}
+		profiles := make([]thermal.Profile, len(f.profiles))
+		copy(profiles, f.profiles)
+		profiles[i] = profile
+		f.profiles = profiles
+
+		log.Printf("[gRPCServer] updating profile \"%s\"\n", profile.Name)
+		f.announceConfigs()
+		return nil
+	}
+
+	return fmt.Errorf("Cannot find profile %s (%s)", profile.Name, profile.ID)
+}
+
+func validSchedules(schedules []shared.Schedule, profiles []thermal.Profile) error {
+	for _, s := range schedules {
+		if err := thermal.ValidateSchedule(s, profiles); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validProcessRules(rules []shared.ProcessRule, profiles []thermal.Profile) error {
+	for _, r := range rules {
+		if err := thermal.ValidateProcessRule(r, profiles); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validReverseCycleKey(name string) error {
+	if name == "" {
+		return nil
+	}
+	code, ok := keyboard.KeyNames[name]
+	if !ok {
+		return fmt.Errorf("unknown key %s", name)
+	}
+	if code == keyboard.KeyFnF5 {
+		return fmt.Errorf("%s already cycles forward", name)
+	}
+	return nil
+}
+
+func validBatteryRules(rules []shared.BatteryRule, profiles []thermal.Profile) error {
+	for _, r := range rules {
+		if err := thermal.ValidateBatteryRule(r, profiles); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func fromProtocolBatteryRules(rules []*protocol.BatteryRule) ([]shared.BatteryRule, error) {
+	result := make([]shared.BatteryRule, 0, len(rules))
+	for _, r := range rules {
+		if r.GetBelow() > 100 {
+			return nil, fmt.Errorf("threshold %d%% is above 100%%", r.GetBelow())
+		}
+		result = append(result, shared.BatteryRule{
+			Below:   uint8(r.GetBelow()),
+			Profile: r.GetProfile(),
+		})
+	}
+	return result, nil
+}
+
+func toProtocolBatteryRules(rules []shared.BatteryRule) []*protocol.BatteryRule {
+	result := make([]*protocol.BatteryRule, 0, len(rules))
+	for _, r := range rules {
+		result = append(result, &protocol.BatteryRule{
+			Below:   uint32(r.Below),
+			Profile: r.Profile,
+		})
+	}
+	return result
+}
+
+func toProtocolProcessRules(rules []shared.ProcessRule) []*protocol.ProcessRule {
+	result := make([]*protocol.ProcessRule, 0, len(rules))
+	for _, r := range rules {
+		result = append(result, &protocol.ProcessRule{
+			Executable: r.Executable,
+			Profile:    r.Profile,
+		})
+	}
+	return result
+}
+
+func fromProtocolSchedules(schedules []*protocol.Schedule) ([]shared.Schedule, error) {
+	result := make([]shared.Schedule, 0, len(schedules))
+	for _, s := range schedules {
+		start, err := thermal.ParseTimeOfDay(s.GetStart())
+		if err != nil {
+			return nil, err
+		}
+		end, err := thermal.ParseTimeOfDay(s.GetEnd())
+		if err != nil {
+			return nil, err
+		}
+		days := make([]time.Weekday, 0, len(s.GetDays()))
+		for _, d := range s.GetDays() {
+			if d > uint32(time.Saturday) {
+				return nil, fmt.Errorf("invalid day of week %d", d)
+			}
+			days = append(days, time.Weekday(d))
+		}
+		result = append(result, shared.Schedule{
+			Profile:  s.GetProfile(),
+			Days:     days,
+			Start:    start,
+			End:      end,
+			Priority: int(s.GetPriority()),
+		})
+	}
+	return result, nil
+}
+
+func toProtocolSchedules(schedules []shared.Schedule) []*protocol.Schedule {
+	result := make([]*protocol.Schedule, 0, len(schedules))
+	for _, s := range schedules {
+		days := make([]uint32, 0, len(s.Days))
+		for _, d := range s.Days {
+			days = append(days, uint32(d))
+		}
+		result = append(result, &protocol.Schedule{
+			Profile:  s.Profile,
+			Days:     days,
+			Start:    thermal.FormatTimeOfDay(s.Start),
+			End:      thermal.FormatTimeOfDay(s.End),
+			Priority: int32(s.Priority),
+		})
+	}
+	return result
+}
+
+func validAutoThermal(auto shared.AutoThermal, profiles []thermal.Profile) bool {
+	if !auto.Enabled {
+		return true
+	}
+	validPluggedInProfile := thermal.ResolveProfile(profiles, auto.PluggedIn) >= 0
+	validUnpluggedProfile := thermal.ResolveProfile(profiles, auto.Unplugged) >= 0
+	// per charger type profiles are optional
+	validBarrelProfile := auto.Barrel == "" || thermal.ResolveProfile(profiles, auto.Barrel) >= 0
+	validUSBCPDProfile := auto.USBCPD == "" || thermal.ResolveProfile(profiles, auto.USBCPD) >= 0
+	return validPluggedInProfile && validUnpluggedProfile && validBarrelProfile && validUSBCPDProfile
+}
+
+func fromProtocolBoost(b *protocol.Boost) shared.Boost {
+	return shared.Boost{
+		Profile:       b.GetProfile(),
+		Duration:      time.Duration(b.GetMinutes()) * time.Minute,
+		RogKeyPresses: int(b.GetRogKeyPresses()),
+	}
+}
+
+func toProtocolBoost(b shared.Boost) *protocol.Boost {
+	return &protocol.Boost{
+		Profile:       b.Profile,
+		Minutes:       uint32(b.Duration / time.Minute),
+		RogKeyPresses: uint32(b.RogKeyPresses),
+	}
+}
+
+func toProtocolProfiles(profiles []thermal.Profile) []*protocol.Profile {
+	converted := make([]*protocol.Profile, 0, len(profiles))
+	for _, p := range profiles {
+		var val protocol.Profile_ThrottleValue
+		switch p.ThrottlePlan {
+		case thermal.ThrottlePlanPerformance:
+			val = protocol.Profile_PERFORMANCE
+		case thermal.ThrottlePlanSilent:
+			val = protocol.Profile_SILENT
+		case thermal.ThrottlePlanTurbo:
+			val = protocol.Profile_TURBO
+		}
+		converted = append(converted, &protocol.Profile{
+			ID:               p.ID,
+			Name:             p.Name,
+			WindowsPowerPlan: p.WindowsPowerPlan,
+			ThrottlePlan:     val,
+			CPUFanCurve:      p.CPUFanCurve.String(),
+			GPUFanCurve:      p.GPUFanCurve.String(),
+			OnEnter:          toProtocolHooks(p.OnEnter),
+			OnExit:           toProtocolHooks(p.OnExit),
+		})
+	}
+	return converted
+}
+
+func toProtocolHooks(hooks []plugin.Hook) []*protocol.Hook {
+	converted := make([]*protocol.Hook, 0, len(hooks))
+	for _, h := range hooks {
+		converted = append(converted, &protocol.Hook{
+			Action: string(h.Action),
+			Value:  h.Value,
+		})
+	}
+	return converted
+}
+
+func fromProtocolHooks(hooks []*protocol.Hook) []plugin.Hook {
+	converted := make([]plugin.Hook, 0, len(hooks))
+	for _, h := range hooks {
+		converted = append(converted, plugin.Hook{
+			Action: plugin.HookAction(h.GetAction()),
+			Value:  h.GetValue(),
+		})
+	}
+	return converted
+}
+
 func (f *ConfigListServer) announceConfigs() {
 	featsUpdate := announcement.Update{
 		Type:   announcement.FeaturesUpdate,
@@ -282,8 +707,13 @@ func (f *ConfigListServer) Load(v []byte) error {
 			return
 		}
 
-		f.features = p.Features
-		f.profiles = p.Profiles
+		// values saved before profiles had IDs refer to profiles by name
+		f.profiles = thermal.AssignIDs(p.Profiles, f.profiles)
+		features, err := thermal.ResolveFeatures(p.Features, f.profiles)
+		if err != nil {
+			log.Printf("[gRPCServer] saved features are inconsistent with the saved profiles: %s\n", err)
+		}
+		f.features = features
 
 		f.announceConfigs()
 	})
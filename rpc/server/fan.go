@@ -0,0 +1,92 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/zllovesuki/G14Manager/rpc/protocol"
+	"github.com/zllovesuki/G14Manager/system/fan"
+
+	empty "github.com/golang/protobuf/ptypes/empty"
+	"google.golang.org/grpc"
+)
+
+type FanServer struct {
+	protocol.UnimplementedFanSpeedServer
+
+	mu      sync.RWMutex
+	sampler *fan.Sampler
+}
+
+var _ protocol.FanSpeedServer = &FanServer{}
+
+func RegisterFanServer(s *grpc.Server, sampler *fan.Sampler) *FanServer {
+	server := &FanServer{
+		sampler: sampler,
+	}
+	protocol.RegisterFanSpeedServer(s, server)
+	return server
+}
+
+func (f *FanServer) GetCurrentSpeed(ctx context.Context, _ *empty.Empty) (*protocol.FanSpeedResponse, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.sampler == nil {
+		return nil, fmt.Errorf("fan server is not initialized")
+	}
+
+	sample, ok := f.sampler.Current()
+	if !ok {
+		return &protocol.FanSpeedResponse{
+			Success: false,
+			Message: "Fan speed is not available yet",
+		}, nil
+	}
+
+	return &protocol.FanSpeedResponse{
+		Success: true,
+		Sample:  toProtoFanSample(sample),
+	}, nil
+}
+
+func (f *FanServer) GetHistory(ctx context.Context, _ *empty.Empty) (*protocol.FanSpeedHistoryResponse, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.sampler == nil {
+		return nil, fmt.Errorf("fan server is not initialized")
+	}
+
+	history := f.sampler.History()
+	samples := make([]*protocol.FanSpeedSample, 0, len(history))
+	for _, s := range history {
+		samples = append(samples, toProtoFanSample(s))
+	}
+
+	return &protocol.FanSpeedHistoryResponse{
+		Success:  true,
+		Samples:  samples,
+		Interval: uint32(f.sampler.Interval() / time.Millisecond),
+	}, nil
+}
+
+func (f *FanServer) HotReload(sampler *fan.Sampler) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	log.Println("[gRPCServer] hot reloading fan server")
+
+	f.sampler = sampler
+}
+
+func toProtoFanSample(s fan.Sample) *protocol.FanSpeedSample {
+	return &protocol.FanSpeedSample{
+		Timestamp: s.Time.UnixNano() / int64(time.Millisecond),
+		CPU:       s.CPU,
+		GPU:       s.GPU,
+	}
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/zllovesuki/G14Manager/rpc/protocol"
+	"github.com/zllovesuki/G14Manager/system/setup"
+	"github.com/zllovesuki/G14Manager/system/shared"
+	"github.com/zllovesuki/G14Manager/system/thermal"
+
+	empty "github.com/golang/protobuf/ptypes/empty"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type SetupServer struct {
+	protocol.UnimplementedSetupsServer
+
+	mu      sync.RWMutex
+	manager *setup.Manager
+	thermal *thermal.Control
+}
+
+var _ protocol.SetupsServer = &SetupServer{}
+
+// RegisterSetupServer registers the server. Thermal profiles of setups are resolved against the profiles of the thermal control
+func RegisterSetupServer(s *grpc.Server, mgr *setup.Manager, ctrl *thermal.Control) *SetupServer {
+	server := &SetupServer{
+		manager: mgr,
+		thermal: ctrl,
+	}
+	protocol.RegisterSetupsServer(s, server)
+	return server
+}
+
+func (m *SetupServer) List(ctx context.Context, _ *empty.Empty) (*protocol.SetupsResponse, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.manager == nil {
+		return nil, fmt.Errorf("setup server is not initialized")
+	}
+
+	return m.setupsResponse(), nil
+}
+
+func (m *SetupServer) Apply(ctx context.Context, req *protocol.SetupRequest) (*protocol.SetupResponse, error) {
+	if req == nil {
+		return nil, fmt.Errorf("nil request is invalid")
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.manager == nil {
+		return nil, fmt.Errorf("setup server is not initialized")
+	}
+
+	s, err := m.manager.SwitchToSetup(req.GetID())
+	if err != nil {
+		resp := &protocol.SetupResponse{
+			Success: false,
+			Message: err.Error(),
+		}
+		var applyErr *setup.ApplyError
+		if errors.As(err, &applyErr) {
+			resp.Setup = toProtocolSetup(s)
+			resp.FailedDevice = applyErr.Device
+			resp.RolledBack = applyErr.RolledBack
+		}
+		return resp, nil
+	}
+
+	return &protocol.SetupResponse{
+		Success: true,
+		Setup:   toProtocolSetup(s),
+	}, nil
+}
+
+func (m *SetupServer) Save(ctx context.Context, req *protocol.Setup) (*protocol.SetupResponse, error) {
+	if req == nil {
+		return nil, fmt.Errorf("nil request is invalid")
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.manager == nil {
+		return nil, fmt.Errorf("setup server is not initialized")
+	}
+
+	if req.GetChargeLimit() > 100 {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid setup: charge limit must be between 40 and 100, got %d", req.GetChargeLimit())
+	}
+	s := fromProtocolSetup(req)
+	if err := setup.Validate(s); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid setup: %s", err.Error())
+	}
+	if s.ThermalProfile != "" && m.thermal != nil {
+		// setups refer to profiles by ID, so renaming a profile does not break the setup
+		profiles := m.thermal.Profiles()
+		index := thermal.ResolveProfile(profiles, s.ThermalProfile)
+		if index < 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "Invalid setup: profile %s is not found", s.ThermalProfile)
+		}
+		s.ThermalProfile = profiles[index].ID
+	}
+
+	saved, err := m.manager.Save(s)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid setup: %s", err.Error())
+	}
+
+	return &protocol.SetupResponse{
+		Success: true,
+		Setup:   toProtocolSetup(saved),
+	}, nil
+}
+
+func (m *SetupServer) Delete(ctx context.Context, req *protocol.SetupRequest) (*protocol.SetupsResponse, error) {
+	if req == nil {
+		return nil, fmt.Errorf("nil request is invalid")
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.manager == nil {
+		return nil, fmt.Errorf("setup server is not initialized")
+	}
+
+	if err := m.manager.Delete(req.GetID()); err != nil {
+		return nil, status.Errorf(codes.NotFound, "%s", err.Error())
+	}
+
+	return m.setupsResponse(), nil
+}
+
+func (m *SetupServer) HotReload(mgr *setup.Manager, ctrl *thermal.Control) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	log.Println("[gRPCServer] hot reloading setup server")
+
+	m.manager = mgr
+	m.thermal = ctrl
+}
+
+func (m *SetupServer) setupsResponse() *protocol.SetupsResponse {
+	setups := m.manager.Setups()
+	resp := &protocol.SetupsResponse{
+		Success: true,
+		Setups:  make([]*protocol.Setup, 0, len(setups)),
+	}
+	for _, s := range setups {
+		resp.Setups = append(resp.Setups, toProtocolSetup(s))
+	}
+	if current, ok := m.manager.Current(); ok {
+		resp.Current = current.ID
+	}
+	return resp
+}
+
+func toProtocolSetup(s shared.Setup) *protocol.Setup {
+	return &protocol.Setup{
+		ID:                 s.ID,
+		Name:               s.Name,
+		ThermalProfile:     s.ThermalProfile,
+		ChargeLimit:        uint32(s.ChargeLimit),
+		KeyboardBrightness: s.KeyboardBrightness,
+		RefreshRate:        s.RefreshRate,
+		GPU:                s.GPU,
+		MicMute:            s.MicMute,
+	}
+}
+
+func fromProtocolSetup(s *protocol.Setup) shared.Setup {
+	return shared.Setup{
+		ID:                 s.GetID(),
+		Name:               s.GetName(),
+		ThermalProfile:     s.GetThermalProfile(),
+		ChargeLimit:        uint8(s.GetChargeLimit()),
+		KeyboardBrightness: s.GetKeyboardBrightness(),
+		RefreshRate:        s.GetRefreshRate(),
+		GPU:                s.GetGPU(),
+		MicMute:            s.GetMicMute(),
+	}
+}
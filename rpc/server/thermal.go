@@ -2,29 +2,40 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"sync"
+	"time"
 
 	"github.com/zllovesuki/G14Manager/rpc/protocol"
 	"github.com/zllovesuki/G14Manager/system/thermal"
 
 	empty "github.com/golang/protobuf/ptypes/empty"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// ProfileUpdater persists changes made to a single profile
+type ProfileUpdater interface {
+	UpdateProfile(thermal.Profile) error
+}
+
 type ThermalServer struct {
 	protocol.UnimplementedThermalServer
 
 	mu      sync.RWMutex
 	control *thermal.Control
+	updater ProfileUpdater
 }
 
 var _ protocol.ThermalServer = &ThermalServer{}
 
-func RegisterThermalServer(s *grpc.Server, ctrl *thermal.Control) *ThermalServer {
+func RegisterThermalServer(s *grpc.Server, ctrl *thermal.Control, updater ProfileUpdater) *ThermalServer {
 	server := &ThermalServer{
 		control: ctrl,
+		updater: updater,
 	}
 	protocol.RegisterThermalServer(s, server)
 	return server
@@ -39,12 +50,14 @@ func (t *ThermalServer) GetCurrentProfile(ctx context.Context, _ *empty.Empty) (
 	return &protocol.SetProfileResponse{
 		Success: true,
 		Profile: &protocol.Profile{
+			ID:               current.ID,
 			Name:             current.Name,
 			WindowsPowerPlan: current.WindowsPowerPlan,
 			ThrottlePlan:     toProtoThrottle(current.ThrottlePlan),
 			CPUFanCurve:      current.CPUFanCurve.String(),
 			GPUFanCurve:      current.GPUFanCurve.String(),
 		},
+		Applied: toProtoAppliedState(t.control.AppliedState()),
 	}, nil
 }
 
@@ -58,10 +71,7 @@ func (t *ThermalServer) Set(ctx context.Context, req *protocol.SetProfileRequest
 
 	_, err := t.control.SwitchToProfile(req.GetProfileName())
 	if err != nil {
-		return &protocol.SetProfileResponse{
-			Success: false,
-			Message: err.Error(),
-		}, nil
+		return applyFailure(err, t.control.AppliedState()), nil
 	}
 
 	current := t.control.CurrentProfile()
@@ -69,14 +79,147 @@ func (t *ThermalServer) Set(ctx context.Context, req *protocol.SetProfileRequest
 	return &protocol.SetProfileResponse{
 		Success: true,
 		Profile: &protocol.Profile{
+			ID:               current.ID,
 			Name:             current.Name,
 			WindowsPowerPlan: current.WindowsPowerPlan,
 			ThrottlePlan:     toProtoThrottle(current.ThrottlePlan),
 			CPUFanCurve:      current.CPUFanCurve.String(),
 			GPUFanCurve:      current.GPUFanCurve.String(),
 		},
+		Applied: toProtoAppliedState(t.control.AppliedState()),
+	}, nil
+
+}
+
+func (t *ThermalServer) GetFactoryCurves(ctx context.Context, _ *empty.Empty) (*protocol.FactoryCurvesResponse, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	curves, err := t.control.FactoryCurves()
+	if err != nil {
+		return &protocol.FactoryCurvesResponse{
+			Success: false,
+			Message: err.Error(),
+		}, nil
+	}
+
+	protoCurves := make([]*protocol.FactoryCurve, 0, len(curves))
+	for _, c := range curves {
+		protoCurves = append(protoCurves, &protocol.FactoryCurve{
+			ThrottlePlan: toProtoThrottle(c.ThrottlePlan),
+			CPUFanCurve:  c.CPUFanCurve.String(),
+			GPUFanCurve:  c.GPUFanCurve.String(),
+		})
+	}
+
+	return &protocol.FactoryCurvesResponse{
+		Success: true,
+		Curves:  protoCurves,
+	}, nil
+}
+
+func (t *ThermalServer) ResetToFactory(ctx context.Context, req *protocol.SetProfileRequest) (*protocol.SetProfileResponse, error) {
+	if req == nil {
+		return nil, fmt.Errorf("nil request is invalid")
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	profile, err := t.control.ResetProfileToFactory(req.GetProfileName())
+	if err != nil {
+		return applyFailure(err, t.control.AppliedState()), nil
+	}
+
+	if t.updater != nil {
+		if err := t.updater.UpdateProfile(profile); err != nil {
+			return &protocol.SetProfileResponse{
+				Success: false,
+				Message: err.Error(),
+			}, nil
+		}
+	}
+
+	return &protocol.SetProfileResponse{
+		Success: true,
+		Profile: &protocol.Profile{
+			ID:               profile.ID,
+			Name:             profile.Name,
+			WindowsPowerPlan: profile.WindowsPowerPlan,
+			ThrottlePlan:     toProtoThrottle(profile.ThrottlePlan),
+			CPUFanCurve:      profile.CPUFanCurve.String(),
+			GPUFanCurve:      profile.GPUFanCurve.String(),
+		},
 	}, nil
+}
+
+func (t *ThermalServer) GetBoost(ctx context.Context, _ *empty.Empty) (*protocol.BoostResponse, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 
+	return t.boostResponse(), nil
+}
+
+func (t *ThermalServer) Boost(ctx context.Context, req *protocol.BoostRequest) (*protocol.BoostResponse, error) {
+	if req == nil {
+		return nil, fmt.Errorf("nil request is invalid")
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	duration := time.Duration(req.GetMinutes()) * time.Minute
+	if duration > thermal.MaximumBoostDuration {
+		return nil, status.Errorf(codes.InvalidArgument, "Boost must not be longer than %s", thermal.MaximumBoostDuration)
+	}
+
+	if _, err := t.control.StartBoost(req.GetProfileName(), duration); err != nil {
+		return &protocol.BoostResponse{
+			Success: false,
+			Message: err.Error(),
+		}, nil
+	}
+
+	return t.boostResponse(), nil
+}
+
+func (t *ThermalServer) CancelBoost(ctx context.Context, _ *empty.Empty) (*protocol.BoostResponse, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, err := t.control.CancelBoost(); err != nil {
+		resp := t.boostResponse()
+		resp.Success = false
+		resp.Message = err.Error()
+		return resp, nil
+	}
+
+	return t.boostResponse(), nil
+}
+
+// boostResponse returns the active boost (if any), and the current profile
+func (t *ThermalServer) boostResponse() *protocol.BoostResponse {
+	current := t.control.CurrentProfile()
+	resp := &protocol.BoostResponse{
+		Success: true,
+		Profile: &protocol.Profile{
+			ID:               current.ID,
+			Name:             current.Name,
+			WindowsPowerPlan: current.WindowsPowerPlan,
+			ThrottlePlan:     toProtoThrottle(current.ThrottlePlan),
+			CPUFanCurve:      current.CPUFanCurve.String(),
+			GPUFanCurve:      current.GPUFanCurve.String(),
+		},
+	}
+	if boost, ok := t.control.CurrentBoost(); ok {
+		resp.Active = true
+		resp.Previous = boost.Previous
+		resp.Until = boost.Until.UnixNano() / int64(time.Millisecond)
+		if left := time.Until(boost.Until); left > 0 {
+			resp.MinutesLeft = uint32((left + time.Minute - 1) / time.Minute)
+		}
+	}
+	return resp
 }
 
 func (t *ThermalServer) HotReload(ctrl *thermal.Control) {
@@ -100,3 +243,35 @@ func toProtoThrottle(v uint32) protocol.Profile_ThrottleValue {
 	}
 	return val
 }
+
+func toProtoAppliedState(s thermal.AppliedState) *protocol.AppliedState {
+	var readBackErr string
+	if s.Err != nil {
+		readBackErr = s.Err.Error()
+	}
+	return &protocol.AppliedState{
+		// the values of the throttle plans are the values of the firmware, including unknown plans
+		ThrottlePlan:         protocol.Profile_ThrottleValue(s.ThrottlePlan),
+		ThrottlePlanReadBack: protocol.ReadBack(s.ThrottlePlanState),
+		CPUFanCurve:          s.CPUFanCurve.Curve.String(),
+		CPUFanCurveReadBack:  protocol.ReadBack(s.CPUFanCurve.State),
+		GPUFanCurve:          s.GPUFanCurve.Curve.String(),
+		GPUFanCurveReadBack:  protocol.ReadBack(s.GPUFanCurve.State),
+		ReadBackError:        readBackErr,
+	}
+}
+
+// applyFailure reports the failed step if the profile could not be applied, and what the firmware reported afterward
+func applyFailure(err error, applied thermal.AppliedState) *protocol.SetProfileResponse {
+	resp := &protocol.SetProfileResponse{
+		Success: false,
+		Message: err.Error(),
+		Applied: toProtoAppliedState(applied),
+	}
+	var applyErr *thermal.ApplyError
+	if errors.As(err, &applyErr) {
+		resp.FailedStep = protocol.ApplyStep(applyErr.Step)
+		resp.RolledBack = applyErr.RolledBack
+	}
+	return resp
+}
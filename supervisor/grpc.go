@@ -11,6 +11,7 @@ import (
 	"github.com/zllovesuki/G14Manager/controller"
 	"github.com/zllovesuki/G14Manager/rpc/server"
 	"github.com/zllovesuki/G14Manager/system/shared"
+	"github.com/zllovesuki/G14Manager/system/thermal"
 
 	"google.golang.org/grpc"
 )
@@ -21,6 +22,9 @@ type servers struct {
 	Thermal  *server.ThermalServer
 	Manager  *server.ManagerServer
 	Configs  *server.ConfigListServer
+	Fan      *server.FanServer
+	Caps     *server.CapabilityServer
+	Setups   *server.SetupServer
 }
 
 type Server struct {
@@ -32,6 +36,8 @@ type Server struct {
 type GRPCRunConfig struct {
 	ManagerReqCh chan server.ManagerSupervisorRequest
 	Dependencies *controller.Dependencies
+	// FanSafetyFloor is enforced on fan curves set via ConfigList. The zero value disables the check
+	FanSafetyFloor thermal.SafetyFloor
 }
 
 func NewGRPCServer(conf GRPCRunConfig) (*Server, error) {
@@ -43,15 +49,19 @@ func NewGRPCServer(conf GRPCRunConfig) (*Server, error) {
 	}
 
 	s := grpc.NewServer()
+	configs := server.RegisterConfigListServer(s, conf.Dependencies.Updatable, conf.Dependencies.Thermal.Profiles(), conf.FanSafetyFloor)
 
 	server := &Server{
 		server: s,
 		servers: servers{
 			Keyboard: server.RegisterKeyboardServer(s, conf.Dependencies.Keyboard),
 			Battery:  server.RegisterBatteryChargeLimitServer(s, conf.Dependencies.Battery),
-			Thermal:  server.RegisterThermalServer(s, conf.Dependencies.Thermal),
-			Configs:  server.RegisterConfigListServer(s, conf.Dependencies.Updatable),
+			Thermal:  server.RegisterThermalServer(s, conf.Dependencies.Thermal, configs),
+			Configs:  configs,
 			Manager:  server.RegisterManagerServer(s, conf.ManagerReqCh),
+			Fan:      server.RegisterFanServer(s, conf.Dependencies.FanSampler),
+			Caps:     server.RegisterCapabilityServer(s, conf.Dependencies.Capabilities),
+			Setups:   server.RegisterSetupServer(s, conf.Dependencies.Setups, conf.Dependencies.Thermal),
 		},
 		dep: conf.Dependencies,
 	}
@@ -91,6 +101,9 @@ func (s *Server) hotReload(dep *controller.Dependencies) {
 	s.servers.Keyboard.HotReload(dep.Keyboard)
 	s.servers.Thermal.HotReload(dep.Thermal)
 	s.servers.Configs.HotReload(dep.Updatable)
+	s.servers.Fan.HotReload(dep.FanSampler)
+	s.servers.Caps.HotReload(dep.Capabilities)
+	s.servers.Setups.HotReload(dep.Setups, dep.Thermal)
 	dep.ConfigRegistry.Register(s.servers.Configs)
 	dep.ConfigRegistry.Register(s.servers.Manager)
 }
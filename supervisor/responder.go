@@ -122,6 +122,9 @@ func (m *ManagerResponder) doStartController(s server.ManagerSupervisorRequest)
 
 	controllerSupervisor := suture.New("controllerSupervisor", suture.Spec{})
 	controllerSupervisor.Add(control)
+	// only reapply hardware state while the controller is running
+	controllerSupervisor.Add(m.Dependencies.DriftWatchdog)
+	controllerSupervisor.Add(m.Dependencies.SoftwareFan)
 	m.childToken = m.supervisor.Add(controllerSupervisor)
 
 	select {
@@ -0,0 +1,130 @@
+package atkacpi
+
+import (
+	"log"
+)
+
+type probeMethod int
+
+const (
+	// device is supported if DSTS sets the presence bit
+	probePresence probeMethod = iota
+	// device is supported if DSTS does not return unsupported. Used when the value may not have presence bit set (e.g. charger unplugged)
+	probeStatus
+	// device is supported if DSTS returns a fan curve for the default throttle plan
+	probeFanCurve
+)
+
+var knownDevices = []struct {
+	name   string
+	device uint32
+	method probeMethod
+}{
+	{"BatteryChargeLimit", DevsBatteryChargeLimit, probePresence},
+	{"ThrottleCtrl", DevsThrottleCtrl, probePresence},
+	{"CPUFanCurve", DevsCPUFanCurve, probeFanCurve},
+	{"GPUFanCurve", DevsGPUFanCurve, probeFanCurve},
+	{"CPUFanSpeed", DstsCurrentCPUFanSpeed, probePresence},
+	{"GPUFanSpeed", DstsCurrentGPUFanSpeed, probePresence},
+	{"CheckCharger", DstsCheckCharger, probeStatus},
+	{"KeyboardBacklight", DstsKeyboardBacklight, probePresence},
+}
+
+// Prober can be implemented by a WMI if DSTS does not reflect what the backend supports
+type Prober interface {
+	// Probe returns whether the device is supported. ok is false if the WMI defers to DSTS
+	Probe(dev uint32) (supported bool, ok bool)
+}
+
+// Capability describes whether a known device ID is supported by the firmware
+type Capability struct {
+	Name      string
+	Device    uint32
+	Supported bool
+}
+
+// Capabilities maps known device IDs to whether the firmware supports them.
+// Device IDs that were not probed, or a nil Capabilities, are assumed to be supported
+type Capabilities map[uint32]bool
+
+// ProbeCapabilities calls DSTS on each known device ID and returns the capabilities of the firmware
+func ProbeCapabilities(wmi WMI) Capabilities {
+	caps := make(Capabilities)
+	prober, hasProber := wmi.(Prober)
+	for _, d := range knownDevices {
+		var supported, ok bool
+		if hasProber {
+			supported, ok = prober.Probe(d.device)
+		}
+		if !ok {
+			supported = probe(wmi, d.device, d.method)
+		}
+		if !supported {
+			log.Printf("atkacpi: device 0x%08x (%s) is not supported by the firmware\n", d.device, d.name)
+		}
+		caps[d.device] = supported
+	}
+	return caps
+}
+
+// AssumeCapabilities returns Capabilities with every known device ID supported, for when the firmware
+// cannot be probed (e.g. a dry run, where DSTS returns zeros)
+func AssumeCapabilities() Capabilities {
+	caps := make(Capabilities)
+	for _, d := range knownDevices {
+		caps[d.device] = true
+	}
+	return caps
+}
+
+func probe(wmi WMI, dev uint32, method probeMethod) bool {
+	var cmd Command
+	if method == probeFanCurve {
+		// the throttle plan is required as the parameter
+		cmd = DstsGetWithParam(dev, 0)
+	} else {
+		cmd = DstsGet(dev)
+	}
+	resp, err := cmd.Execute(wmi)
+	if err != nil {
+		log.Printf("atkacpi: cannot probe device 0x%08x: %+v\n", dev, err)
+		return false
+	}
+
+	switch method {
+	case probeFanCurve:
+		_, err := resp.FanCurve()
+		return err == nil
+	default:
+		status, err := resp.Status()
+		if err != nil {
+			return false
+		}
+		if method == probeStatus {
+			return !status.Unsupported()
+		}
+		return status.Present()
+	}
+}
+
+// Supports returns whether the device ID is supported
+func (c Capabilities) Supports(dev uint32) bool {
+	if c == nil {
+		return true
+	}
+	supported, ok := c[dev]
+	return !ok || supported
+}
+
+// List returns the capabilities of all known device IDs
+func (c Capabilities) List() []Capability {
+	list := make([]Capability, 0, len(knownDevices))
+	for _, d := range knownDevices {
+		list = append(list, Capability{
+			Name:      d.name,
+			Device:    d.device,
+			Supported: c.Supports(d.device),
+		})
+	}
+	return list
+}
@@ -0,0 +1,47 @@
+package atkacpi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbeCapabilities(t *testing.T) {
+	sim := NewSimulator()
+	// charger status has no presence bit when unplugged
+	sim.SetChargerStatus(ChargerUnplugged)
+
+	caps := ProbeCapabilities(sim)
+	for _, cap := range caps.List() {
+		require.True(t, cap.Supported, cap.Name)
+	}
+
+	sim.SetUnsupported(DevsBatteryChargeLimit, DevsGPUFanCurve)
+
+	caps = ProbeCapabilities(sim)
+	require.False(t, caps.Supports(DevsBatteryChargeLimit))
+	require.False(t, caps.Supports(DevsGPUFanCurve))
+	require.True(t, caps.Supports(DevsCPUFanCurve))
+	require.True(t, caps.Supports(DstsCheckCharger))
+
+	// device IDs that were not probed are assumed to be supported
+	require.True(t, caps.Supports(DevsHardwareCtrl))
+
+	list := caps.List()
+	require.Len(t, list, len(knownDevices))
+	require.Equal(t, "BatteryChargeLimit", list[0].Name)
+	require.False(t, list[0].Supported)
+}
+
+func TestAssumeCapabilities(t *testing.T) {
+	caps := AssumeCapabilities()
+	require.Len(t, caps, len(knownDevices))
+	for _, cap := range caps.List() {
+		require.True(t, cap.Supported, cap.Name)
+	}
+}
+
+func TestNilCapabilities(t *testing.T) {
+	var caps Capabilities
+	require.True(t, caps.Supports(DevsThrottleCtrl))
+}
@@ -0,0 +1,239 @@
+package atkacpi
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Commands are sent to atkwmiacpi64.sys to invoke WMI functions, the control code is IOCTL_ATK_ACPI_WMIFUNCTION.
+// (for adventure of WMI, see reverse_eng/wmi.txt)
+// Unfortunately, DEVS only announces itself having 2 paremeters in WMI (g14-dsdt.dsl),
+// So we cannot control the fan curve via WMI, and have to invoke ACPI method (which we cannot do from userspace).
+// However, atkwmiacpi64.sys will be our bridge to success.
+// The buffer sent to the device is laid out as follows (little endian):
+// 	0-3: method ID (e.g. DEVS)
+// 	4-7: length of arguments in bytes
+// 	8-:  arguments, starting with IIA0 (usually the device ID)
+
+// Defines the status word returned by the embedded controller
+const (
+	StatusFailure     Status = 0x00000000
+	StatusSuccess     Status = 0x00000001
+	StatusUnsupported Status = 0xFFFFFFFE // ASUS_WMI_UNSUPPORTED_METHOD
+	// PresenceBit is set by DSTS if the device exists
+	PresenceBit Status = 0x00010000
+)
+
+const (
+	fanCurveLength      = 16
+	commandHeaderLength = 8
+)
+
+// Command is a WMI method call with its arguments (little endian)
+type Command struct {
+	Method Method
+	Args   []byte
+}
+
+// Init returns the command to initialize ATKD
+func Init() Command {
+	return Command{
+		Method: INIT,
+		Args:   make([]byte, 4), // IIA0, value doesn't matter
+	}
+}
+
+// DevsSet returns the command to set the device to value
+func DevsSet(dev uint32, value uint32) Command {
+	args := make([]byte, 8)
+	binary.LittleEndian.PutUint32(args[0:], dev)
+	binary.LittleEndian.PutUint32(args[4:], value)
+	return Command{
+		Method: DEVS,
+		Args:   args,
+	}
+}
+
+// DstsGet returns the command to get the status of the device
+func DstsGet(dev uint32) Command {
+	args := make([]byte, 4)
+	binary.LittleEndian.PutUint32(args[0:], dev)
+	return Command{
+		Method: DSTS,
+		Args:   args,
+	}
+}
+
+// DstsGetWithParam returns the command to get the status of the device with
+// an additional parameter (e.g. default fan curve of a throttle plan)
+func DstsGetWithParam(dev uint32, param uint32) Command {
+	args := make([]byte, 8)
+	binary.LittleEndian.PutUint32(args[0:], dev)
+	binary.LittleEndian.PutUint32(args[4:], param)
+	return Command{
+		Method: DSTS,
+		Args:   args,
+	}
+}
+
+// SetFanCurve returns the command to set the fan curve of the device (DevsCPUFanCurve or DevsGPUFanCurve).
+// The table must be 8 temperatures followed by 8 fan percentages.
+func SetFanCurve(dev uint32, table []byte) (Command, error) {
+	if dev != DevsCPUFanCurve && dev != DevsGPUFanCurve {
+		return Command{}, fmt.Errorf("device 0x%x is not a fan", dev)
+	}
+	if len(table) != fanCurveLength {
+		return Command{}, fmt.Errorf("fan curve must be %d bytes, got %d", fanCurveLength, len(table))
+	}
+	// PCI0.SBRG.EC0.SUFC (IIA1, IIA2, IIA3, IIA4, 0x40/0x44)
+	// (Set User Fan Curve)
+	args := make([]byte, 4+fanCurveLength)
+	binary.LittleEndian.PutUint32(args[0:], dev)
+	copy(args[4:], table)
+	return Command{
+		Method: DEVS,
+		Args:   args,
+	}, nil
+}
+
+// Bytes returns the buffer to be sent to atkwmiacpi64.sys
+func (c Command) Bytes() []byte {
+	buf := make([]byte, commandHeaderLength+len(c.Args))
+	binary.LittleEndian.PutUint32(buf[0:], uint32(c.Method))
+	binary.LittleEndian.PutUint32(buf[4:], uint32(len(c.Args)))
+	copy(buf[commandHeaderLength:], c.Args)
+	return buf
+}
+
+// ParseCommand is the inverse of Command.Bytes()
+func ParseCommand(buf []byte) (Command, error) {
+	if len(buf) < commandHeaderLength+4 {
+		return Command{}, fmt.Errorf("buffer should be at least %d bytes, got %d", commandHeaderLength+4, len(buf))
+	}
+	argsLength := binary.LittleEndian.Uint32(buf[4:])
+	if int(argsLength) != len(buf)-commandHeaderLength {
+		return Command{}, fmt.Errorf("buffer declares %d bytes of arguments, got %d", argsLength, len(buf)-commandHeaderLength)
+	}
+	args := make([]byte, argsLength)
+	copy(args, buf[commandHeaderLength:])
+	return Command{
+		Method: Method(binary.LittleEndian.Uint32(buf[0:])),
+		Args:   args,
+	}, nil
+}
+
+// Device returns the device ID (IIA0) of the command
+func (c Command) Device() uint32 {
+	if len(c.Args) < 4 {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(c.Args[0:])
+}
+
+// Execute evaluates the command with the given WMI
+func (c Command) Execute(wmi WMI) (Response, error) {
+	if len(c.Args) < 4 {
+		return nil, fmt.Errorf("args should have at least one parameter")
+	}
+	out, err := wmi.Evaluate(c.Method, c.Args)
+	if err != nil {
+		return nil, err
+	}
+	return Response(out), nil
+}
+
+// Response is the output buffer returned by the embedded controller
+type Response []byte
+
+// Status decodes the status word at the beginning of the response
+func (r Response) Status() (Status, error) {
+	if len(r) < 4 {
+		return 0, fmt.Errorf("response should be at least 4 bytes, got %d", len(r))
+	}
+	return Status(binary.LittleEndian.Uint32(r[0:])), nil
+}
+
+// FanCurve decodes the response of DSTS on DstsDefaultCPUFanCurve/DstsDefaultGPUFanCurve
+func (r Response) FanCurve() ([]byte, error) {
+	if len(r) < fanCurveLength {
+		return nil, fmt.Errorf("fan curve response should be at least %d bytes, got %d", fanCurveLength, len(r))
+	}
+	if status, _ := r.Status(); status.Unsupported() {
+		return nil, fmt.Errorf("fan curve is not supported")
+	}
+	b := make([]byte, fanCurveLength)
+	copy(b, r)
+	return b, nil
+}
+
+// FanSpeed decodes the response of DSTS on DstsCurrentCPUFanSpeed/DstsCurrentGPUFanSpeed into RPM
+func (r Response) FanSpeed() (uint32, error) {
+	status, err := r.Status()
+	if err != nil {
+		return 0, err
+	}
+	if !status.Present() {
+		return 0, fmt.Errorf("fan is not present (status 0x%x)", uint32(status))
+	}
+	// the embedded controller reports RPM in hundreds (see asus-wmi.c)
+	return status.Value() * 100, nil
+}
+
+// ThrottlePlan decodes the response of DSTS on DevsThrottleCtrl into the active throttle plan
+func (r Response) ThrottlePlan() (uint32, error) {
+	status, err := r.Status()
+	if err != nil {
+		return 0, err
+	}
+	if !status.Present() {
+		return 0, fmt.Errorf("throttle plan is not present (status 0x%x)", uint32(status))
+	}
+	return status.Value(), nil
+}
+
+// ChargeLimit decodes the response of DSTS on DevsBatteryChargeLimit into the charge limit in percentage
+func (r Response) ChargeLimit() (uint8, error) {
+	status, err := r.Status()
+	if err != nil {
+		return 0, err
+	}
+	if !status.Present() {
+		return 0, fmt.Errorf("charge limit is not present (status 0x%x)", uint32(status))
+	}
+	return uint8(status.Value()), nil
+}
+
+// KeyboardBrightness decodes the response of DSTS on DstsKeyboardBacklight into the brightness level (see asus-wmi.c)
+func (r Response) KeyboardBrightness() (uint8, error) {
+	status, err := r.Status()
+	if err != nil {
+		return 0, err
+	}
+	if !status.Present() {
+		return 0, fmt.Errorf("keyboard backlight is not present (status 0x%x)", uint32(status))
+	}
+	return uint8(status.Value() & 0x7F), nil
+}
+
+// Status is the status word returned by DSTS or DEVS
+type Status uint32
+
+// Success returns true if DEVS returned success
+func (s Status) Success() bool {
+	return s == StatusSuccess
+}
+
+// Unsupported returns true if the device or method is not supported by the firmware
+func (s Status) Unsupported() bool {
+	return s == StatusUnsupported
+}
+
+// Present returns true if DSTS reports that the device exists
+func (s Status) Present() bool {
+	return !s.Unsupported() && s&PresenceBit != 0
+}
+
+// Value returns the device specific value reported by DSTS (i.e. the lower 16 bits)
+func (s Status) Value() uint32 {
+	return uint32(s) & 0xFFFF
+}
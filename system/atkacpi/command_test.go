@@ -0,0 +1,137 @@
+package atkacpi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommandRoundTrip(t *testing.T) {
+	table := []byte{20, 50, 55, 60, 65, 70, 75, 98, 0, 0, 0, 0, 31, 49, 56, 56}
+	fanCurve, err := SetFanCurve(DevsGPUFanCurve, table)
+	require.NoError(t, err)
+
+	commands := []Command{
+		Init(),
+		DevsSet(DevsThrottleCtrl, 2),
+		DevsSet(DevsBatteryChargeLimit, 60),
+		DstsGet(DstsCheckCharger),
+		DstsGetWithParam(DstsDefaultCPUFanCurve, 1),
+		fanCurve,
+	}
+
+	for _, cmd := range commands {
+		parsed, err := ParseCommand(cmd.Bytes())
+		require.NoError(t, err)
+		require.Equal(t, cmd, parsed)
+	}
+}
+
+func TestCommandEncoding(t *testing.T) {
+	// see g14-dsdt.dsl, DEVS with IIA0 = 0x00120075 and IIA1 = 1
+	expected := []byte{
+		0x44, 0x45, 0x56, 0x53, // DEVS
+		0x08, 0x00, 0x00, 0x00, // 8 bytes of argument
+		0x75, 0x00, 0x12, 0x00, // IIA0
+		0x01, 0x00, 0x00, 0x00, // IIA1
+	}
+	cmd := DevsSet(DevsThrottleCtrl, 1)
+	require.Equal(t, expected, cmd.Bytes())
+	require.Equal(t, DevsThrottleCtrl, cmd.Device())
+	require.Equal(t, "DEVS", cmd.Method.String())
+
+	table := []byte{20, 50, 55, 60, 65, 70, 75, 98, 0, 0, 0, 0, 31, 49, 56, 56}
+	fanCurve, err := SetFanCurve(DevsCPUFanCurve, table)
+	require.NoError(t, err)
+	b := fanCurve.Bytes()
+	require.Len(t, b, 28)
+	require.Equal(t, []byte{0x14, 0x00, 0x00, 0x00}, b[4:8])
+	require.Equal(t, []byte{0x24, 0x00, 0x11, 0x00}, b[8:12])
+	require.Equal(t, table, b[12:])
+}
+
+func TestCommandValidation(t *testing.T) {
+	_, err := SetFanCurve(DevsCPUFanCurve, make([]byte, 15))
+	require.Error(t, err)
+
+	_, err = SetFanCurve(DevsThrottleCtrl, make([]byte, 16))
+	require.Error(t, err)
+
+	_, err = ParseCommand([]byte{0x44, 0x45, 0x56, 0x53, 0x08, 0x00, 0x00, 0x00, 0x75, 0x00, 0x12, 0x00})
+	require.Error(t, err)
+
+	_, err = Command{Method: DSTS}.Execute(NewSimulator())
+	require.Error(t, err)
+}
+
+func TestResponseDecoding(t *testing.T) {
+	status, err := Response{0x02, 0x00, 0x01, 0x00}.Status()
+	require.NoError(t, err)
+	require.True(t, status.Present())
+	require.Equal(t, uint32(2), status.Value())
+	require.False(t, status.Success())
+
+	status, err = Response{0xFE, 0xFF, 0xFF, 0xFF}.Status()
+	require.NoError(t, err)
+	require.True(t, status.Unsupported())
+	require.False(t, status.Present())
+
+	_, err = Response{0x01}.Status()
+	require.Error(t, err)
+
+	_, err = Response(make([]byte, 4)).FanCurve()
+	require.Error(t, err)
+
+	unsupported := make(Response, 16)
+	copy(unsupported, []byte{0xFE, 0xFF, 0xFF, 0xFF})
+	_, err = unsupported.FanCurve()
+	require.Error(t, err)
+
+	rpm, err := Response{0x23, 0x00, 0x01, 0x00}.FanSpeed()
+	require.NoError(t, err)
+	require.Equal(t, uint32(3500), rpm)
+
+	_, err = Response{0x00, 0x00, 0x00, 0x00}.FanSpeed()
+	require.Error(t, err)
+
+	plan, err := Response{0x02, 0x00, 0x01, 0x00}.ThrottlePlan()
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), plan)
+
+	_, err = Response{0x00, 0x00, 0x00, 0x00}.ThrottlePlan()
+	require.Error(t, err)
+
+	limit, err := Response{0x50, 0x00, 0x01, 0x00}.ChargeLimit()
+	require.NoError(t, err)
+	require.Equal(t, uint8(80), limit)
+
+	level, err := Response{0x83, 0x00, 0x01, 0x00}.KeyboardBrightness()
+	require.NoError(t, err)
+	require.Equal(t, uint8(3), level)
+
+	_, err = Response{0x00, 0x00, 0x00, 0x00}.KeyboardBrightness()
+	require.Error(t, err)
+}
+
+func TestCommandExecute(t *testing.T) {
+	sim := NewSimulator()
+
+	resp, err := DevsSet(DevsThrottleCtrl, 1).Execute(sim)
+	require.NoError(t, err)
+	status, err := resp.Status()
+	require.NoError(t, err)
+	require.True(t, status.Success())
+
+	resp, err = DstsGet(DevsThrottleCtrl).Execute(sim)
+	require.NoError(t, err)
+	status, err = resp.Status()
+	require.NoError(t, err)
+	require.True(t, status.Present())
+	require.Equal(t, uint32(1), status.Value())
+
+	resp, err = DstsGetWithParam(DstsDefaultCPUFanCurve, 1).Execute(sim)
+	require.NoError(t, err)
+	curve, err := resp.FanCurve()
+	require.NoError(t, err)
+	require.Equal(t, simulatorFactoryFanCurves[1][0][:], curve)
+}
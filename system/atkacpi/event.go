@@ -0,0 +1,124 @@
+package atkacpi
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Event is the event ID reported by AsusAtkWmiEvent
+type Event uint32
+
+// Defines the known ACPI events
+const (
+	// EventOnBattery is reported when the 180W charger is unplugged
+	EventOnBattery Event = 87
+	// EventOnACPower is reported when the 180W charger is plugged in.
+	// Plugging in USB-C PD charger will not report this event
+	EventOnACPower Event = 88
+	// EventPowerInputChanged is reported when any charger is plugged in or unplugged
+	EventPowerInputChanged Event = 123
+	// EventChargerMisc only shows up when the 180W charger is plugged in or unplugged. Purpose unknown
+	EventChargerMisc Event = 207
+	// EventLidSwitch is reported when the lid is opened or closed. The event does not say which
+	EventLidSwitch Event = 233
+)
+
+func (e Event) String() string {
+	switch e {
+	case EventOnBattery:
+		return "On battery"
+	case EventOnACPower:
+		return "On AC power"
+	case EventPowerInputChanged:
+		return "Power input changed"
+	case EventChargerMisc:
+		return "Charger miscellaneous"
+	case EventLidSwitch:
+		return "Lid opened/closed"
+	default:
+		return fmt.Sprintf("Unknown (%d)", uint32(e))
+	}
+}
+
+// Known returns true if the event is one of the defined events
+func (e Event) Known() bool {
+	switch e {
+	case EventOnBattery, EventOnACPower, EventPowerInputChanged, EventChargerMisc, EventLidSwitch:
+		return true
+	default:
+		return false
+	}
+}
+
+// LidState is the state of the lid after EventLidSwitch
+type LidState int
+
+// Defines the possible lid states
+const (
+	LidUnchanged LidState = iota
+	LidOpened
+	LidClosed
+)
+
+func (l LidState) String() string {
+	return [...]string{
+		"Lid unchanged",
+		"Lid opened",
+		"Lid closed",
+	}[l]
+}
+
+// Decoded is an ACPI event with the state derived from it
+type Decoded struct {
+	Event Event
+	Lid   LidState
+}
+
+// Decoder turns raw event IDs into Decoded events. Since EventLidSwitch does not carry the direction,
+// Decoder keeps track of the lid state by toggling it, assuming the lid is open when G14Manager starts,
+// until the lid state is set from a source that reports it (see SetLidClosed)
+type Decoder struct {
+	mu        sync.Mutex
+	lidClosed bool
+	lidSynced bool
+}
+
+// NewDecoder returns a Decoder with the lid assumed to be open
+func NewDecoder() *Decoder {
+	return &Decoder{}
+}
+
+// SetLidClosed sets the lid state reported by the OS (e.g. on start up and on resume), and returns whether it changed.
+// Afterward, EventLidSwitch no longer toggles the state and is decoded as LidUnchanged, since a missed event
+// would invert the state permanently; the changes should come from the same source instead
+func (d *Decoder) SetLidClosed(closed bool) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	changed := d.lidClosed != closed
+	d.lidClosed = closed
+	d.lidSynced = true
+	return changed
+}
+
+// Decode decodes the raw event ID
+func (d *Decoder) Decode(id uint32) Decoded {
+	ev := Decoded{
+		Event: Event(id),
+		Lid:   LidUnchanged,
+	}
+	if ev.Event == EventLidSwitch {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if d.lidSynced {
+			return ev
+		}
+		d.lidClosed = !d.lidClosed
+		if d.lidClosed {
+			ev.Lid = LidClosed
+		} else {
+			ev.Lid = LidOpened
+		}
+	}
+	return ev
+}
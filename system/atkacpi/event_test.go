@@ -0,0 +1,31 @@
+package atkacpi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeEvent(t *testing.T) {
+	d := NewDecoder()
+
+	ev := d.Decode(88)
+	require.Equal(t, EventOnACPower, ev.Event)
+	require.Equal(t, LidUnchanged, ev.Lid)
+	require.True(t, ev.Event.Known())
+
+	ev = d.Decode(42)
+	require.False(t, ev.Event.Known())
+	require.Equal(t, "Unknown (42)", ev.Event.String())
+
+	// lid toggles from open
+	require.Equal(t, LidClosed, d.Decode(233).Lid)
+	require.Equal(t, LidOpened, d.Decode(233).Lid)
+	require.Equal(t, LidClosed, d.Decode(233).Lid)
+
+	// the state reported by the OS is used instead of toggling
+	require.True(t, d.SetLidClosed(false))
+	require.False(t, d.SetLidClosed(false))
+	require.Equal(t, LidUnchanged, d.Decode(233).Lid)
+	require.True(t, d.SetLidClosed(true))
+}
@@ -0,0 +1,276 @@
+package atkacpi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"sync"
+)
+
+const (
+	simulatorOutputBufferLength = 16
+	simulatorNumThrottlePlans   = 3
+	// Fan speed DSTS reports RPM in hundreds (see asus-wmi.c)
+	simulatorMaxFanSpeed = 6400
+)
+
+// Factory fan curves as reported by DSTS 0x110024/0x110025 on a GA401IV,
+// indexed by throttle plan, then CPU (0) and GPU (1)
+var simulatorFactoryFanCurves = [simulatorNumThrottlePlans][2][16]byte{
+	{
+		{20, 48, 51, 54, 57, 61, 65, 98, 14, 19, 22, 26, 31, 43, 49, 56},
+		{20, 48, 51, 54, 57, 61, 65, 98, 14, 21, 25, 28, 34, 44, 51, 61},
+	},
+	{
+		{20, 44, 47, 50, 53, 56, 60, 98, 11, 14, 17, 19, 22, 26, 31, 38},
+		{20, 44, 47, 50, 53, 56, 60, 98, 11, 14, 18, 21, 25, 28, 34, 40},
+	},
+	{
+		{20, 50, 55, 60, 65, 70, 75, 98, 21, 26, 31, 38, 43, 48, 56, 65},
+		{20, 50, 55, 60, 65, 70, 75, 98, 25, 28, 34, 40, 44, 49, 61, 70},
+	},
+}
+
+// Simulator is a stateful software model of the ATKD embedded controller.
+// It is useful for exercising thermal, battery and controller code paths
+// on machines without atkwmiacpi64.sys (e.g. development boxes and CI).
+// The simulator is safe for multiple goroutines.
+type Simulator struct {
+	mu            sync.Mutex
+	alreadyClosed bool
+
+	initialized   bool
+	throttlePlan  uint32
+	fanCurves     [simulatorNumThrottlePlans][2][16]byte
+	chargeLimit   uint32
+	kbdBacklight  uint32
+	chargerStatus uint32
+	lastHwCtrl    uint32
+	temperatures  [2]uint8
+	unsupported   map[uint32]bool
+}
+
+var _ WMI = &Simulator{}
+
+// NewSimulator returns a Simulator in its power-on state: Performance throttle plan
+// with factory fan curves, 100% charge limit, and the 180W charger plugged in
+func NewSimulator() *Simulator {
+	log.Println("atkacpi: using simulated embedded controller")
+	return &Simulator{
+		fanCurves:     simulatorFactoryFanCurves,
+		chargeLimit:   100,
+		chargerStatus: Charger180W,
+		temperatures:  [2]uint8{45, 40},
+		unsupported:   make(map[uint32]bool),
+	}
+}
+
+// Evaluate satisfies WMI
+func (s *Simulator) Evaluate(id Method, args []byte) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.alreadyClosed {
+		return nil, fmt.Errorf("simulator is already closed")
+	}
+	if len(args) < 4 {
+		return nil, fmt.Errorf("args should have at least one parameter")
+	}
+
+	switch id {
+	case INIT:
+		s.initialized = true
+		return s.status(StatusSuccess), nil
+	case DEVS:
+		if s.unsupported[binary.LittleEndian.Uint32(args[0:])] {
+			return s.status(StatusUnsupported), nil
+		}
+		return s.devs(args)
+	case DSTS:
+		if s.unsupported[binary.LittleEndian.Uint32(args[0:])] {
+			return s.status(StatusUnsupported), nil
+		}
+		return s.dsts(args)
+	case BSTS:
+		return s.status(StatusFailure), nil
+	default:
+		return s.status(StatusUnsupported), nil
+	}
+}
+
+func (s *Simulator) devs(args []byte) ([]byte, error) {
+	if len(args) < 8 {
+		return nil, fmt.Errorf("DEVS requires at least two parameters")
+	}
+	dev := binary.LittleEndian.Uint32(args[0:])
+	value := binary.LittleEndian.Uint32(args[4:])
+
+	switch dev {
+	case DevsHardwareCtrl:
+		s.lastHwCtrl = value
+	case DevsBatteryChargeLimit:
+		if value > 100 {
+			return s.status(StatusFailure), nil
+		}
+		s.chargeLimit = value
+	case DstsKeyboardBacklight:
+		// asus-wmi sets bit 7 when writing the brightness
+		s.kbdBacklight = value & 0x7F
+	case DevsThrottleCtrl:
+		if value >= simulatorNumThrottlePlans {
+			return s.status(StatusFailure), nil
+		}
+		// switching throttle plan resets the fan curves to the factory curves
+		s.throttlePlan = value
+		s.fanCurves[value] = simulatorFactoryFanCurves[value]
+	case DevsCPUFanCurve, DevsGPUFanCurve:
+		if len(args) != 20 {
+			return nil, fmt.Errorf("fan curve requires 16 bytes of table, got %d", len(args)-4)
+		}
+		copy(s.fanCurves[s.throttlePlan][fanIndex(dev)][:], args[4:20])
+	default:
+		return s.status(StatusUnsupported), nil
+	}
+
+	return s.status(StatusSuccess), nil
+}
+
+func (s *Simulator) dsts(args []byte) ([]byte, error) {
+	dev := binary.LittleEndian.Uint32(args[0:])
+
+	switch dev {
+	case DstsDefaultCPUFanCurve, DstsDefaultGPUFanCurve:
+		if len(args) < 8 {
+			return nil, fmt.Errorf("DSTS on fan curve requires the throttle plan as parameter")
+		}
+		plan := binary.LittleEndian.Uint32(args[4:])
+		if plan >= simulatorNumThrottlePlans {
+			return s.status(StatusUnsupported), nil
+		}
+		out := make([]byte, simulatorOutputBufferLength)
+		copy(out, simulatorFactoryFanCurves[plan][fanIndex(dev)][:])
+		return out, nil
+	case DstsCurrentCPUFanSpeed:
+		return s.status(PresenceBit | Status(s.fanSpeed(0)/100)), nil
+	case DstsCurrentGPUFanSpeed:
+		return s.status(PresenceBit | Status(s.fanSpeed(1)/100)), nil
+	case DstsCheckCharger:
+		return s.status(Status(s.chargerStatus)), nil
+	case DevsBatteryChargeLimit:
+		return s.status(PresenceBit | Status(s.chargeLimit)), nil
+	case DstsKeyboardBacklight:
+		return s.status(PresenceBit | Status(s.kbdBacklight)), nil
+	case DevsThrottleCtrl:
+		return s.status(PresenceBit | Status(s.throttlePlan)), nil
+	case DevsHardwareCtrl:
+		return s.status(PresenceBit), nil
+	default:
+		return s.status(StatusUnsupported), nil
+	}
+}
+
+// fanSpeed returns the simulated RPM of the given fan by looking up
+// the active curve with the simulated temperature
+func (s *Simulator) fanSpeed(fan int) uint32 {
+	curve := s.fanCurves[s.throttlePlan][fan]
+	temp := s.temperatures[fan]
+	var pct uint32
+	for i := 0; i < 8; i++ {
+		if temp >= curve[i] {
+			pct = uint32(curve[i+8])
+		}
+	}
+	return pct * simulatorMaxFanSpeed / 100
+}
+
+func (s *Simulator) status(v Status) []byte {
+	out := make([]byte, simulatorOutputBufferLength)
+	binary.LittleEndian.PutUint32(out, uint32(v))
+	return out
+}
+
+func fanIndex(dev uint32) int {
+	if dev == DevsGPUFanCurve {
+		return 1
+	}
+	return 0
+}
+
+// Close satisfies WMI
+func (s *Simulator) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.alreadyClosed = true
+	return nil
+}
+
+// SetChargerStatus changes the charger status reported by DstsCheckCharger.
+// Use ChargerUnplugged, Charger180W, or ChargerUSBCPD.
+func (s *Simulator) SetChargerStatus(status uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.chargerStatus = status
+}
+
+// SetUnsupported makes DEVS and DSTS return unsupported for the given device IDs,
+// which is useful for simulating variants other than the GA401 (e.g. G15)
+func (s *Simulator) SetUnsupported(devs ...uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, dev := range devs {
+		s.unsupported[dev] = true
+	}
+}
+
+// SetTemperatures changes the simulated CPU and GPU temperature in Celsius, which drives the reported fan speed
+func (s *Simulator) SetTemperatures(cpu, gpu uint8) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.temperatures = [2]uint8{cpu, gpu}
+}
+
+// Initialized returns true if INIT was evaluated
+func (s *Simulator) Initialized() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.initialized
+}
+
+// ThrottlePlan returns the currently active throttle plan
+func (s *Simulator) ThrottlePlan() uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.throttlePlan
+}
+
+// FanCurve returns the active fan curve of the given device (DevsCPUFanCurve or DevsGPUFanCurve)
+func (s *Simulator) FanCurve(dev uint32) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := make([]byte, 16)
+	copy(b, s.fanCurves[s.throttlePlan][fanIndex(dev)][:])
+	return b
+}
+
+// ChargeLimit returns the current battery charge limit in percentage
+func (s *Simulator) ChargeLimit() uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.chargeLimit
+}
+
+// LastHardwareControl returns the last key code sent via DevsHardwareCtrl
+func (s *Simulator) LastHardwareControl() uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.lastHwCtrl
+}
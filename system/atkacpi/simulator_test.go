@@ -0,0 +1,87 @@
+package atkacpi
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSimulatorThrottlePlanResetsFanCurve(t *testing.T) {
+	sim := NewSimulator()
+
+	curve := []byte{20, 50, 55, 60, 65, 70, 75, 98, 0, 0, 0, 0, 31, 49, 56, 56}
+	args := make([]byte, 20)
+	binary.LittleEndian.PutUint32(args[0:], DevsCPUFanCurve)
+	copy(args[4:], curve)
+	_, err := sim.Evaluate(DEVS, args)
+	require.NoError(t, err)
+	require.Equal(t, curve, sim.FanCurve(DevsCPUFanCurve))
+
+	args = make([]byte, 8)
+	binary.LittleEndian.PutUint32(args[0:], DevsThrottleCtrl)
+	binary.LittleEndian.PutUint32(args[4:], 2)
+	_, err = sim.Evaluate(DEVS, args)
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), sim.ThrottlePlan())
+	require.Equal(t, simulatorFactoryFanCurves[2][0][:], sim.FanCurve(DevsCPUFanCurve))
+
+	args = make([]byte, 4)
+	binary.LittleEndian.PutUint32(args[0:], DevsThrottleCtrl)
+	out, err := sim.Evaluate(DSTS, args)
+	require.NoError(t, err)
+	require.Equal(t, uint32(PresenceBit|2), binary.LittleEndian.Uint32(out))
+}
+
+func TestSimulatorDefaultFanCurve(t *testing.T) {
+	sim := NewSimulator()
+
+	args := make([]byte, 8)
+	binary.LittleEndian.PutUint32(args[0:], DstsDefaultGPUFanCurve)
+	binary.LittleEndian.PutUint32(args[4:], 1)
+	out, err := sim.Evaluate(DSTS, args)
+	require.NoError(t, err)
+	require.Equal(t, simulatorFactoryFanCurves[1][1][:], out)
+}
+
+func TestSimulatorCharger(t *testing.T) {
+	sim := NewSimulator()
+
+	args := make([]byte, 4)
+	binary.LittleEndian.PutUint32(args[0:], DstsCheckCharger)
+
+	for _, status := range []uint32{ChargerUnplugged, Charger180W, ChargerUSBCPD} {
+		sim.SetChargerStatus(status)
+		out, err := sim.Evaluate(DSTS, args)
+		require.NoError(t, err)
+		require.Equal(t, status, binary.LittleEndian.Uint32(out))
+	}
+}
+
+func TestSimulatorChargeLimitAndFanSpeed(t *testing.T) {
+	sim := NewSimulator()
+
+	args := make([]byte, 8)
+	binary.LittleEndian.PutUint32(args[0:], DevsBatteryChargeLimit)
+	binary.LittleEndian.PutUint32(args[4:], 60)
+	out, err := sim.Evaluate(DEVS, args)
+	require.NoError(t, err)
+	require.Equal(t, uint32(StatusSuccess), binary.LittleEndian.Uint32(out))
+	require.Equal(t, uint32(60), sim.ChargeLimit())
+
+	sim.SetTemperatures(98, 20)
+	args = make([]byte, 4)
+	binary.LittleEndian.PutUint32(args[0:], DstsCurrentCPUFanSpeed)
+	out, err = sim.Evaluate(DSTS, args)
+	require.NoError(t, err)
+	// 56% of 6400 RPM, reported in hundreds
+	require.Equal(t, uint32(PresenceBit|35), binary.LittleEndian.Uint32(out))
+}
+
+func TestSimulatorClosed(t *testing.T) {
+	sim := NewSimulator()
+	require.NoError(t, sim.Close())
+
+	_, err := sim.Evaluate(INIT, make([]byte, 4))
+	require.Error(t, err)
+}
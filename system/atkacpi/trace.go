@@ -0,0 +1,250 @@
+package atkacpi
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// TraceVersion is the version of the trace format written by the recorder.
+// Bump this when the format of traceHeader or traceEntry changes.
+const TraceVersion = 1
+
+// ErrTraceMismatch is returned by the Replayer when a call differs from the trace
+var ErrTraceMismatch = errors.New("call does not match trace")
+
+// ErrTraceExhausted is returned by the Replayer when there are no more calls in the trace
+var ErrTraceExhausted = errors.New("no more calls in trace")
+
+// The trace file is newline delimited JSON. The first line is the header,
+// and each subsequent line is one Evaluate call and its result.
+type traceHeader struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+}
+
+type traceEntry struct {
+	Method Method `json:"method"`
+	Args   string `json:"args"`   // hex encoded
+	Result string `json:"result"` // hex encoded
+	Error  string `json:"error,omitempty"`
+}
+
+type recorder struct {
+	mu            sync.Mutex
+	alreadyClosed bool
+	wmi           WMI
+	out           io.WriteCloser
+	writer        *bufio.Writer
+	enc           *json.Encoder
+}
+
+var _ WMI = &recorder{}
+
+// NewRecorder returns a WMI that passes through all calls to wmi, and writes
+// every call and its result to a trace file at path. The trace can be served
+// back with NewReplayer.
+func NewRecorder(wmi WMI, path string) (WMI, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return newRecorder(wmi, f)
+}
+
+func newRecorder(wmi WMI, out io.WriteCloser) (*recorder, error) {
+	if wmi == nil {
+		return nil, errors.New("nil WMI is invalid")
+	}
+	w := bufio.NewWriter(out)
+	r := &recorder{
+		wmi:    wmi,
+		out:    out,
+		writer: w,
+		enc:    json.NewEncoder(w),
+	}
+	if err := r.enc.Encode(traceHeader{
+		Version: TraceVersion,
+		Created: time.Now(),
+	}); err != nil {
+		return nil, err
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *recorder) Evaluate(id Method, args []byte) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result, err := r.wmi.Evaluate(id, args)
+
+	entry := traceEntry{
+		Method: id,
+		Args:   hex.EncodeToString(args),
+		Result: hex.EncodeToString(result),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if r.alreadyClosed {
+		return result, err
+	}
+	// flush after every call so the trace survives a crash
+	if encErr := r.enc.Encode(entry); encErr == nil {
+		r.writer.Flush()
+	}
+
+	return result, err
+}
+
+// Probe satisfies Prober if the underlying WMI does
+func (r *recorder) Probe(dev uint32) (bool, bool) {
+	if prober, ok := r.wmi.(Prober); ok {
+		return prober.Probe(dev)
+	}
+	return false, false
+}
+
+func (r *recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.alreadyClosed {
+		return nil
+	}
+	r.alreadyClosed = true
+
+	r.writer.Flush()
+	r.out.Close()
+	return r.wmi.Close()
+}
+
+// Replayer serves results from a trace written by the recorder. Calls are matched by method and arguments,
+// and calls with the same method and arguments are served in the order of the trace. Background pollers
+// (e.g. the fan sampler) interleave differently on every run, so the order across different calls is not checked.
+// Any call that has no match left in the trace is flagged as a mismatch. The Replayer is safe for multiple goroutines.
+type Replayer struct {
+	mu         sync.Mutex
+	entries    []traceEntry
+	pending    map[string][]int // indices of the entries not replayed yet, by method and arguments
+	remaining  int
+	mismatches []error
+}
+
+var _ WMI = &Replayer{}
+
+// NewReplayer reads the trace file at path and returns a Replayer
+func NewReplayer(path string) (*Replayer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadTrace(f)
+}
+
+// ReadTrace reads a trace from r and returns a Replayer
+func ReadTrace(r io.Reader) (*Replayer, error) {
+	dec := json.NewDecoder(r)
+
+	var header traceHeader
+	if err := dec.Decode(&header); err != nil {
+		return nil, fmt.Errorf("cannot read trace header: %w", err)
+	}
+	if header.Version != TraceVersion {
+		return nil, fmt.Errorf("unsupported trace version %d, expecting %d", header.Version, TraceVersion)
+	}
+
+	entries := make([]traceEntry, 0)
+	pending := make(map[string][]int)
+	for {
+		var entry traceEntry
+		err := dec.Decode(&entry)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot read trace entry %d: %w", len(entries), err)
+		}
+		key := traceKey(entry.Method, entry.Args)
+		pending[key] = append(pending[key], len(entries))
+		entries = append(entries, entry)
+	}
+
+	return &Replayer{
+		entries:   entries,
+		pending:   pending,
+		remaining: len(entries),
+	}, nil
+}
+
+func traceKey(id Method, args string) string {
+	return fmt.Sprintf("%s(%s)", id, args)
+}
+
+// Evaluate satisfies WMI
+func (r *Replayer) Evaluate(id Method, args []byte) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.remaining == 0 {
+		err := fmt.Errorf("%s(%x): %w", id, args, ErrTraceExhausted)
+		r.mismatches = append(r.mismatches, err)
+		return nil, err
+	}
+
+	key := traceKey(id, hex.EncodeToString(args))
+	indices := r.pending[key]
+	if len(indices) == 0 {
+		err := fmt.Errorf("%s is not in the trace, or was replayed already: %w", key, ErrTraceMismatch)
+		r.mismatches = append(r.mismatches, err)
+		return nil, err
+	}
+
+	index := indices[0]
+	entry := r.entries[index]
+	r.pending[key] = indices[1:]
+	r.remaining--
+
+	if entry.Error != "" {
+		return nil, errors.New(entry.Error)
+	}
+
+	result, err := hex.DecodeString(entry.Result)
+	if err != nil {
+		return nil, fmt.Errorf("call %d: malformed result in trace: %w", index, err)
+	}
+	return result, nil
+}
+
+// Close satisfies WMI
+func (r *Replayer) Close() error {
+	return nil
+}
+
+// Mismatches returns the calls that did not match the trace
+func (r *Replayer) Mismatches() []error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m := make([]error, len(r.mismatches))
+	copy(m, r.mismatches)
+	return m
+}
+
+// Remaining returns the number of calls in the trace that were not replayed
+func (r *Replayer) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.remaining
+}
@@ -0,0 +1,128 @@
+package atkacpi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type bufferCloser struct {
+	bytes.Buffer
+}
+
+func (b *bufferCloser) Close() error { return nil }
+
+func TestRecordAndReplay(t *testing.T) {
+	var trace bufferCloser
+
+	rec, err := newRecorder(NewSimulator(), &trace)
+	require.NoError(t, err)
+
+	throttle := make([]byte, 8)
+	binary.LittleEndian.PutUint32(throttle[0:], DevsThrottleCtrl)
+	binary.LittleEndian.PutUint32(throttle[4:], 1)
+	charger := make([]byte, 4)
+	binary.LittleEndian.PutUint32(charger[0:], DstsCheckCharger)
+
+	initResult, err := rec.Evaluate(INIT, make([]byte, 4))
+	require.NoError(t, err)
+	throttleResult, err := rec.Evaluate(DEVS, throttle)
+	require.NoError(t, err)
+	chargerResult, err := rec.Evaluate(DSTS, charger)
+	require.NoError(t, err)
+	_, err = rec.Evaluate(DSTS, nil)
+	require.Error(t, err)
+	require.NoError(t, rec.Close())
+
+	replay, err := ReadTrace(&trace)
+	require.NoError(t, err)
+	require.Equal(t, 4, replay.Remaining())
+
+	out, err := replay.Evaluate(INIT, make([]byte, 4))
+	require.NoError(t, err)
+	require.Equal(t, initResult, out)
+	out, err = replay.Evaluate(DEVS, throttle)
+	require.NoError(t, err)
+	require.Equal(t, throttleResult, out)
+	out, err = replay.Evaluate(DSTS, charger)
+	require.NoError(t, err)
+	require.Equal(t, chargerResult, out)
+	_, err = replay.Evaluate(DSTS, nil)
+	require.Error(t, err)
+
+	require.Equal(t, 0, replay.Remaining())
+	require.Empty(t, replay.Mismatches())
+
+	_, err = replay.Evaluate(INIT, make([]byte, 4))
+	require.True(t, errors.Is(err, ErrTraceExhausted))
+}
+
+func TestReplayMismatch(t *testing.T) {
+	var trace bufferCloser
+
+	rec, err := newRecorder(NewSimulator(), &trace)
+	require.NoError(t, err)
+
+	args := make([]byte, 8)
+	binary.LittleEndian.PutUint32(args[0:], DevsBatteryChargeLimit)
+	binary.LittleEndian.PutUint32(args[4:], 80)
+	_, err = rec.Evaluate(DEVS, args)
+	require.NoError(t, err)
+
+	replay, err := ReadTrace(&trace)
+	require.NoError(t, err)
+
+	binary.LittleEndian.PutUint32(args[4:], 60)
+	_, err = replay.Evaluate(DEVS, args)
+	require.True(t, errors.Is(err, ErrTraceMismatch))
+	require.Len(t, replay.Mismatches(), 1)
+}
+
+func TestReplayInterleaved(t *testing.T) {
+	var trace bufferCloser
+
+	rec, err := newRecorder(NewSimulator(), &trace)
+	require.NoError(t, err)
+
+	plan := make([]byte, 4)
+	binary.LittleEndian.PutUint32(plan[0:], DevsThrottleCtrl)
+	speed := make([]byte, 4)
+	binary.LittleEndian.PutUint32(speed[0:], DstsCurrentCPUFanSpeed)
+
+	silent := DevsSet(DevsThrottleCtrl, 2).Args
+
+	before, err := rec.Evaluate(DSTS, plan)
+	require.NoError(t, err)
+	_, err = rec.Evaluate(DSTS, speed)
+	require.NoError(t, err)
+	_, err = rec.Evaluate(DEVS, silent)
+	require.NoError(t, err)
+	after, err := rec.Evaluate(DSTS, plan)
+	require.NoError(t, err)
+	require.NotEqual(t, before, after)
+
+	replay, err := ReadTrace(&trace)
+	require.NoError(t, err)
+
+	// the fan speed poller runs at a different time, but the same calls are served in order
+	_, err = replay.Evaluate(DSTS, plan)
+	require.NoError(t, err)
+	_, err = replay.Evaluate(DEVS, silent)
+	require.NoError(t, err)
+	_, err = replay.Evaluate(DSTS, speed)
+	require.NoError(t, err)
+	out, err := replay.Evaluate(DSTS, plan)
+	require.NoError(t, err)
+	require.Equal(t, after, out)
+
+	require.Equal(t, 0, replay.Remaining())
+	require.Empty(t, replay.Mismatches())
+}
+
+func TestReplayVersion(t *testing.T) {
+	_, err := ReadTrace(bytes.NewBufferString(`{"version":0}`))
+	require.Error(t, err)
+}
@@ -2,11 +2,6 @@ package atkacpi
 
 import (
 	"encoding/binary"
-	"fmt"
-	"sync"
-
-	"github.com/zllovesuki/G14Manager/system/device"
-	"github.com/zllovesuki/G14Manager/system/ioctl"
 )
 
 // Method defines the WMI method IDs
@@ -22,6 +17,13 @@ const (
 	SFUN Method = 0x4e554653
 )
 
+// String returns the four character name of the method (e.g. DEVS)
+func (m Method) String() string {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, uint32(m))
+	return string(b)
+}
+
 // Defines the IIA0 argument (big endian for readability)
 // golang: this is not ergonomic *face palm*
 const (
@@ -35,13 +37,15 @@ const (
 	DstsCurrentCPUFanSpeed uint32 = 0x00110013
 	DstsCurrentGPUFanSpeed uint32 = 0x00110014
 	DstsCheckCharger       uint32 = 0x0012006c
+	DstsKeyboardBacklight  uint32 = 0x00050021
 )
 
-// This is needed since we are calling from userspace
-// and we need atkwmiacpi64.sys to do the leg work of
-// calling ACPI methods from kernel space
-// However, we could technically interact with ACPI\PNP0C14\ATK...
-const devicePath = `\\.\ATKACPI`
+// Defines the charger status reported by DstsCheckCharger
+const (
+	ChargerUnplugged uint32 = 0x0
+	Charger180W      uint32 = 0x10001
+	ChargerUSBCPD    uint32 = 0x10002
+)
 
 // WMI is for evaluating WMI methods
 type WMI interface {
@@ -50,57 +54,3 @@ type WMI interface {
 	// Close will close the underlying IO to the hardware
 	Close() error
 }
-
-type atkWmi struct {
-	sync.Mutex
-	alreadyClosed bool
-	device        *device.Control
-}
-
-var _ WMI = &atkWmi{}
-
-// NewWMI returns an WMI for evaluating WMI methods exposed by the ATKD ACPI device
-func NewWMI(dryRun bool) (WMI, error) {
-	device, err := device.NewControl(device.Config{
-		DryRun:      dryRun,
-		Path:        devicePath,
-		ControlCode: ioctl.ATK_ACPI_WMIFUNCTION,
-	})
-	if err != nil {
-		return nil, err
-	}
-	return &atkWmi{
-		device: device,
-	}, nil
-}
-
-func (a *atkWmi) Evaluate(id Method, args []byte) ([]byte, error) {
-	a.Lock()
-	defer a.Unlock()
-
-	if len(args) < 4 {
-		return nil, fmt.Errorf("args should have at least one parameter")
-	}
-
-	acpiBuf := make([]byte, 8+len(args))
-	binary.LittleEndian.PutUint32(acpiBuf[0:], uint32(id))
-	binary.LittleEndian.PutUint32(acpiBuf[4:], uint32(len(args)))
-	copy(acpiBuf[8:], args)
-
-	result, err := a.device.Execute(acpiBuf, 16)
-	if err != nil {
-		return nil, err
-	}
-
-	return result, nil
-}
-
-func (a *atkWmi) Close() error {
-	a.Lock()
-	defer a.Unlock()
-	if a.alreadyClosed {
-		return nil
-	}
-	a.alreadyClosed = true
-	return a.device.Close()
-}
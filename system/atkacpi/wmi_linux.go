@@ -0,0 +1,322 @@
+//go:build linux
+// +build linux
+
+package atkacpi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// On Linux, the asus-wmi kernel module has already claimed the ATKD ACPI device,
+// so DEVS/DSTS calls are mapped to the interfaces exposed by the module:
+// the debugfs interface for arbitrary device IDs, and the platform/hwmon/power_supply
+// attributes where the module manages the state itself (e.g. it caches the throttle plan)
+
+// Defines the default locations of the asus-wmi interfaces
+const (
+	DefaultDebugfsPath  = "/sys/kernel/debug/asus-nb-wmi"
+	DefaultPlatformPath = "/sys/devices/platform/asus-nb-wmi"
+	DefaultHwmonPath    = "/sys/class/hwmon"
+	DefaultBatteryPath  = "/sys/class/power_supply/BAT0"
+)
+
+const (
+	sysfsOutputBufferLength = 16
+	fanCurveHwmonName       = "asus_custom_fan_curve"
+	fanCurveDevsArgsLength  = 4 + fanCurveLength
+)
+
+// SysfsConfig defines where the asus-wmi interfaces are mounted.
+// Empty paths will use the defaults
+type SysfsConfig struct {
+	DryRun       bool
+	DebugfsPath  string
+	PlatformPath string
+	HwmonPath    string
+	BatteryPath  string
+}
+
+type sysfsWmi struct {
+	sync.Mutex
+	conf SysfsConfig
+}
+
+var _ WMI = &sysfsWmi{}
+
+// NewWMI returns an WMI for evaluating WMI methods via the asus-wmi kernel module
+func NewWMI(dryRun bool) (WMI, error) {
+	return NewSysfsWMI(SysfsConfig{
+		DryRun: dryRun,
+	})
+}
+
+// NewSysfsWMI returns an WMI backed by the asus-wmi interfaces at the given locations
+func NewSysfsWMI(conf SysfsConfig) (WMI, error) {
+	if conf.DebugfsPath == "" {
+		conf.DebugfsPath = DefaultDebugfsPath
+	}
+	if conf.PlatformPath == "" {
+		conf.PlatformPath = DefaultPlatformPath
+	}
+	if conf.HwmonPath == "" {
+		conf.HwmonPath = DefaultHwmonPath
+	}
+	if conf.BatteryPath == "" {
+		conf.BatteryPath = DefaultBatteryPath
+	}
+	if _, err := os.Stat(filepath.Join(conf.DebugfsPath, "dev_id")); err != nil {
+		return nil, fmt.Errorf("asus-wmi debugfs is not available (is debugfs mounted and are you root?): %w", err)
+	}
+	if conf.DryRun {
+		log.Println("[dry run] atkacpi: DEVS calls will not be written to asus-wmi")
+	}
+	return &sysfsWmi{
+		conf: conf,
+	}, nil
+}
+
+func (s *sysfsWmi) Evaluate(id Method, args []byte) ([]byte, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if len(args) < 4 {
+		return nil, fmt.Errorf("args should have at least one parameter")
+	}
+
+	cmd := Command{
+		Method: id,
+		Args:   args,
+	}
+	dev := cmd.Device()
+	var param uint32
+	if len(args) >= 8 {
+		param = binary.LittleEndian.Uint32(args[4:])
+	}
+
+	var status Status
+	var err error
+
+	switch id {
+	case INIT:
+		// asus-wmi has already initialized the device during probe
+		status = StatusSuccess
+	case DEVS:
+		status, err = s.devs(dev, param, args)
+	case DSTS:
+		status, err = s.dsts(dev)
+	default:
+		status, err = s.call(id, dev, param)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, sysfsOutputBufferLength)
+	binary.LittleEndian.PutUint32(out, uint32(status))
+	return out, nil
+}
+
+var _ Prober = &sysfsWmi{}
+
+// Probe satisfies Prober, since asus-wmi manages some of the devices via its own attributes,
+// and it only creates the attributes if the firmware supports the device
+func (s *sysfsWmi) Probe(dev uint32) (bool, bool) {
+	var path string
+	switch dev {
+	case DevsThrottleCtrl:
+		path = filepath.Join(s.conf.PlatformPath, "throttle_thermal_policy")
+	case DevsBatteryChargeLimit:
+		path = filepath.Join(s.conf.BatteryPath, "charge_control_end_threshold")
+	case DevsCPUFanCurve, DevsGPUFanCurve:
+		_, err := s.findHwmon(fanCurveHwmonName)
+		return err == nil, true
+	default:
+		return false, false
+	}
+	_, err := os.Stat(path)
+	return err == nil, true
+}
+
+func (s *sysfsWmi) devs(dev, param uint32, args []byte) (Status, error) {
+	switch dev {
+	case DevsThrottleCtrl:
+		if err := s.write(filepath.Join(s.conf.PlatformPath, "throttle_thermal_policy"), param); err != nil {
+			return 0, err
+		}
+		return StatusSuccess, nil
+	case DevsBatteryChargeLimit:
+		if err := s.write(filepath.Join(s.conf.BatteryPath, "charge_control_end_threshold"), param); err != nil {
+			return 0, err
+		}
+		return StatusSuccess, nil
+	case DevsCPUFanCurve, DevsGPUFanCurve:
+		if len(args) != fanCurveDevsArgsLength {
+			return 0, fmt.Errorf("fan curve should be %d bytes, got %d", fanCurveLength, len(args)-4)
+		}
+		if err := s.writeFanCurve(dev, args[4:]); err != nil {
+			return 0, err
+		}
+		return StatusSuccess, nil
+	}
+
+	if s.conf.DryRun {
+		return StatusSuccess, nil
+	}
+	if err := s.setDebugfsArgs(dev, param); err != nil {
+		return 0, err
+	}
+	return s.readDebugfs("devs")
+}
+
+func (s *sysfsWmi) dsts(dev uint32) (Status, error) {
+	switch dev {
+	case DevsThrottleCtrl:
+		plan, err := s.read(filepath.Join(s.conf.PlatformPath, "throttle_thermal_policy"))
+		if err != nil {
+			return 0, err
+		}
+		return PresenceBit | Status(plan), nil
+	case DevsBatteryChargeLimit:
+		limit, err := s.read(filepath.Join(s.conf.BatteryPath, "charge_control_end_threshold"))
+		if err != nil {
+			return 0, err
+		}
+		return PresenceBit | Status(limit), nil
+	case DstsDefaultCPUFanCurve, DstsDefaultGPUFanCurve:
+		// the fan curve is a buffer, but debugfs can only return a single integer
+		return StatusUnsupported, nil
+	}
+
+	if err := s.setDebugfsArgs(dev, 0); err != nil {
+		return 0, err
+	}
+	return s.readDebugfs("dsts")
+}
+
+func (s *sysfsWmi) call(id Method, dev, param uint32) (Status, error) {
+	if s.conf.DryRun {
+		return StatusSuccess, nil
+	}
+	if err := writeAttribute(filepath.Join(s.conf.DebugfsPath, "method_id"), fmt.Sprintf("%#x", uint32(id))); err != nil {
+		return 0, err
+	}
+	if err := s.setDebugfsArgs(dev, param); err != nil {
+		return 0, err
+	}
+	return s.readDebugfs("call")
+}
+
+// writeFanCurve maps the 16 bytes fan table to the pwm auto points exposed by asus_custom_fan_curve
+func (s *sysfsWmi) writeFanCurve(dev uint32, table []byte) error {
+	hwmon, err := s.findHwmon(fanCurveHwmonName)
+	if err != nil {
+		return err
+	}
+	pwm := 1
+	if dev == DevsGPUFanCurve {
+		pwm = 2
+	}
+	for i := 0; i < 8; i++ {
+		temp := filepath.Join(hwmon, fmt.Sprintf("pwm%d_auto_point%d_temp", pwm, i+1))
+		if err := s.write(temp, uint32(table[i])); err != nil {
+			return err
+		}
+		// percentage to 0-255
+		duty := filepath.Join(hwmon, fmt.Sprintf("pwm%d_auto_point%d_pwm", pwm, i+1))
+		if err := s.write(duty, uint32(table[i+8])*255/100); err != nil {
+			return err
+		}
+	}
+	// enable the custom fan curve
+	return s.write(filepath.Join(hwmon, fmt.Sprintf("pwm%d_enable", pwm)), 1)
+}
+
+func (s *sysfsWmi) findHwmon(name string) (string, error) {
+	entries, err := ioutil.ReadDir(s.conf.HwmonPath)
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		dir := filepath.Join(s.conf.HwmonPath, entry.Name())
+		n, err := ioutil.ReadFile(filepath.Join(dir, "name"))
+		if err != nil {
+			continue
+		}
+		if strings.TrimSpace(string(n)) == name {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("cannot find hwmon device %s (is your kernel too old?)", name)
+}
+
+func (s *sysfsWmi) setDebugfsArgs(dev, param uint32) error {
+	if err := writeAttribute(filepath.Join(s.conf.DebugfsPath, "dev_id"), fmt.Sprintf("%#x", dev)); err != nil {
+		return err
+	}
+	return writeAttribute(filepath.Join(s.conf.DebugfsPath, "ctrl_param"), fmt.Sprintf("%#x", param))
+}
+
+// readDebugfs parses the result of asus-wmi debugfs, e.g. "DSTS(0x12006c) = 0x10001"
+func (s *sysfsWmi) readDebugfs(name string) (Status, error) {
+	b, err := ioutil.ReadFile(filepath.Join(s.conf.DebugfsPath, name))
+	if err != nil {
+		return 0, err
+	}
+	line := strings.TrimSpace(string(b))
+	idx := strings.LastIndex(line, "=")
+	if idx < 0 {
+		return 0, fmt.Errorf("unexpected output from asus-wmi %s: %s", name, line)
+	}
+	// devs prints the result as a signed integer
+	v, err := strconv.ParseInt(strings.TrimSpace(line[idx+1:]), 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected output from asus-wmi %s: %s", name, line)
+	}
+	return Status(uint32(v)), nil
+}
+
+func (s *sysfsWmi) read(path string) (uint32, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected value in %s: %w", path, err)
+	}
+	return uint32(v), nil
+}
+
+func (s *sysfsWmi) write(path string, v uint32) error {
+	if s.conf.DryRun {
+		log.Printf("[dry run] atkacpi: skipping write of %d to %s\n", v, path)
+		return nil
+	}
+	return writeAttribute(path, strconv.FormatUint(uint64(v), 10))
+}
+
+// Close is a no-op, as the attributes are opened on each call
+func (s *sysfsWmi) Close() error {
+	return nil
+}
+
+// writeAttribute writes to an existing attribute, as sysfs and debugfs do not allow creating files
+func writeAttribute(path string, value string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(value); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,191 @@
+//go:build linux
+// +build linux
+
+package atkacpi
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSysfs struct {
+	conf SysfsConfig
+}
+
+func newFakeSysfs(t *testing.T) *fakeSysfs {
+	root := t.TempDir()
+	f := &fakeSysfs{
+		conf: SysfsConfig{
+			DebugfsPath:  filepath.Join(root, "debug", "asus-nb-wmi"),
+			PlatformPath: filepath.Join(root, "platform", "asus-nb-wmi"),
+			HwmonPath:    filepath.Join(root, "hwmon"),
+			BatteryPath:  filepath.Join(root, "power_supply", "BAT0"),
+		},
+	}
+
+	f.create(t, f.conf.DebugfsPath, "dev_id", "0x0")
+	f.create(t, f.conf.DebugfsPath, "ctrl_param", "0x0")
+	f.create(t, f.conf.DebugfsPath, "method_id", "0x0")
+	f.create(t, f.conf.DebugfsPath, "dsts", "DSTS(0x12006c) = 0x10001\n")
+	f.create(t, f.conf.DebugfsPath, "devs", "DEVS(0x100021, 0x4) = 1\n")
+	f.create(t, f.conf.DebugfsPath, "call", "0x53554653(0x0, 0x0) = 0x0\n")
+	f.create(t, f.conf.PlatformPath, "throttle_thermal_policy", "0\n")
+	f.create(t, f.conf.BatteryPath, "charge_control_end_threshold", "100\n")
+
+	// an unrelated hwmon device comes first
+	f.create(t, filepath.Join(f.conf.HwmonPath, "hwmon0"), "name", "acpitz\n")
+	hwmon := filepath.Join(f.conf.HwmonPath, "hwmon3")
+	f.create(t, hwmon, "name", "asus_custom_fan_curve\n")
+	for _, pwm := range []string{"pwm1", "pwm2"} {
+		f.create(t, hwmon, pwm+"_enable", "2\n")
+		for i := 1; i <= 8; i++ {
+			f.create(t, hwmon, fmt.Sprintf("%s_auto_point%d_temp", pwm, i), "0\n")
+			f.create(t, hwmon, fmt.Sprintf("%s_auto_point%d_pwm", pwm, i), "0\n")
+		}
+	}
+
+	return f
+}
+
+func (f *fakeSysfs) create(t *testing.T, dir, name, content string) {
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+}
+
+func (f *fakeSysfs) read(t *testing.T, dir, name string) string {
+	b, err := ioutil.ReadFile(filepath.Join(dir, name))
+	require.NoError(t, err)
+	return strings.TrimSpace(string(b))
+}
+
+func TestSysfsWMIUnavailable(t *testing.T) {
+	_, err := NewSysfsWMI(SysfsConfig{
+		DebugfsPath: filepath.Join(t.TempDir(), "nonexistent"),
+	})
+	require.Error(t, err)
+}
+
+func TestSysfsWMIThrottlePlan(t *testing.T) {
+	f := newFakeSysfs(t)
+	wmi, err := NewSysfsWMI(f.conf)
+	require.NoError(t, err)
+
+	resp, err := DevsSet(DevsThrottleCtrl, 2).Execute(wmi)
+	require.NoError(t, err)
+	status, err := resp.Status()
+	require.NoError(t, err)
+	require.True(t, status.Success())
+	require.Equal(t, "2", f.read(t, f.conf.PlatformPath, "throttle_thermal_policy"))
+
+	resp, err = DstsGet(DevsThrottleCtrl).Execute(wmi)
+	require.NoError(t, err)
+	status, err = resp.Status()
+	require.NoError(t, err)
+	require.True(t, status.Present())
+	require.Equal(t, uint32(2), status.Value())
+}
+
+func TestSysfsWMIBattery(t *testing.T) {
+	f := newFakeSysfs(t)
+	wmi, err := NewSysfsWMI(f.conf)
+	require.NoError(t, err)
+
+	_, err = DevsSet(DevsBatteryChargeLimit, 60).Execute(wmi)
+	require.NoError(t, err)
+	require.Equal(t, "60", f.read(t, f.conf.BatteryPath, "charge_control_end_threshold"))
+
+	resp, err := DstsGet(DevsBatteryChargeLimit).Execute(wmi)
+	require.NoError(t, err)
+	limit, err := resp.ChargeLimit()
+	require.NoError(t, err)
+	require.Equal(t, uint8(60), limit)
+}
+
+func TestSysfsWMIFanCurve(t *testing.T) {
+	f := newFakeSysfs(t)
+	wmi, err := NewSysfsWMI(f.conf)
+	require.NoError(t, err)
+
+	table := []byte{20, 50, 55, 60, 65, 70, 75, 98, 0, 0, 0, 0, 31, 49, 56, 100}
+	cmd, err := SetFanCurve(DevsGPUFanCurve, table)
+	require.NoError(t, err)
+	_, err = cmd.Execute(wmi)
+	require.NoError(t, err)
+
+	hwmon := filepath.Join(f.conf.HwmonPath, "hwmon3")
+	require.Equal(t, "1", f.read(t, hwmon, "pwm2_enable"))
+	require.Equal(t, "20", f.read(t, hwmon, "pwm2_auto_point1_temp"))
+	require.Equal(t, "98", f.read(t, hwmon, "pwm2_auto_point8_temp"))
+	require.Equal(t, "0", f.read(t, hwmon, "pwm2_auto_point1_pwm"))
+	require.Equal(t, "79", f.read(t, hwmon, "pwm2_auto_point5_pwm"))
+	require.Equal(t, "255", f.read(t, hwmon, "pwm2_auto_point8_pwm"))
+	// cpu fan is untouched
+	require.Equal(t, "2", f.read(t, hwmon, "pwm1_enable"))
+
+	// default fan curves cannot be read via debugfs
+	resp, err := DstsGetWithParam(DstsDefaultCPUFanCurve, 0).Execute(wmi)
+	require.NoError(t, err)
+	_, err = resp.FanCurve()
+	require.Error(t, err)
+}
+
+func TestSysfsWMIDebugfs(t *testing.T) {
+	f := newFakeSysfs(t)
+	wmi, err := NewSysfsWMI(f.conf)
+	require.NoError(t, err)
+
+	resp, err := DstsGet(DstsCheckCharger).Execute(wmi)
+	require.NoError(t, err)
+	status, err := resp.Status()
+	require.NoError(t, err)
+	require.Equal(t, Status(Charger180W), status)
+	require.Equal(t, "0x12006c", f.read(t, f.conf.DebugfsPath, "dev_id"))
+
+	resp, err = DevsSet(DevsHardwareCtrl, 4).Execute(wmi)
+	require.NoError(t, err)
+	status, err = resp.Status()
+	require.NoError(t, err)
+	require.True(t, status.Success())
+	require.Equal(t, "0x100021", f.read(t, f.conf.DebugfsPath, "dev_id"))
+	require.Equal(t, "0x4", f.read(t, f.conf.DebugfsPath, "ctrl_param"))
+
+	f.create(t, f.conf.DebugfsPath, "dsts", "garbage\n")
+	_, err = DstsGet(DstsCheckCharger).Execute(wmi)
+	require.Error(t, err)
+}
+
+func TestSysfsWMIDryRun(t *testing.T) {
+	f := newFakeSysfs(t)
+	conf := f.conf
+	conf.DryRun = true
+	wmi, err := NewSysfsWMI(conf)
+	require.NoError(t, err)
+
+	_, err = DevsSet(DevsThrottleCtrl, 1).Execute(wmi)
+	require.NoError(t, err)
+	require.Equal(t, "0", f.read(t, f.conf.PlatformPath, "throttle_thermal_policy"))
+
+	_, err = DevsSet(DevsHardwareCtrl, 4).Execute(wmi)
+	require.NoError(t, err)
+	require.Equal(t, "0x0", f.read(t, f.conf.DebugfsPath, "dev_id"))
+}
+
+func TestSysfsWMIProbe(t *testing.T) {
+	f := newFakeSysfs(t)
+	require.NoError(t, os.Remove(filepath.Join(f.conf.BatteryPath, "charge_control_end_threshold")))
+	wmi, err := NewSysfsWMI(f.conf)
+	require.NoError(t, err)
+
+	caps := ProbeCapabilities(wmi)
+	require.True(t, caps.Supports(DevsThrottleCtrl))
+	require.True(t, caps.Supports(DevsCPUFanCurve))
+	require.False(t, caps.Supports(DevsBatteryChargeLimit))
+	// falls back to DSTS via debugfs
+	require.True(t, caps.Supports(DstsCheckCharger))
+}
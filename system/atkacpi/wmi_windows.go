@@ -0,0 +1,72 @@
+//go:build windows
+// +build windows
+
+package atkacpi
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/zllovesuki/G14Manager/system/device"
+	"github.com/zllovesuki/G14Manager/system/ioctl"
+)
+
+// This is needed since we are calling from userspace
+// and we need atkwmiacpi64.sys to do the leg work of
+// calling ACPI methods from kernel space
+// However, we could technically interact with ACPI\PNP0C14\ATK...
+const devicePath = `\\.\ATKACPI`
+
+type atkWmi struct {
+	sync.Mutex
+	alreadyClosed bool
+	device        *device.Control
+}
+
+var _ WMI = &atkWmi{}
+
+// NewWMI returns an WMI for evaluating WMI methods exposed by the ATKD ACPI device
+func NewWMI(dryRun bool) (WMI, error) {
+	device, err := device.NewControl(device.Config{
+		DryRun:      dryRun,
+		Path:        devicePath,
+		ControlCode: ioctl.ATK_ACPI_WMIFUNCTION,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &atkWmi{
+		device: device,
+	}, nil
+}
+
+func (a *atkWmi) Evaluate(id Method, args []byte) ([]byte, error) {
+	a.Lock()
+	defer a.Unlock()
+
+	if len(args) < 4 {
+		return nil, fmt.Errorf("args should have at least one parameter")
+	}
+
+	acpiBuf := Command{
+		Method: id,
+		Args:   args,
+	}.Bytes()
+
+	result, err := a.device.Execute(acpiBuf, 16)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (a *atkWmi) Close() error {
+	a.Lock()
+	defer a.Unlock()
+	if a.alreadyClosed {
+		return nil
+	}
+	a.alreadyClosed = true
+	return a.device.Close()
+}
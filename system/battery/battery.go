@@ -1,12 +1,19 @@
 package battery
 
 import (
+	"context"
 	"encoding/binary"
 	"errors"
+	"fmt"
+	"log"
+	"strconv"
 	"sync"
 
 	"github.com/zllovesuki/G14Manager/system/atkacpi"
+	"github.com/zllovesuki/G14Manager/system/drift"
 	"github.com/zllovesuki/G14Manager/system/persist"
+	"github.com/zllovesuki/G14Manager/system/plugin"
+	"github.com/zllovesuki/G14Manager/system/shared"
 )
 
 const (
@@ -17,7 +24,11 @@ const (
 type ChargeLimit struct {
 	wmi          atkacpi.WMI
 	currentLimit uint8
+	verified     bool // whether the firmware reported currentLimit after it was written
 	mu           sync.RWMutex
+
+	queue   chan plugin.Notification
+	errChan chan error
 }
 
 // NewChargeLimit initializes the control interface and returns an instance of ChargeLimit
@@ -25,6 +36,8 @@ func NewChargeLimit(wmi atkacpi.WMI) (*ChargeLimit, error) {
 	return &ChargeLimit{
 		wmi:          wmi,
 		currentLimit: 80,
+		queue:        make(chan plugin.Notification),
+		errChan:      make(chan error),
 	}, nil
 }
 
@@ -37,18 +50,29 @@ func (c *ChargeLimit) Set(pct uint8) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	args := make([]byte, 8)
-	binary.LittleEndian.PutUint32(args[0:], atkacpi.DevsBatteryChargeLimit)
-	binary.LittleEndian.PutUint32(args[4:], uint32(pct))
-
-	_, err := c.wmi.Evaluate(atkacpi.DEVS, args)
+	_, err := atkacpi.DevsSet(atkacpi.DevsBatteryChargeLimit, uint32(pct)).Execute(c.wmi)
 	if err != nil {
 		return err
 	}
 	c.currentLimit = pct
+
+	reported, err := c.readLimit()
+	c.verified = err == nil && reported == pct
+	if !c.verified {
+		log.Printf("battery: cannot verify charge limit %d%%, reported %d%%: %v\n", pct, reported, err)
+	}
 	return nil
 }
 
+// readLimit reads the charge limit back from the firmware. c.mu must be held
+func (c *ChargeLimit) readLimit() (uint8, error) {
+	resp, err := atkacpi.DstsGet(atkacpi.DevsBatteryChargeLimit).Execute(c.wmi)
+	if err != nil {
+		return 0, err
+	}
+	return resp.ChargeLimit()
+}
+
 func (c *ChargeLimit) CurrentLimit() uint8 {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -56,6 +80,62 @@ func (c *ChargeLimit) CurrentLimit() uint8 {
 	return c.currentLimit
 }
 
+var _ plugin.Plugin = &ChargeLimit{}
+
+// Initialize satisfies system/plugin.Plugin
+func (c *ChargeLimit) Initialize() error {
+	return nil
+}
+
+func (c *ChargeLimit) loop(haltCtx context.Context, cb chan<- plugin.Callback) {
+	for {
+		select {
+		case t := <-c.queue:
+			r := t.Value.(plugin.HookRequest)
+			pct, err := strconv.Atoi(r.Hook.Value)
+			if err == nil {
+				err = c.Set(uint8(pct))
+			}
+			if err == nil {
+				cb <- plugin.Callback{
+					Event: plugin.CbPersistConfig,
+				}
+			}
+			cb <- plugin.Callback{
+				Event: plugin.CbHookResult,
+				Value: plugin.HookResult{
+					Request: r,
+					Err:     err,
+				},
+			}
+		case <-haltCtx.Done():
+			log.Println("battery: exiting Plugin run loop")
+			return
+		}
+	}
+}
+
+// Run satisfies system/plugin.Plugin
+func (c *ChargeLimit) Run(haltCtx context.Context, cb chan<- plugin.Callback) <-chan error {
+	log.Println("battery: Starting queue loop")
+
+	go c.loop(haltCtx, cb)
+
+	return c.errChan
+}
+
+// Notify satisfies system/plugin.Plugin. Only charge limit hooks are handled
+func (c *ChargeLimit) Notify(t plugin.Notification) {
+	if t.Event != plugin.EvtProfileHook {
+		return
+	}
+	if r, ok := t.Value.(plugin.HookRequest); !ok || r.Hook.Action != plugin.HookChargeLimit {
+		return
+	}
+
+	c.queue <- t
+}
+
 var _ persist.Registry = &ChargeLimit{}
 
 // Name satisfies persist.Registry
@@ -90,6 +170,45 @@ func (c *ChargeLimit) Apply() error {
 	return c.Set(c.currentLimit)
 }
 
+// ApplySetup satisfies system/setup.Device
+func (c *ChargeLimit) ApplySetup(s shared.Setup) (bool, error) {
+	if s.ChargeLimit == 0 {
+		return false, nil
+	}
+	return true, c.Set(s.ChargeLimit)
+}
+
+var _ drift.Checker = &ChargeLimit{}
+
+// CheckDrift satisfies system/drift.Checker. The charge limit is only checked if it was verified when written
+func (c *ChargeLimit) CheckDrift() ([]drift.Drift, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.verified {
+		return nil, nil
+	}
+	reported, err := c.readLimit()
+	if err != nil {
+		return nil, err
+	}
+	if reported == c.currentLimit {
+		return nil, nil
+	}
+	return []drift.Drift{
+		{
+			Setting:  "battery charge limit",
+			Desired:  fmt.Sprintf("%d%%", c.currentLimit),
+			Reported: fmt.Sprintf("%d%%", reported),
+		},
+	}, nil
+}
+
+// Reapply satisfies system/drift.Checker
+func (c *ChargeLimit) Reapply() error {
+	return c.Apply()
+}
+
 // Close satisfied persist.Registry
 func (c *ChargeLimit) Close() error {
 	c.mu.Lock()
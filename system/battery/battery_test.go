@@ -1,8 +1,13 @@
 package battery
 
 import (
+	"context"
+	"path/filepath"
 	"testing"
 
+	"github.com/zllovesuki/G14Manager/system/atkacpi"
+	"github.com/zllovesuki/G14Manager/system/plugin"
+
 	"github.com/stretchr/testify/require"
 )
 
@@ -23,3 +28,87 @@ func TestBatteryPersist(t *testing.T) {
 	require.NoError(t, loaded.Load(b))
 	require.Equal(t, expectedLimit, loaded.currentLimit)
 }
+
+func TestBatteryHook(t *testing.T) {
+	sim := atkacpi.NewSimulator()
+	limit, err := NewChargeLimit(sim)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cb := make(chan plugin.Callback, 4)
+	limit.Run(ctx, cb)
+
+	// hooks of other plugins are ignored
+	limit.Notify(plugin.Notification{
+		Event: plugin.EvtProfileHook,
+		Value: plugin.HookRequest{Hook: plugin.Hook{Action: plugin.HookGPU, Value: "on"}},
+	})
+	require.Len(t, cb, 0)
+
+	request := plugin.HookRequest{
+		Profile: "Quiet",
+		Hook:    plugin.Hook{Action: plugin.HookChargeLimit, Value: "60"},
+	}
+	limit.Notify(plugin.Notification{Event: plugin.EvtProfileHook, Value: request})
+	require.Equal(t, plugin.CbPersistConfig, (<-cb).Event)
+	result := (<-cb).Value.(plugin.HookResult)
+	require.NoError(t, result.Err)
+	require.Equal(t, request, result.Request)
+	require.Equal(t, uint32(60), sim.ChargeLimit())
+
+	request.Hook.Value = "30"
+	limit.Notify(plugin.Notification{Event: plugin.EvtProfileHook, Value: request})
+	result = (<-cb).Value.(plugin.HookResult)
+	require.Error(t, result.Err)
+	require.Equal(t, uint8(60), limit.CurrentLimit())
+}
+
+func TestBatteryDrift(t *testing.T) {
+	sim := atkacpi.NewSimulator()
+	limit, err := NewChargeLimit(sim)
+	require.NoError(t, err)
+
+	// nothing was written yet
+	drifts, err := limit.CheckDrift()
+	require.NoError(t, err)
+	require.Len(t, drifts, 0)
+
+	require.NoError(t, limit.Set(60))
+	drifts, err = limit.CheckDrift()
+	require.NoError(t, err)
+	require.Len(t, drifts, 0)
+
+	// other software resets the charge limit
+	_, err = atkacpi.DevsSet(atkacpi.DevsBatteryChargeLimit, 100).Execute(sim)
+	require.NoError(t, err)
+
+	drifts, err = limit.CheckDrift()
+	require.NoError(t, err)
+	require.Len(t, drifts, 1)
+	require.Equal(t, "battery charge limit reads back as 100%, expected 60%", drifts[0].String())
+
+	require.NoError(t, limit.Reapply())
+	require.Equal(t, uint32(60), sim.ChargeLimit())
+}
+
+func TestBatteryReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.json")
+
+	rec, err := atkacpi.NewRecorder(atkacpi.NewSimulator(), path)
+	require.NoError(t, err)
+	limit, err := NewChargeLimit(rec)
+	require.NoError(t, err)
+	require.NoError(t, limit.Set(60))
+	require.Error(t, limit.Set(30))
+	require.NoError(t, limit.Close())
+
+	replay, err := atkacpi.NewReplayer(path)
+	require.NoError(t, err)
+	limit, err = NewChargeLimit(replay)
+	require.NoError(t, err)
+	require.NoError(t, limit.Set(60))
+
+	require.Empty(t, replay.Mismatches())
+	require.Equal(t, 0, replay.Remaining())
+}
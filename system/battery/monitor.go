@@ -0,0 +1,119 @@
+package battery
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	monitorName = "BatteryMonitor"
+)
+
+// Defines the defaults of the Monitor
+const (
+	DefaultMonitorInterval = time.Second * 30
+	MinimumMonitorInterval = time.Second * 5
+)
+
+// MonitorConfig defines the source of battery status and the polling interval
+type MonitorConfig struct {
+	Source   StatusSource
+	Interval time.Duration
+}
+
+// Monitor polls the battery status periodically, and sends the status to C when it changes.
+// Only the latest status is kept if C is not drained in time
+type Monitor struct {
+	C chan Status
+
+	source   StatusSource
+	interval time.Duration
+
+	mu      sync.RWMutex
+	current Status
+	known   bool
+	lastErr string
+}
+
+// NewMonitor returns a Monitor to be ran under a supervisor
+func NewMonitor(conf MonitorConfig) (*Monitor, error) {
+	if conf.Source == nil {
+		return nil, errors.New("nil StatusSource is invalid")
+	}
+	if conf.Interval == 0 {
+		conf.Interval = DefaultMonitorInterval
+	}
+	if conf.Interval < MinimumMonitorInterval {
+		conf.Interval = MinimumMonitorInterval
+	}
+	return &Monitor{
+		C:        make(chan Status, 1),
+		source:   conf.Source,
+		interval: conf.Interval,
+	}, nil
+}
+
+func (m *Monitor) String() string {
+	return monitorName
+}
+
+// Serve satisfies suture.Service
+func (m *Monitor) Serve(haltCtx context.Context) error {
+	log.Println("[batteryMonitor] starting monitor loop")
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	m.poll()
+	for {
+		select {
+		case <-haltCtx.Done():
+			log.Println("[batteryMonitor] stopping monitor loop")
+			return nil
+		case <-ticker.C:
+			m.poll()
+		}
+	}
+}
+
+func (m *Monitor) poll() {
+	s, err := m.source.Status()
+
+	m.mu.Lock()
+	if err != nil {
+		// avoid flooding the log when the battery status is not available
+		if err.Error() != m.lastErr {
+			log.Printf("[batteryMonitor] cannot read battery status: %+v\n", err)
+			m.lastErr = err.Error()
+		}
+		m.mu.Unlock()
+		return
+	}
+	m.lastErr = ""
+	changed := !m.known || s != m.current
+	m.current = s
+	m.known = true
+	m.mu.Unlock()
+
+	if !changed {
+		return
+	}
+
+	// only the latest status matters
+	select {
+	case <-m.C:
+	default:
+	}
+	m.C <- s
+}
+
+// Current returns the latest status. ok is false if the status was not read yet
+func (m *Monitor) Current() (s Status, ok bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.current, m.known
+}
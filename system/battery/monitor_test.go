@@ -0,0 +1,44 @@
+package battery
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMonitor(t *testing.T) {
+	_, err := NewMonitor(MonitorConfig{})
+	require.Error(t, err)
+
+	source := NewFakeSource(Status{Percentage: 50})
+	m, err := NewMonitor(MonitorConfig{Source: source, Interval: 1})
+	require.NoError(t, err)
+	require.Equal(t, MinimumMonitorInterval, m.interval)
+
+	_, ok := m.Current()
+	require.False(t, ok)
+
+	m.poll()
+	require.Equal(t, Status{Percentage: 50}, <-m.C)
+
+	// unchanged status is not sent again
+	m.poll()
+	require.Len(t, m.C, 0)
+
+	// only the latest status is kept
+	source.Set(Status{Percentage: 49})
+	m.poll()
+	source.Set(Status{Percentage: 49, Charging: true})
+	m.poll()
+	require.Len(t, m.C, 1)
+	require.Equal(t, Status{Percentage: 49, Charging: true}, <-m.C)
+
+	// errors keep the last status
+	source.Err = errors.New("no battery")
+	m.poll()
+	require.Len(t, m.C, 0)
+	s, ok := m.Current()
+	require.True(t, ok)
+	require.Equal(t, "49% (charging)", s.String())
+}
@@ -0,0 +1,57 @@
+package battery
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Status is the charge of the battery. It is the Value of plugin.EvtBatteryLevel
+type Status struct {
+	Percentage uint8
+	Charging   bool
+}
+
+func (s Status) String() string {
+	if s.Charging {
+		return fmt.Sprintf("%d%% (charging)", s.Percentage)
+	}
+	return fmt.Sprintf("%d%%", s.Percentage)
+}
+
+// StatusSource returns the current battery status
+type StatusSource interface {
+	Status() (Status, error)
+}
+
+// FakeSource is a StatusSource with the status set manually. It is used in tests
+type FakeSource struct {
+	mu     sync.Mutex
+	status Status
+	Err    error
+}
+
+var _ StatusSource = &FakeSource{}
+
+// NewFakeSource returns a FakeSource reporting the status
+func NewFakeSource(s Status) *FakeSource {
+	return &FakeSource{
+		status: s,
+	}
+}
+
+// Set changes the reported status
+func (f *FakeSource) Set(s Status) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.status = s
+}
+
+// Status returns the status set last
+func (f *FakeSource) Status() (Status, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return Status{}, f.Err
+	}
+	return f.status, nil
+}
@@ -0,0 +1,45 @@
+//go:build linux
+// +build linux
+
+package battery
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultPowerSupplyPath is where the kernel exposes the batteries
+const DefaultPowerSupplyPath = "/sys/class/power_supply"
+
+type sysfsSource struct {
+	path string
+}
+
+// NewStatusSource returns a StatusSource that reads the first battery in sysfs
+func NewStatusSource() StatusSource {
+	return sysfsSource{path: DefaultPowerSupplyPath}
+}
+
+func (s sysfsSource) Status() (Status, error) {
+	batteries, err := filepath.Glob(filepath.Join(s.path, "BAT*"))
+	if err != nil || len(batteries) == 0 {
+		return Status{}, fmt.Errorf("battery: no battery found in %s", s.path)
+	}
+	capacity, err := ioutil.ReadFile(filepath.Join(batteries[0], "capacity"))
+	if err != nil {
+		return Status{}, fmt.Errorf("battery: cannot read capacity: %w", err)
+	}
+	pct, err := strconv.Atoi(strings.TrimSpace(string(capacity)))
+	if err != nil || pct < 0 || pct > 100 {
+		return Status{}, fmt.Errorf("battery: invalid capacity %q", strings.TrimSpace(string(capacity)))
+	}
+	// status is not fatal, as some firmware does not report it
+	status, _ := ioutil.ReadFile(filepath.Join(batteries[0], "status"))
+	return Status{
+		Percentage: uint8(pct),
+		Charging:   strings.TrimSpace(string(status)) == "Charging",
+	}, nil
+}
@@ -0,0 +1,57 @@
+//go:build windows
+// +build windows
+
+package battery
+
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	libKernel32          = windows.NewLazySystemDLL("kernel32.dll")
+	getSystemPowerStatus = libKernel32.NewProc("GetSystemPowerStatus")
+)
+
+// Defines the values of SYSTEM_POWER_STATUS we care about
+const (
+	batteryFlagCharging  = 8
+	batteryFlagNoBattery = 128
+	batteryFlagUnknown   = 255
+	batteryLifeUnknown   = 255
+)
+
+// systemPowerStatus is SYSTEM_POWER_STATUS
+type systemPowerStatus struct {
+	ACLineStatus        byte
+	BatteryFlag         byte
+	BatteryLifePercent  byte
+	SystemStatusFlag    byte
+	BatteryLifeTime     uint32
+	BatteryFullLifeTime uint32
+}
+
+type powerStatusSource struct{}
+
+// NewStatusSource returns a StatusSource backed by GetSystemPowerStatus
+func NewStatusSource() StatusSource {
+	return powerStatusSource{}
+}
+
+func (powerStatusSource) Status() (Status, error) {
+	var s systemPowerStatus
+	ret, _, err := getSystemPowerStatus.Call(uintptr(unsafe.Pointer(&s)))
+	if ret == 0 {
+		return Status{}, fmt.Errorf("battery: cannot get system power status: %w", err)
+	}
+	if s.BatteryFlag == batteryFlagUnknown || s.BatteryFlag&batteryFlagNoBattery != 0 || s.BatteryLifePercent == batteryLifeUnknown {
+		return Status{}, errors.New("battery: battery status is not available")
+	}
+	return Status{
+		Percentage: s.BatteryLifePercent,
+		Charging:   s.BatteryFlag&batteryFlagCharging != 0,
+	}, nil
+}
@@ -0,0 +1,231 @@
+package drift
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zllovesuki/G14Manager/rpc/announcement"
+	"github.com/zllovesuki/G14Manager/system/shared"
+	"github.com/zllovesuki/G14Manager/util"
+)
+
+const (
+	watchdogName = "DriftWatchdog"
+)
+
+// Defines the defaults of the Watchdog
+const (
+	DefaultInterval = time.Minute
+	MinimumInterval = time.Second * 5
+)
+
+// Drift is a setting that the hardware reports differently than it was applied,
+// usually because other software (e.g. Armoury Crate, or the BIOS on resume) overwrote it
+type Drift struct {
+	Setting  string
+	Desired  string
+	Reported string
+}
+
+func (d Drift) String() string {
+	return fmt.Sprintf("%s reads back as %s, expected %s", d.Setting, d.Reported, d.Desired)
+}
+
+// Checker holds the desired state of some hardware settings, and can compare them with the hardware
+type Checker interface {
+	// CheckDrift reads the settings back from the hardware, and returns the ones that drifted.
+	// Settings that could not be verified when they were applied are not checked
+	CheckDrift() ([]Drift, error)
+	// Reapply writes the desired state to the hardware again
+	Reapply() error
+}
+
+// Config defines the Checkers to poll, the polling interval, and where to notify the user
+type Config struct {
+	Checkers []Checker
+	Interval time.Duration
+	Notifier chan<- util.Notification
+}
+
+// Watchdog polls the Checkers periodically, and reapplies the desired state when it drifts.
+// The interval and whether it is enabled are configured by shared.Features
+type Watchdog struct {
+	checkers []Checker
+	notifier chan<- util.Notification
+
+	mu       sync.RWMutex
+	interval time.Duration
+	disabled bool
+
+	lastErr []string
+
+	intervalCh chan time.Duration
+}
+
+// NewWatchdog returns a Watchdog to be ran under a supervisor
+func NewWatchdog(conf Config) (*Watchdog, error) {
+	if conf.Notifier == nil {
+		return nil, errors.New("nil Notifier is invalid")
+	}
+	if conf.Interval == 0 {
+		conf.Interval = DefaultInterval
+	}
+	if conf.Interval < MinimumInterval {
+		conf.Interval = MinimumInterval
+	}
+	return &Watchdog{
+		checkers:   conf.Checkers,
+		notifier:   conf.Notifier,
+		interval:   conf.Interval,
+		lastErr:    make([]string, len(conf.Checkers)),
+		intervalCh: make(chan time.Duration, 1),
+	}, nil
+}
+
+func (w *Watchdog) String() string {
+	return watchdogName
+}
+
+// Serve satisfies suture.Service
+func (w *Watchdog) Serve(haltCtx context.Context) error {
+	w.mu.RLock()
+	log.Printf("[driftWatchdog] starting watchdog loop, checking every %s\n", w.interval)
+	ticker := time.NewTicker(w.interval)
+	w.mu.RUnlock()
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-haltCtx.Done():
+			log.Println("[driftWatchdog] stopping watchdog loop")
+			return nil
+		case interval := <-w.intervalCh:
+			log.Printf("[driftWatchdog] checking interval changed to %s\n", interval)
+			ticker.Reset(interval)
+		case <-ticker.C:
+			w.check()
+		}
+	}
+}
+
+// Interval returns the current checking interval
+func (w *Watchdog) Interval() time.Duration {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	return w.interval
+}
+
+// SetInterval changes the checking interval. Interval shorter than MinimumInterval will be clamped
+func (w *Watchdog) SetInterval(interval time.Duration) {
+	if interval == 0 {
+		interval = DefaultInterval
+	}
+	if interval < MinimumInterval {
+		interval = MinimumInterval
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.interval == interval {
+		return
+	}
+	w.interval = interval
+
+	// only the latest change matters
+	select {
+	case <-w.intervalCh:
+	default:
+	}
+	w.intervalCh <- interval
+}
+
+// Enabled returns whether the Watchdog checks for drift
+func (w *Watchdog) Enabled() bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	return !w.disabled
+}
+
+// SetEnabled enables or disables checking for drift. The loop keeps running while disabled
+func (w *Watchdog) SetEnabled(enabled bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.disabled == !enabled {
+		return
+	}
+	w.disabled = !enabled
+	log.Printf("[driftWatchdog] watchdog enabled: %t\n", enabled)
+}
+
+var _ announcement.Updatable = &Watchdog{}
+
+// Name satisfies announcement.Updatable
+func (w *Watchdog) Name() string {
+	return watchdogName
+}
+
+// ConfigUpdate satisfies announcement.Updatable
+func (w *Watchdog) ConfigUpdate(u announcement.Update) {
+	if u.Type != announcement.FeaturesUpdate {
+		return
+	}
+
+	feats, ok := u.Config.(shared.Features)
+	if !ok {
+		return
+	}
+
+	w.SetEnabled(!feats.DriftWatchdog.Disabled)
+	w.SetInterval(feats.DriftWatchdog.Interval)
+}
+
+// check compares each Checker with the hardware, and reapplies the ones that drifted
+func (w *Watchdog) check() {
+	if !w.Enabled() {
+		return
+	}
+
+	for i, c := range w.checkers {
+		drifts, err := c.CheckDrift()
+		if err != nil {
+			// avoid flooding the log when a setting cannot be read back
+			if err.Error() != w.lastErr[i] {
+				log.Printf("[driftWatchdog] cannot check for drift: %+v\n", err)
+				w.lastErr[i] = err.Error()
+			}
+			continue
+		}
+		w.lastErr[i] = ""
+		if len(drifts) == 0 {
+			continue
+		}
+
+		settings := make([]string, 0, len(drifts))
+		for _, d := range drifts {
+			log.Printf("[driftWatchdog] drift detected: %s\n", d)
+			settings = append(settings, d.Setting)
+		}
+
+		if err := c.Reapply(); err != nil {
+			log.Printf("[driftWatchdog] cannot reapply %s: %+v\n", strings.Join(settings, ", "), err)
+			w.notifier <- util.Notification{
+				Message: fmt.Sprintf("Cannot restore %s: %s", strings.Join(settings, ", "), err),
+			}
+			continue
+		}
+
+		log.Printf("[driftWatchdog] reapplied %s\n", strings.Join(settings, ", "))
+		w.notifier <- util.Notification{
+			Message: fmt.Sprintf("Restored %s changed by another program", strings.Join(settings, ", ")),
+		}
+	}
+}
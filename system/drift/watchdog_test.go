@@ -0,0 +1,131 @@
+package drift
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zllovesuki/G14Manager/rpc/announcement"
+	"github.com/zllovesuki/G14Manager/system/shared"
+	"github.com/zllovesuki/G14Manager/util"
+)
+
+type fakeChecker struct {
+	drifts     []Drift
+	err        error
+	reapplyErr error
+	reapplied  int
+}
+
+func (f *fakeChecker) CheckDrift() ([]Drift, error) {
+	return f.drifts, f.err
+}
+
+func (f *fakeChecker) Reapply() error {
+	f.reapplied++
+	if f.reapplyErr == nil {
+		f.drifts = nil
+	}
+	return f.reapplyErr
+}
+
+func TestWatchdog(t *testing.T) {
+	_, err := NewWatchdog(Config{})
+	require.Error(t, err)
+
+	notifier := make(chan util.Notification, 10)
+	thermal := &fakeChecker{}
+	battery := &fakeChecker{}
+	w, err := NewWatchdog(Config{
+		Checkers: []Checker{thermal, battery},
+		Interval: time.Second,
+		Notifier: notifier,
+	})
+	require.NoError(t, err)
+	require.Equal(t, MinimumInterval, w.Interval())
+
+	// nothing drifted
+	w.check()
+	require.Len(t, notifier, 0)
+
+	thermal.drifts = []Drift{
+		{Setting: "throttle plan", Desired: "Silent", Reported: "Turbo"},
+		{Setting: "CPU fan curve", Desired: "a", Reported: "b"},
+	}
+	w.check()
+	require.Equal(t, 1, thermal.reapplied)
+	require.Equal(t, 0, battery.reapplied)
+	require.Equal(t, "Restored throttle plan, CPU fan curve changed by another program", (<-notifier).Message)
+
+	// reapplying clears the drift
+	w.check()
+	require.Equal(t, 1, thermal.reapplied)
+	require.Len(t, notifier, 0)
+
+	battery.drifts = []Drift{{Setting: "battery charge limit", Desired: "60", Reported: "100"}}
+	battery.reapplyErr = errors.New("ACPI error")
+	w.check()
+	require.Equal(t, 1, battery.reapplied)
+	require.Equal(t, "Cannot restore battery charge limit: ACPI error", (<-notifier).Message)
+
+	// read back errors are not reapplied
+	thermal.drifts = []Drift{{Setting: "throttle plan"}}
+	thermal.err = errors.New("not present")
+	w.check()
+	w.check()
+	require.Equal(t, 1, thermal.reapplied)
+	require.Equal(t, "not present", w.lastErr[0])
+}
+
+func TestWatchdogConfigUpdate(t *testing.T) {
+	thermal := &fakeChecker{
+		drifts: []Drift{{Setting: "throttle plan", Desired: "Silent", Reported: "Turbo"}},
+	}
+	w, err := NewWatchdog(Config{
+		Checkers: []Checker{thermal},
+		Notifier: make(chan util.Notification, 10),
+	})
+	require.NoError(t, err)
+	require.Equal(t, DefaultInterval, w.Interval())
+	require.True(t, w.Enabled())
+
+	w.ConfigUpdate(announcement.Update{
+		Type: announcement.FeaturesUpdate,
+		Config: shared.Features{
+			DriftWatchdog: shared.DriftWatchdog{
+				Disabled: true,
+				Interval: time.Second * 30,
+			},
+		},
+	})
+	require.False(t, w.Enabled())
+	require.Equal(t, time.Second*30, w.Interval())
+	require.Equal(t, time.Second*30, <-w.intervalCh)
+
+	// nothing is checked while disabled
+	w.check()
+	require.Equal(t, 0, thermal.reapplied)
+
+	// zero value enables the watchdog with the default interval
+	w.ConfigUpdate(announcement.Update{
+		Type:   announcement.FeaturesUpdate,
+		Config: shared.Features{},
+	})
+	require.True(t, w.Enabled())
+	require.Equal(t, DefaultInterval, w.Interval())
+
+	w.check()
+	require.Equal(t, 1, thermal.reapplied)
+
+	// other updates are ignored
+	w.ConfigUpdate(announcement.Update{
+		Type: announcement.ProfilesUpdate,
+	})
+	require.True(t, w.Enabled())
+}
+
+func TestDriftString(t *testing.T) {
+	d := Drift{Setting: "keyboard brightness", Desired: "HIGH", Reported: "OFF"}
+	require.Equal(t, "keyboard brightness reads back as OFF, expected HIGH", d.String())
+}
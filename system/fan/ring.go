@@ -0,0 +1,45 @@
+package fan
+
+// ring is a fixed size circular buffer of samples. Once full, the oldest sample is overwritten.
+type ring struct {
+	samples []Sample
+	next    int
+	full    bool
+}
+
+func newRing(size int) *ring {
+	return &ring{
+		samples: make([]Sample, size),
+	}
+}
+
+func (r *ring) push(s Sample) {
+	r.samples[r.next] = s
+	r.next = (r.next + 1) % len(r.samples)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+func (r *ring) len() int {
+	if r.full {
+		return len(r.samples)
+	}
+	return r.next
+}
+
+func (r *ring) last() (Sample, bool) {
+	if r.len() == 0 {
+		return Sample{}, false
+	}
+	return r.samples[(r.next-1+len(r.samples))%len(r.samples)], true
+}
+
+// all returns a copy of the samples, oldest first
+func (r *ring) all() []Sample {
+	out := make([]Sample, 0, r.len())
+	if r.full {
+		out = append(out, r.samples[r.next:]...)
+	}
+	return append(out, r.samples[:r.next]...)
+}
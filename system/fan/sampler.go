@@ -0,0 +1,211 @@
+package fan
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/zllovesuki/G14Manager/rpc/announcement"
+	"github.com/zllovesuki/G14Manager/system/atkacpi"
+	"github.com/zllovesuki/G14Manager/system/shared"
+)
+
+const (
+	samplerName = "FanSampler"
+)
+
+// Defines the defaults of the Sampler
+const (
+	DefaultInterval    = time.Second * 2
+	DefaultHistorySize = 300
+	MinimumInterval    = time.Millisecond * 500
+)
+
+// Sample is the fan speed of both fans in RPM at a point in time
+type Sample struct {
+	Time time.Time
+	CPU  uint32
+	GPU  uint32
+}
+
+// Config defines the polling interval and how many samples to keep in history
+type Config struct {
+	WMI         atkacpi.WMI
+	Interval    time.Duration
+	HistorySize int
+}
+
+// Sampler polls the current fan speed of CPU and GPU fans periodically,
+// and keeps a history of the samples. The Sampler is safe for multiple goroutines.
+type Sampler struct {
+	wmi atkacpi.WMI
+
+	mu       sync.RWMutex
+	interval time.Duration
+	history  *ring
+	lastErr  string
+
+	intervalCh chan time.Duration
+}
+
+// NewSampler returns a Sampler to be ran under a supervisor
+func NewSampler(conf Config) (*Sampler, error) {
+	if conf.WMI == nil {
+		return nil, errors.New("nil WMI is invalid")
+	}
+	if conf.Interval == 0 {
+		conf.Interval = DefaultInterval
+	}
+	if conf.Interval < MinimumInterval {
+		conf.Interval = MinimumInterval
+	}
+	if conf.HistorySize <= 0 {
+		conf.HistorySize = DefaultHistorySize
+	}
+	return &Sampler{
+		wmi:        conf.WMI,
+		interval:   conf.Interval,
+		history:    newRing(conf.HistorySize),
+		intervalCh: make(chan time.Duration, 1),
+	}, nil
+}
+
+func (s *Sampler) String() string {
+	return samplerName
+}
+
+// Serve satisfies suture.Service
+func (s *Sampler) Serve(haltCtx context.Context) error {
+	log.Println("[fanSampler] starting sampler loop")
+
+	s.mu.RLock()
+	ticker := time.NewTicker(s.interval)
+	s.mu.RUnlock()
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-haltCtx.Done():
+			log.Println("[fanSampler] stopping sampler loop")
+			return nil
+		case interval := <-s.intervalCh:
+			log.Printf("[fanSampler] sampling interval changed to %s\n", interval)
+			ticker.Reset(interval)
+		case t := <-ticker.C:
+			s.sample(t)
+		}
+	}
+}
+
+func (s *Sampler) sample(t time.Time) {
+	cpu, cpuErr := s.read(atkacpi.DstsCurrentCPUFanSpeed)
+	gpu, gpuErr := s.read(atkacpi.DstsCurrentGPUFanSpeed)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := firstError(cpuErr, gpuErr); err != nil {
+		// avoid flooding the log when the fan speed is not available
+		if err.Error() != s.lastErr {
+			log.Printf("[fanSampler] cannot read fan speed: %+v\n", err)
+			s.lastErr = err.Error()
+		}
+		return
+	}
+	s.lastErr = ""
+
+	s.history.push(Sample{
+		Time: t,
+		CPU:  cpu,
+		GPU:  gpu,
+	})
+}
+
+func (s *Sampler) read(dev uint32) (uint32, error) {
+	resp, err := atkacpi.DstsGet(dev).Execute(s.wmi)
+	if err != nil {
+		return 0, err
+	}
+	return resp.FanSpeed()
+}
+
+// Current returns the latest sample. ok is false if no samples were taken yet
+func (s *Sampler) Current() (sample Sample, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.history.last()
+}
+
+// History returns all the samples in history, oldest first
+func (s *Sampler) History() []Sample {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.history.all()
+}
+
+// Interval returns the current sampling interval
+func (s *Sampler) Interval() time.Duration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.interval
+}
+
+// SetInterval changes the sampling interval. Interval shorter than MinimumInterval will be clamped
+func (s *Sampler) SetInterval(interval time.Duration) {
+	if interval == 0 {
+		interval = DefaultInterval
+	}
+	if interval < MinimumInterval {
+		interval = MinimumInterval
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.interval == interval {
+		return
+	}
+	s.interval = interval
+
+	// only the latest change matters
+	select {
+	case <-s.intervalCh:
+	default:
+	}
+	s.intervalCh <- interval
+}
+
+var _ announcement.Updatable = &Sampler{}
+
+// Name satisfies announcement.Updatable
+func (s *Sampler) Name() string {
+	return samplerName
+}
+
+// ConfigUpdate satisfies announcement.Updatable
+func (s *Sampler) ConfigUpdate(u announcement.Update) {
+	if u.Type != announcement.FeaturesUpdate {
+		return
+	}
+
+	feats, ok := u.Config.(shared.Features)
+	if !ok {
+		return
+	}
+
+	s.SetInterval(feats.FanSampler.Interval)
+}
+
+func firstError(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
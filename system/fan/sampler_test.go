@@ -0,0 +1,60 @@
+package fan
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zllovesuki/G14Manager/system/atkacpi"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRing(t *testing.T) {
+	r := newRing(3)
+
+	_, ok := r.last()
+	require.False(t, ok)
+	require.Empty(t, r.all())
+
+	for i := uint32(1); i <= 5; i++ {
+		r.push(Sample{CPU: i})
+	}
+
+	last, ok := r.last()
+	require.True(t, ok)
+	require.Equal(t, uint32(5), last.CPU)
+
+	all := r.all()
+	require.Len(t, all, 3)
+	require.Equal(t, uint32(3), all[0].CPU)
+	require.Equal(t, uint32(4), all[1].CPU)
+	require.Equal(t, uint32(5), all[2].CPU)
+}
+
+func TestSampler(t *testing.T) {
+	sim := atkacpi.NewSimulator()
+	sim.SetTemperatures(98, 98)
+
+	s, err := NewSampler(Config{
+		WMI:         sim,
+		HistorySize: 2,
+	})
+	require.NoError(t, err)
+	require.Equal(t, DefaultInterval, s.Interval())
+
+	now := time.Now()
+	s.sample(now)
+	s.sample(now.Add(time.Second))
+	s.sample(now.Add(time.Second * 2))
+
+	current, ok := s.Current()
+	require.True(t, ok)
+	require.Equal(t, now.Add(time.Second*2), current.Time)
+	// factory curve of Performance throttle plan at 98C is 56% (CPU) and 61% (GPU) of 6400 RPM
+	require.Equal(t, uint32(3500), current.CPU)
+	require.Equal(t, uint32(3900), current.GPU)
+	require.Len(t, s.History(), 2)
+
+	s.SetInterval(time.Millisecond)
+	require.Equal(t, MinimumInterval, s.Interval())
+}
@@ -28,3 +28,24 @@ const (
 	KeyPgUp   uint16 = 0x49
 	KeyPgDown uint16 = 0x51
 )
+
+// KeyNames maps the name of each key to its key code on GA401.
+// Model descriptors use the names to describe the key codes of other models
+var KeyNames = map[string]uint32{
+	"ROG":        KeyROG,
+	"FnF5":       KeyFnF5,
+	"VolUp":      KeyVolUp,
+	"VolDown":    KeyVolDown,
+	"MuteMic":    KeyMuteMic,
+	"TpadToggle": KeyTpadToggle,
+	"LCDUp":      KeyLCDUp,
+	"LCDDown":    KeyLCDDown,
+	"Sleep":      KeySleep,
+	"RFKill":     KeyRFKill,
+	"FnLeft":     KeyFnLeft,
+	"FnRight":    KeyFnRight,
+	"FnUp":       KeyFnUp,
+	"FnDown":     KeyFnDown,
+	"FnC":        KeyFnC,
+	"FnV":        KeyFnV,
+}
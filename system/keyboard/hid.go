@@ -14,24 +14,38 @@ const (
 	reportID      = 0x5a
 )
 
-var (
-	hidDevices = []string{
+// Device describes the HID interfaces of the keyboard
+type Device struct {
+	VendorID  uint16
+	ProductID uint16
+	// Collections are the HID collections to read key codes from
+	Collections []string
+	// Control is the HID collection accepting backlight and touchpad control
+	Control string
+}
+
+// DefaultDevice is the NKEY keyboard on GA401
+var DefaultDevice = Device{
+	VendorID:  VendorID,
+	ProductID: ProductID,
+	Collections: []string{
 		"mi_02&col01", // Special key combo
 		"mi_02&col02", // Volume up/down?
-	}
-)
+	},
+	Control: "mi_02&col01",
+}
 
 // NewHidListener will read HID report and return key code to the channel
-func NewHidListener(haltCtx context.Context, eventCh chan uint32) (map[string]usb.DeviceInfo, error) {
+func NewHidListener(haltCtx context.Context, kbDevice Device, eventCh chan uint32) (map[string]usb.DeviceInfo, error) {
 	devicesFound := make(map[string]usb.DeviceInfo)
-	devices, err := usb.EnumerateHid(VendorID, ProductID)
+	devices, err := usb.EnumerateHid(kbDevice.VendorID, kbDevice.ProductID)
 	if err != nil {
 		return nil, err
 	}
 
 	for _, device := range devices {
 		// TODO: make it less inefficient
-		for _, hid := range hidDevices {
+		for _, hid := range kbDevice.Collections {
 			if !strings.Contains(device.Path, hid) {
 				continue
 			}
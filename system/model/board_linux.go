@@ -0,0 +1,20 @@
+//go:build linux
+// +build linux
+
+package model
+
+import (
+	"io/ioutil"
+	"strings"
+)
+
+const boardNamePath = "/sys/class/dmi/id/board_name"
+
+// BoardName returns the board name of the computer (e.g. GA401IV) from SMBIOS
+func BoardName() (string, error) {
+	b, err := ioutil.ReadFile(boardNamePath)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
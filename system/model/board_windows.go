@@ -0,0 +1,23 @@
+//go:build windows
+// +build windows
+
+package model
+
+import (
+	"golang.org/x/sys/windows/registry"
+)
+
+// BoardName returns the board name of the computer (e.g. GA401IV) from SMBIOS
+func BoardName() (string, error) {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, `HARDWARE\DESCRIPTION\System\BIOS`, registry.QUERY_VALUE)
+	if err != nil {
+		return "", err
+	}
+	defer k.Close()
+
+	board, _, err := k.GetStringValue("BaseBoardProduct")
+	if err != nil {
+		return "", err
+	}
+	return board, nil
+}
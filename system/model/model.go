@@ -0,0 +1,265 @@
+package model
+
+import (
+	"bytes"
+	_ "embed" // for embedding the model database
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/zllovesuki/G14Manager/system/atkacpi"
+	"github.com/zllovesuki/G14Manager/system/keyboard"
+)
+
+//go:embed models.json
+var embeddedModels []byte
+
+// HexID is an ID (e.g. USB product ID or ATK device ID) written as a hex string in JSON, such as "0x00120075"
+type HexID uint32
+
+// UnmarshalJSON satisfies json.Unmarshaler
+func (h *HexID) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("ID must be a hex string: %w", err)
+	}
+	v, err := strconv.ParseUint(s, 0, 32)
+	if err != nil {
+		return fmt.Errorf("invalid ID %s: %w", s, err)
+	}
+	*h = HexID(v)
+	return nil
+}
+
+// MarshalJSON satisfies json.Marshaler
+func (h HexID) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fmt.Sprintf("0x%08x", uint32(h)))
+}
+
+// HID describes the HID interfaces of the keyboard
+type HID struct {
+	VendorID    HexID
+	ProductID   HexID
+	Collections []string
+	Control     string
+}
+
+// Profile describes a default thermal profile, in the same format as exported profiles (without hooks).
+// It is parsed by the controller, as fan curves are validated by system/thermal
+type Profile struct {
+	ID               string `json:",omitempty"`
+	Name             string
+	WindowsPowerPlan string
+	ThrottlePlan     string
+	CPUFanCurve      string `json:",omitempty"`
+	GPUFanCurve      string `json:",omitempty"`
+}
+
+// Descriptor describes the hardware of a model
+type Descriptor struct {
+	// Name is the human readable name of the model
+	Name string
+	// Boards are the prefixes of the board names (e.g. GA401 matches GA401IV)
+	Boards []string
+	HID    HID
+	// KeyCodes maps the key names in keyboard.KeyNames to the key codes of this model.
+	// If empty, the key codes are the same as GA401
+	KeyCodes map[string]uint32
+	// Devices are the supported ATK device IDs. If empty, probing decides
+	Devices []HexID
+	// FanCurves is false if the model does not support custom fan curves
+	FanCurves bool
+	// Profiles are the default thermal profiles. If empty, thermal.GetDefaultThermalProfiles is used
+	Profiles []Profile
+}
+
+// Validate checks if the descriptor is usable
+func (d Descriptor) Validate() error {
+	if d.Name == "" {
+		return errors.New("model name must not be empty")
+	}
+	if len(d.Boards) == 0 {
+		return fmt.Errorf("model %s: boards must not be empty", d.Name)
+	}
+	if d.HID.VendorID == 0 || d.HID.VendorID > 0xffff || d.HID.ProductID == 0 || d.HID.ProductID > 0xffff {
+		return fmt.Errorf("model %s: invalid HID vendor/product ID", d.Name)
+	}
+	if len(d.HID.Collections) == 0 || d.HID.Control == "" {
+		return fmt.Errorf("model %s: HID collections and control must not be empty", d.Name)
+	}
+	for name := range d.KeyCodes {
+		if _, ok := keyboard.KeyNames[name]; !ok {
+			return fmt.Errorf("model %s: unknown key %s", d.Name, name)
+		}
+	}
+	for _, p := range d.Profiles {
+		if p.Name == "" || p.ThrottlePlan == "" {
+			return fmt.Errorf("model %s: profile name and throttle plan must not be empty", d.Name)
+		}
+	}
+	return nil
+}
+
+// Matches returns true if the board name matches one of the boards of the model
+func (d Descriptor) Matches(board string) bool {
+	return d.matchLength(board) > 0
+}
+
+// matchLength returns the length of the longest board prefix matching the board name
+func (d Descriptor) matchLength(board string) int {
+	board = strings.ToUpper(strings.TrimSpace(board))
+	longest := 0
+	for _, b := range d.Boards {
+		if b != "" && len(b) > longest && strings.HasPrefix(board, strings.ToUpper(b)) {
+			longest = len(b)
+		}
+	}
+	return longest
+}
+
+// Keyboard returns the HID interfaces of the keyboard. A zero Descriptor returns keyboard.DefaultDevice
+func (d Descriptor) Keyboard() keyboard.Device {
+	if d.HID.VendorID == 0 {
+		return keyboard.DefaultDevice
+	}
+	return keyboard.Device{
+		VendorID:    uint16(d.HID.VendorID),
+		ProductID:   uint16(d.HID.ProductID),
+		Collections: d.HID.Collections,
+		Control:     d.HID.Control,
+	}
+}
+
+// KeyCodeMap returns a map translating the key codes of this model to the key codes in system/keyboard.
+// It returns nil if no translation is needed
+func (d Descriptor) KeyCodeMap() map[uint32]uint32 {
+	if len(d.KeyCodes) == 0 {
+		return nil
+	}
+	m := make(map[uint32]uint32, len(d.KeyCodes))
+	for name, code := range d.KeyCodes {
+		m[code] = keyboard.KeyNames[name]
+	}
+	return m
+}
+
+// Restrict marks the ATK device IDs that the model does not support as unsupported
+func (d Descriptor) Restrict(caps atkacpi.Capabilities) atkacpi.Capabilities {
+	restricted := make(atkacpi.Capabilities, len(caps))
+	for dev, supported := range caps {
+		restricted[dev] = supported
+	}
+	if len(d.Devices) > 0 {
+		listed := make(map[uint32]bool, len(d.Devices))
+		for _, dev := range d.Devices {
+			listed[uint32(dev)] = true
+		}
+		for dev := range restricted {
+			if !listed[dev] {
+				restricted[dev] = false
+			}
+		}
+	}
+	if !d.FanCurves {
+		restricted[atkacpi.DevsCPUFanCurve] = false
+		restricted[atkacpi.DevsGPUFanCurve] = false
+	}
+	return restricted
+}
+
+// Database is a list of model descriptors
+type Database struct {
+	models []Descriptor
+}
+
+// Parse reads a list of model descriptors in JSON
+func Parse(r io.Reader) ([]Descriptor, error) {
+	var models []Descriptor
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&models); err != nil {
+		return nil, err
+	}
+	for _, m := range models {
+		if err := m.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return models, nil
+}
+
+// Load returns the embedded model database. If overridePath is not empty and the file exists,
+// descriptors in the file take precedence over the embedded ones on a tie, and replace embedded descriptors with the same name
+func Load(overridePath string) (*Database, error) {
+	embedded, err := Parse(bytes.NewReader(embeddedModels))
+	if err != nil {
+		return nil, fmt.Errorf("invalid embedded model database: %w", err)
+	}
+	if overridePath == "" {
+		return &Database{models: embedded}, nil
+	}
+
+	b, err := ioutil.ReadFile(overridePath)
+	if os.IsNotExist(err) {
+		return &Database{models: embedded}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	overrides, err := Parse(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("invalid model database %s: %w", overridePath, err)
+	}
+	log.Printf("model: loaded %d model(s) from %s\n", len(overrides), overridePath)
+
+	models := make([]Descriptor, 0, len(overrides)+len(embedded))
+	models = append(models, overrides...)
+	for _, e := range embedded {
+		replaced := false
+		for _, o := range overrides {
+			if o.Name == e.Name {
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			models = append(models, e)
+		}
+	}
+	return &Database{models: models}, nil
+}
+
+// Lookup returns the descriptor matching the board name. The most specific board prefix wins,
+// and overrides win over embedded descriptors on a tie
+func (db *Database) Lookup(board string) (Descriptor, bool) {
+	var found Descriptor
+	longest := 0
+	for _, m := range db.models {
+		if l := m.matchLength(board); l > longest {
+			found = m
+			longest = l
+		}
+	}
+	return found, longest > 0
+}
+
+// Default returns the descriptor of GA401, which is the best tested model
+func (db *Database) Default() Descriptor {
+	if m, ok := db.Lookup("GA401"); ok {
+		return m
+	}
+	return db.models[0]
+}
+
+// Models returns all the descriptors in the database
+func (db *Database) Models() []Descriptor {
+	models := make([]Descriptor, len(db.models))
+	copy(models, db.models)
+	return models
+}
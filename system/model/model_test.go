@@ -0,0 +1,112 @@
+package model
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zllovesuki/G14Manager/system/atkacpi"
+	"github.com/zllovesuki/G14Manager/system/keyboard"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbeddedDatabase(t *testing.T) {
+	db, err := Load("")
+	require.NoError(t, err)
+
+	def := db.Default()
+	require.True(t, def.Matches("GA401IV"))
+	require.Equal(t, keyboard.DefaultDevice, def.Keyboard())
+
+	// GA401 key codes translate to themselves
+	for raw, canonical := range def.KeyCodeMap() {
+		require.Equal(t, raw, canonical)
+	}
+	require.Len(t, def.KeyCodeMap(), len(keyboard.KeyNames))
+
+	// the default profiles of system/thermal are used
+	require.Empty(t, def.Profiles)
+
+	// only verified boards are embedded
+	require.Len(t, db.Models(), 1)
+	for _, board := range []string{"GA502IU", "UX425EA"} {
+		_, ok := db.Lookup(board)
+		require.False(t, ok, board)
+	}
+}
+
+func TestOverride(t *testing.T) {
+	override := `[
+  {
+    "Name": "ROG Zephyrus G14 (2020)",
+    "Boards": ["GA401"],
+    "HID": {
+      "VendorID": "0x0b05",
+      "ProductID": "0x1866",
+      "Collections": ["mi_02&col01"],
+      "Control": "mi_02&col01"
+    },
+    "KeyCodes": {"FnF5": 200},
+    "Devices": ["0x00120075"],
+    "FanCurves": false,
+    "Profiles": [
+      {"Name": "Silent", "WindowsPowerPlan": "Power saver", "ThrottlePlan": "Silent", "CPUFanCurve": "20c:0%,50c:0%,55c:0%,60c:0%,65c:31%,70c:49%,75c:56%,98c:56%"}
+    ]
+  },
+  {
+    "Name": "Custom",
+    "Boards": ["GA401QM"],
+    "HID": {"VendorID": "0x0b05", "ProductID": "0x19b6", "Collections": ["mi_02&col01"], "Control": "mi_02&col01"}
+  }
+]`
+	path := filepath.Join(t.TempDir(), "models.json")
+	require.NoError(t, ioutil.WriteFile(path, []byte(override), 0644))
+
+	db, err := Load(path)
+	require.NoError(t, err)
+
+	// the most specific board wins
+	m, ok := db.Lookup("GA401QM")
+	require.True(t, ok)
+	require.Equal(t, "Custom", m.Name)
+
+	// and replace the embedded descriptor with the same name
+	m = db.Default()
+	require.Len(t, m.HID.Collections, 1)
+	require.Equal(t, map[uint32]uint32{200: keyboard.KeyFnF5}, m.KeyCodeMap())
+
+	require.Equal(t, []Profile{{
+		Name:             "Silent",
+		WindowsPowerPlan: "Power saver",
+		ThrottlePlan:     "Silent",
+		CPUFanCurve:      "20c:0%,50c:0%,55c:0%,60c:0%,65c:31%,70c:49%,75c:56%,98c:56%",
+	}}, m.Profiles)
+
+	caps := m.Restrict(atkacpi.ProbeCapabilities(atkacpi.NewSimulator()))
+	require.True(t, caps.Supports(atkacpi.DevsThrottleCtrl))
+	require.False(t, caps.Supports(atkacpi.DevsBatteryChargeLimit))
+	require.False(t, caps.Supports(atkacpi.DevsCPUFanCurve))
+
+	require.Len(t, db.Models(), 2)
+
+	// missing override file is fine
+	_, err = Load(filepath.Join(t.TempDir(), "nonexistent.json"))
+	require.NoError(t, err)
+}
+
+func TestInvalidDescriptors(t *testing.T) {
+	invalid := []string{
+		`[{"Name": "", "Boards": ["GA401"]}]`,
+		`[{"Name": "A", "Boards": ["GA401"], "HID": {"VendorID": "0x0b05", "ProductID": "0x1866", "Collections": ["a"], "Control": "a"}, "KeyCodes": {"Nope": 1}}]`,
+		`[{"Name": "A", "Boards": ["GA401"], "HID": {"VendorID": "0x0b05", "ProductID": "0x1866", "Collections": ["a"], "Control": "a"}, "Profiles": [{"Name": "P"}]}]`,
+		`[{"Name": "A", "Boards": ["GA401"], "HID": {"VendorID": 2821, "ProductID": "0x1866", "Collections": ["a"], "Control": "a"}}]`,
+		`[{"Name": "A", "Unknown": true}]`,
+		`[{"Name": "A", "Boards": ["GA401"], "HID": {"VendorID": "0x0b05", "ProductID": "0x1866", "Collections": ["a"], "Control": "a"}, "Profiles": [{"Name": "P", "ThrottlePlan": "Silent", "OnEnter": []}]}]`,
+	}
+	for _, s := range invalid {
+		_, err := Parse(strings.NewReader(s))
+		require.Error(t, err, s)
+	}
+}
@@ -0,0 +1,91 @@
+//go:build linux
+// +build linux
+
+package persist
+
+import (
+	"log"
+	"sync"
+)
+
+// memoryConfigHelper keeps the configs in memory, as there is no Registry on Linux
+type memoryConfigHelper struct {
+	mu            sync.Mutex
+	alreadyClosed bool
+	configs       map[string]Registry
+	values        map[string][]byte
+}
+
+var _ ConfigRegistry = &memoryConfigHelper{}
+
+// NewRegistryConfigHelper returns a helper that keeps the configs in memory until the process exits
+func NewRegistryConfigHelper() (ConfigRegistry, error) {
+	return &memoryConfigHelper{
+		configs: make(map[string]Registry),
+		values:  make(map[string][]byte),
+	}, nil
+}
+
+// Register will add the config to the list
+func (h *memoryConfigHelper) Register(config Registry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.configs[config.Name()] = config
+}
+
+// Load will populate configs from the values saved previously
+func (h *memoryConfigHelper) Load() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for name, config := range h.configs {
+		if err := config.Load(h.values[name]); err != nil {
+			// not fatal, as the rest of the configurations can still be restored
+			log.Printf("persist: cannot restore \"%s\": %s\n", name, err)
+		}
+	}
+	return nil
+}
+
+// Save will keep the values of all the configs in memory
+func (h *memoryConfigHelper) Save() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for name, config := range h.configs {
+		h.values[name] = config.Value()
+	}
+	return nil
+}
+
+// Apply will apply each config accordingly. This is usually called after Load()
+func (h *memoryConfigHelper) Apply() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for name, config := range h.configs {
+		if err := config.Apply(); err != nil {
+			log.Printf("persist: error applying \"%s\": %s\n", name, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// Close will release resources of each config
+func (h *memoryConfigHelper) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.alreadyClosed {
+		return
+	}
+	h.alreadyClosed = true
+
+	for name, config := range h.configs {
+		if err := config.Close(); err != nil {
+			log.Printf("persist: error closing \"%s\": %s\n", name, err)
+		}
+	}
+}
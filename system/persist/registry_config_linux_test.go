@@ -0,0 +1,35 @@
+//go:build linux
+// +build linux
+
+package persist
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type mockConfig struct {
+	bytes []byte
+}
+
+func (m *mockConfig) Name() string        { return "MockConfig" }
+func (m *mockConfig) Value() []byte       { return m.bytes }
+func (m *mockConfig) Load(v []byte) error { m.bytes = v; return nil }
+func (m *mockConfig) Apply() error        { return nil }
+func (m *mockConfig) Close() error        { return nil }
+
+func TestPersistInMemory(t *testing.T) {
+	h, err := NewRegistryConfigHelper()
+	require.NoError(t, err)
+
+	config := &mockConfig{bytes: []byte{1, 2, 3}}
+	h.Register(config)
+	require.NoError(t, h.Save())
+
+	config.bytes = nil
+	require.NoError(t, h.Load())
+	require.Equal(t, []byte{1, 2, 3}, config.bytes)
+	require.NoError(t, h.Apply())
+	h.Close()
+}
@@ -1,3 +1,6 @@
+//go:build windows
+// +build windows
+
 package persist
 
 import (
@@ -68,7 +71,10 @@ func (h *RegistryConfigHelper) Load() error {
 			log.Printf("persist: error loading \"%s\" from the Registry: %s\n", config.Name(), err)
 			return err
 		}
-		config.Load(v)
+		if err := config.Load(v); err != nil {
+			// not fatal, as the rest of the configurations can still be restored
+			log.Printf("persist: cannot restore \"%s\": %s\n", config.Name(), err)
+		}
 	}
 
 	return nil
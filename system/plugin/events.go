@@ -3,7 +3,8 @@ package plugin
 // Event defines the type of notification from controller to plugins
 type Event int
 
-// Define all the possible controller->plugin notifications
+// Define all the possible controller->plugin notifications. New events are appended at the end,
+// so that the values of the existing ones do not change
 const (
 	EvtKeyboardFn Event = iota
 	EvtACPISuspend
@@ -18,6 +19,17 @@ const (
 
 	CbPersistConfig
 	CbNotifyToast
+
+	EvtLidOpened
+	EvtLidClosed
+	EvtACPowerOn
+	EvtOnBattery
+	EvtProfileHook
+	CbRunHooks
+	CbHookResult
+	EvtBatteryLevel
+	EvtSentinelPreviewThermalProfile
+	EvtPowerSourceState
 )
 
 func (e Event) String() string {
@@ -35,5 +47,16 @@ func (e Event) String() string {
 
 		"Callback: Request to persist config",
 		"Callback: Request to notify user",
+
+		"Event: Lid opened",
+		"Event: Lid closed",
+		"Event: On AC power",
+		"Event: On battery",
+		"Event: Profile hook",
+		"Callback: Request to run profile hooks",
+		"Callback: Result of a profile hook",
+		"Event: Battery level changed",
+		"Event (sentinel): Preview thermal profile",
+		"Event: Power source at start up",
 	}[e]
 }
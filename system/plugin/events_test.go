@@ -0,0 +1,16 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventValues(t *testing.T) {
+	// existing events keep their values when new ones are added
+	require.Equal(t, Event(0), EvtKeyboardFn)
+	require.Equal(t, Event(9), EvtSentinelCycleRefreshRate)
+	require.Equal(t, Event(11), CbNotifyToast)
+	require.Equal(t, "Event (sentinel): Preview thermal profile", EvtSentinelPreviewThermalProfile.String())
+	require.Equal(t, "Event: Power source at start up", EvtPowerSourceState.String())
+}
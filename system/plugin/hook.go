@@ -0,0 +1,106 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// HookAction defines what a profile hook does. The plugin owning the action runs the hook
+type HookAction string
+
+// Defines the supported hook actions and the format of their values
+const (
+	// HookCommand runs the value as a command line (cmd.exe /C)
+	HookCommand HookAction = "command"
+	// HookKeyboardBrightness sets the keyboard backlight to off, low, medium, or high
+	HookKeyboardBrightness HookAction = "keyboard_brightness"
+	// HookChargeLimit sets the battery charge limit in percentage (40 to 100)
+	HookChargeLimit HookAction = "charge_limit"
+	// HookRefreshRate sets the refresh rate of the internal display in Hz
+	HookRefreshRate HookAction = "refresh_rate"
+	// HookGPU turns the dGPU on or off
+	HookGPU HookAction = "gpu"
+)
+
+// Hook is an action to run when a profile becomes active or inactive
+type Hook struct {
+	Action HookAction `yaml:"action"`
+	Value  string     `yaml:"value"`
+}
+
+func (h Hook) String() string {
+	return fmt.Sprintf("%s=%s", h.Action, h.Value)
+}
+
+// Validate checks that the action is supported and the value is valid for the action
+func (h Hook) Validate() error {
+	switch h.Action {
+	case HookCommand:
+		if strings.TrimSpace(h.Value) == "" {
+			return errors.New("command hook must not be empty")
+		}
+	case HookKeyboardBrightness:
+		switch strings.ToLower(h.Value) {
+		case "off", "low", "medium", "high":
+		default:
+			return fmt.Errorf("keyboard brightness must be off, low, medium, or high, got %s", h.Value)
+		}
+	case HookChargeLimit:
+		pct, err := strconv.Atoi(h.Value)
+		if err != nil || pct < 40 || pct > 100 {
+			return fmt.Errorf("charge limit must be between 40 and 100, got %s", h.Value)
+		}
+	case HookRefreshRate:
+		hz, err := strconv.Atoi(h.Value)
+		if err != nil || hz <= 0 {
+			return fmt.Errorf("refresh rate must be a positive number in Hz, got %s", h.Value)
+		}
+	case HookGPU:
+		switch strings.ToLower(h.Value) {
+		case "on", "off":
+		default:
+			return fmt.Errorf("gpu must be on or off, got %s", h.Value)
+		}
+	default:
+		return fmt.Errorf("unknown hook action %s", h.Action)
+	}
+	return nil
+}
+
+// HookPhase defines when a hook runs
+type HookPhase int
+
+// Hooks run when the profile becomes active (enter) or inactive (exit)
+const (
+	HookEnter HookPhase = iota
+	HookExit
+)
+
+func (p HookPhase) String() string {
+	return [...]string{
+		"enter",
+		"exit",
+	}[p]
+}
+
+// HookRequest is a hook to run for a profile. Plugins send []HookRequest with CbRunHooks, and
+// controller notifies plugins of each request with EvtProfileHook
+type HookRequest struct {
+	Profile string
+	Phase   HookPhase
+	Hook    Hook
+}
+
+func (r HookRequest) String() string {
+	return fmt.Sprintf("%s hook %s of %s", r.Phase, r.Hook, r.Profile)
+}
+
+// HookResult is sent with CbHookResult by the plugin that ran the hook. Err is nil if the hook succeeded.
+// Skipped is the reason the hook was not run (e.g. dry run), and is empty if it was run
+type HookResult struct {
+	Request HookRequest
+	Err     error
+	Skipped string
+}
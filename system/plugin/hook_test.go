@@ -0,0 +1,32 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHookValidate(t *testing.T) {
+	valid := []Hook{
+		{Action: HookCommand, Value: "notepad.exe"},
+		{Action: HookKeyboardBrightness, Value: "Medium"},
+		{Action: HookChargeLimit, Value: "60"},
+		{Action: HookRefreshRate, Value: "60"},
+		{Action: HookGPU, Value: "off"},
+	}
+	for _, h := range valid {
+		require.NoError(t, h.Validate(), h.String())
+	}
+
+	invalid := []Hook{
+		{Action: "reboot", Value: "now"},
+		{Action: HookCommand, Value: " "},
+		{Action: HookKeyboardBrightness, Value: "max"},
+		{Action: HookChargeLimit, Value: "30"},
+		{Action: HookRefreshRate, Value: "fast"},
+		{Action: HookGPU, Value: "auto"},
+	}
+	for _, h := range invalid {
+		require.Error(t, h.Validate(), h.String())
+	}
+}
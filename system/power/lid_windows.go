@@ -0,0 +1,92 @@
+//go:build windows
+// +build windows
+
+package power
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	powerSettingRegisterNotification   = libPowrProf.NewProc("PowerSettingRegisterNotification")
+	powerSettingUnregisterNotification = libPowrProf.NewProc("PowerSettingUnregisterNotification")
+
+	// GUID_LIDSWITCH_STATE_CHANGE https://docs.microsoft.com/en-us/windows/win32/power/power-setting-guids
+	guidLidSwitchStateChange = windows.GUID{
+		Data1: 0xba3e0f4d,
+		Data2: 0xb817,
+		Data3: 0x4094,
+		Data4: [8]byte{0xa2, 0xd1, 0xd5, 0x63, 0x79, 0xe6, 0xa0, 0xf3},
+	}
+)
+
+// PBT_POWERSETTINGCHANGE is the type of event when a power setting changes
+const PBT_POWERSETTINGCHANGE uint32 = 0x8013
+
+// powerBroadcastSetting is POWERBROADCAST_SETTING with a DWORD of data
+type powerBroadcastSetting struct {
+	PowerSetting windows.GUID
+	DataLength   uint32
+	Data         uint32
+}
+
+// NewLidListener will listen for the lid switch state, and send true to the channel when the lid is closed.
+// Windows reports the current state right after registering, and every change afterward (including on resume)
+func NewLidListener(haltCtx context.Context, lidCh chan bool) error {
+	errCh := make(chan error)
+
+	go func() {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+
+		const (
+			_DEVICE_NOTIFY_CALLBACK = 2
+		)
+		type _DEVICE_NOTIFY_SUBSCRIBE_PARAMETERS struct {
+			callback uintptr
+			context  uintptr
+		}
+
+		var fn interface{} = func(context uintptr, changeType uint32, setting *powerBroadcastSetting) uintptr {
+			if changeType != PBT_POWERSETTINGCHANGE || setting == nil || setting.PowerSetting != guidLidSwitchStateChange {
+				return 0
+			}
+			// 0 is closed, and 1 is opened. The callback must not block once the listener is halted
+			select {
+			case lidCh <- setting.Data == 0:
+			case <-haltCtx.Done():
+			}
+			return 0
+		}
+
+		params := _DEVICE_NOTIFY_SUBSCRIBE_PARAMETERS{
+			callback: windows.NewCallback(fn),
+		}
+		handle := uintptr(0)
+
+		log.Println("power: registering lid switch notification")
+		ret, _, _ := powerSettingRegisterNotification.Call(
+			uintptr(unsafe.Pointer(&guidLidSwitchStateChange)),
+			_DEVICE_NOTIFY_CALLBACK,
+			uintptr(unsafe.Pointer(&params)),
+			uintptr(unsafe.Pointer(&handle)),
+		)
+		if ret != 0 {
+			errCh <- fmt.Errorf("PowerSettingRegisterNotification returns %d", ret)
+			return
+		}
+		errCh <- nil
+
+		<-haltCtx.Done()
+		log.Println("power: unregistering lid switch notification")
+		powerSettingUnregisterNotification.Call(handle)
+	}()
+
+	return <-errCh
+}
@@ -0,0 +1,20 @@
+//go:build linux
+// +build linux
+
+package power
+
+// Cfg keeps the name of the power plan, as there are no Windows power plans on Linux
+type Cfg struct {
+	activePlan string
+}
+
+// NewCfg returns a Cfg that only keeps the name of the power plan
+func NewCfg() (*Cfg, error) {
+	return &Cfg{}, nil
+}
+
+// Set keeps the given power plan name
+func (p *Cfg) Set(planName string) (nextPlan string, err error) {
+	p.activePlan = planName
+	return planName, nil
+}
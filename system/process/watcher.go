@@ -0,0 +1,61 @@
+package process
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Watcher returns the executables of the running processes
+type Watcher interface {
+	Running() (map[string]bool, error)
+}
+
+// Normalize returns the executable name used by Watcher, which is the lowercase base name (e.g. game.exe)
+func Normalize(executable string) string {
+	return strings.ToLower(filepath.Base(strings.ReplaceAll(strings.TrimSpace(executable), "\\", "/")))
+}
+
+// Fake is a Watcher with processes started and stopped manually. It is used in tests
+type Fake struct {
+	mu      sync.Mutex
+	running map[string]bool
+	Err     error
+}
+
+var _ Watcher = &Fake{}
+
+// NewFake returns a Fake with no running processes
+func NewFake() *Fake {
+	return &Fake{
+		running: make(map[string]bool),
+	}
+}
+
+// Start marks the executable as running
+func (f *Fake) Start(executable string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.running[Normalize(executable)] = true
+}
+
+// Stop marks the executable as exited
+func (f *Fake) Stop(executable string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.running, Normalize(executable))
+}
+
+// Running returns a copy of the running executables
+func (f *Fake) Running() (map[string]bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	running := make(map[string]bool, len(f.running))
+	for k := range f.running {
+		running[k] = true
+	}
+	return running, nil
+}
@@ -0,0 +1,44 @@
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultProcPath is the default mount point of procfs
+const DefaultProcPath = "/proc"
+
+type procWatcher struct {
+	path string
+}
+
+// NewWatcher returns a Watcher that reads the process names from procfs
+func NewWatcher() Watcher {
+	return procWatcher{path: DefaultProcPath}
+}
+
+func (p procWatcher) Running() (map[string]bool, error) {
+	entries, err := ioutil.ReadDir(p.path)
+	if err != nil {
+		return nil, fmt.Errorf("process: cannot read %s: %w", p.path, err)
+	}
+	running := make(map[string]bool)
+	for _, e := range entries {
+		if _, err := strconv.Atoi(e.Name()); err != nil {
+			continue
+		}
+		// the process may have exited in the meantime
+		comm, err := ioutil.ReadFile(filepath.Join(p.path, e.Name(), "comm"))
+		if err != nil {
+			continue
+		}
+		running[Normalize(strings.TrimSpace(string(comm)))] = true
+	}
+	return running, nil
+}
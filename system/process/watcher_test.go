@@ -0,0 +1,34 @@
+package process
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalize(t *testing.T) {
+	require.Equal(t, "game.exe", Normalize(`C:\Games\Game.EXE`))
+	require.Equal(t, "blender.exe", Normalize(" blender.exe "))
+	require.Equal(t, "cc1", Normalize("/usr/lib/gcc/cc1"))
+}
+
+func TestFake(t *testing.T) {
+	f := NewFake()
+	f.Start("Game.exe")
+	f.Start("blender.exe")
+	f.Stop("BLENDER.EXE")
+
+	running, err := f.Running()
+	require.NoError(t, err)
+	require.Equal(t, map[string]bool{"game.exe": true}, running)
+
+	// the returned map is a copy
+	running["other.exe"] = true
+	running, _ = f.Running()
+	require.Len(t, running, 1)
+
+	f.Err = errors.New("denied")
+	_, err = f.Running()
+	require.Error(t, err)
+}
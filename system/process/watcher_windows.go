@@ -0,0 +1,40 @@
+//go:build windows
+// +build windows
+
+package process
+
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+type snapshotWatcher struct{}
+
+// NewWatcher returns a Watcher that enumerates processes with a Toolhelp snapshot
+func NewWatcher() Watcher {
+	return snapshotWatcher{}
+}
+
+func (snapshotWatcher) Running() (map[string]bool, error) {
+	snapshot, err := windows.CreateToolhelp32Snapshot(windows.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		return nil, fmt.Errorf("process: cannot create snapshot: %w", err)
+	}
+	defer windows.CloseHandle(snapshot)
+
+	running := make(map[string]bool)
+	var entry windows.ProcessEntry32
+	entry.Size = uint32(unsafe.Sizeof(entry))
+	err = windows.Process32First(snapshot, &entry)
+	for err == nil {
+		running[Normalize(windows.UTF16ToString(entry.ExeFile[:]))] = true
+		err = windows.Process32Next(snapshot, &entry)
+	}
+	if !errors.Is(err, windows.ERROR_NO_MORE_FILES) {
+		return nil, fmt.Errorf("process: cannot enumerate processes: %w", err)
+	}
+	return running, nil
+}
@@ -0,0 +1,339 @@
+package setup
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/zllovesuki/G14Manager/system/persist"
+	"github.com/zllovesuki/G14Manager/system/plugin"
+	"github.com/zllovesuki/G14Manager/system/shared"
+	"github.com/zllovesuki/G14Manager/system/thermal"
+)
+
+const (
+	persistKey = "Setups"
+)
+
+// Device is a persist.Registry that can apply its part of a setup. changed reports whether the device
+// was written to, so it can be restored with Load and Apply if another device fails
+type Device interface {
+	persist.Registry
+	ApplySetup(s shared.Setup) (changed bool, err error)
+}
+
+// ApplyError is returned when a setup cannot be applied. The devices written to before the
+// failure, and the failed device, are restored to their previous state
+type ApplyError struct {
+	Setup       string
+	Device      string
+	Err         error
+	RolledBack  bool
+	RollbackErr error
+}
+
+func (e *ApplyError) Error() string {
+	msg := fmt.Sprintf("Cannot apply setup %s: %s failed: %s", e.Setup, e.Device, e.Err)
+	switch {
+	case e.RolledBack:
+		msg += " (restored previous settings)"
+	case e.RollbackErr != nil:
+		msg += fmt.Sprintf(" (cannot restore previous settings: %s)", e.RollbackErr)
+	}
+	return msg
+}
+
+func (e *ApplyError) Unwrap() error {
+	return e.Err
+}
+
+// Validate checks the device settings of the setup. ThermalProfile is not checked, as it depends on the profiles
+func Validate(s shared.Setup) error {
+	if strings.TrimSpace(s.Name) == "" {
+		return errors.New("setup name must not be empty")
+	}
+	hooks := make([]plugin.Hook, 0, 4)
+	if s.ChargeLimit != 0 {
+		hooks = append(hooks, plugin.Hook{Action: plugin.HookChargeLimit, Value: strconv.Itoa(int(s.ChargeLimit))})
+	}
+	if s.KeyboardBrightness != "" {
+		hooks = append(hooks, plugin.Hook{Action: plugin.HookKeyboardBrightness, Value: s.KeyboardBrightness})
+	}
+	if s.RefreshRate != 0 {
+		hooks = append(hooks, plugin.Hook{Action: plugin.HookRefreshRate, Value: strconv.Itoa(int(s.RefreshRate))})
+	}
+	if s.GPU != "" {
+		hooks = append(hooks, plugin.Hook{Action: plugin.HookGPU, Value: s.GPU})
+	}
+	// the setup values are the same as the values of the hooks
+	for _, h := range hooks {
+		if err := h.Validate(); err != nil {
+			return err
+		}
+	}
+	switch strings.ToLower(s.MicMute) {
+	case "", "on", "off":
+	default:
+		return fmt.Errorf("mic mute must be on or off, got %s", s.MicMute)
+	}
+	return nil
+}
+
+// Manager keeps the list of setups, and applies them to the devices in order.
+// The manager is safe for multiple goroutines.
+type Manager struct {
+	mu      sync.Mutex
+	devices []Device
+	setups  []shared.Setup
+	current string
+}
+
+var _ persist.Registry = &Manager{}
+
+// NewManager returns a Manager applying setups to the devices, in the order given
+func NewManager(devices ...Device) (*Manager, error) {
+	for _, d := range devices {
+		if d == nil {
+			return nil, errors.New("nil Device is invalid")
+		}
+	}
+	return &Manager{
+		devices: devices,
+		setups:  make([]shared.Setup, 0),
+	}, nil
+}
+
+// Setups returns a copy of the setups
+func (m *Manager) Setups() []shared.Setup {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	setups := make([]shared.Setup, len(m.setups))
+	copy(setups, m.setups)
+	return setups
+}
+
+// Current returns the last applied setup. ok is false if no setup was applied, or it was deleted
+func (m *Manager) Current() (s shared.Setup, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.current == "" {
+		return
+	}
+	if index := m.find(m.current); index >= 0 {
+		return m.setups[index], true
+	}
+	return
+}
+
+// find returns the index of the setup referred to by its ID or name, or -1
+func (m *Manager) find(ref string) int {
+	for i, s := range m.setups {
+		if s.ID == ref {
+			return i
+		}
+	}
+	for i, s := range m.setups {
+		if s.Name == ref {
+			return i
+		}
+	}
+	return -1
+}
+
+// Save adds the setup, or replaces the setup with the same ID. A setup without an ID replaces
+// the setup with the same name if there is one, otherwise it is given an ID derived from the name
+func (m *Manager) Save(s shared.Setup) (shared.Setup, error) {
+	if err := Validate(s); err != nil {
+		return s, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s.ID == "" {
+		if index := m.find(s.Name); index >= 0 {
+			s.ID = m.setups[index].ID
+		} else {
+			s.ID = m.newID(s.Name)
+		}
+	}
+
+	index := -1
+	for i, existing := range m.setups {
+		if existing.ID == s.ID {
+			index = i
+		} else if existing.Name == s.Name {
+			return s, fmt.Errorf("setup name %s is already used by %s", s.Name, existing.ID)
+		}
+	}
+	if index < 0 {
+		m.setups = append(m.setups, s)
+	} else {
+		m.setups[index] = s
+	}
+	return s, nil
+}
+
+// newID returns the ID derived from the name, with a numeric suffix if taken. Setup IDs follow the profile IDs
+func (m *Manager) newID(name string) string {
+	base := thermal.ProfileID(name)
+	id := base
+	for n := 2; ; n++ {
+		taken := false
+		for _, s := range m.setups {
+			if s.ID == id {
+				taken = true
+				break
+			}
+		}
+		if !taken {
+			return id
+		}
+		id = fmt.Sprintf("%s-%d", base, n)
+	}
+}
+
+// Delete removes the setup with the given ID or name
+func (m *Manager) Delete(ref string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	index := m.find(ref)
+	if index < 0 {
+		return errors.New("Cannot find setup: " + ref)
+	}
+	m.setups = append(m.setups[:index], m.setups[index+1:]...)
+	return nil
+}
+
+// SwitchToSetup applies the setup with the given ID or name to every device as a transaction: if a device fails,
+// the devices written to are restored in reverse order with the values they had before, and an *ApplyError is returned
+func (m *Manager) SwitchToSetup(ref string) (shared.Setup, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	index := m.find(ref)
+	if index < 0 {
+		return shared.Setup{}, errors.New("Cannot find setup: " + ref)
+	}
+	s := m.setups[index]
+
+	snapshots := make([][]byte, len(m.devices))
+	for i, d := range m.devices {
+		snapshots[i] = d.Value()
+	}
+
+	written := make([]int, 0, len(m.devices))
+	for i, d := range m.devices {
+		changed, err := d.ApplySetup(s)
+		if changed || err != nil {
+			// the failed device may be partially written to as well
+			written = append(written, i)
+		}
+		if err == nil {
+			continue
+		}
+
+		applyErr := &ApplyError{
+			Setup:  s.Name,
+			Device: d.Name(),
+			Err:    err,
+		}
+		log.Printf("setup: %s failed for %s, restoring previous settings\n", d.Name(), s.Name)
+		if err := m.restore(written, snapshots); err != nil {
+			applyErr.RollbackErr = err
+		} else {
+			applyErr.RolledBack = true
+		}
+		return s, applyErr
+	}
+
+	m.current = s.ID
+	log.Printf("setup: applied %s\n", s.Name)
+	return s, nil
+}
+
+// restore loads the snapshots of the devices in reverse order, and returns the first error.
+// Every device is restored even if one of them fails
+func (m *Manager) restore(indices []int, snapshots [][]byte) error {
+	var restoreErr error
+	for i := len(indices) - 1; i >= 0; i-- {
+		d := m.devices[indices[i]]
+		err := d.Load(snapshots[indices[i]])
+		if err == nil {
+			err = d.Apply()
+		}
+		if err != nil {
+			log.Printf("setup: cannot restore %s: %+v\n", d.Name(), err)
+			if restoreErr == nil {
+				restoreErr = fmt.Errorf("%s: %w", d.Name(), err)
+			}
+		}
+	}
+	return restoreErr
+}
+
+type persistSetups struct {
+	Setups  []shared.Setup
+	Current string
+}
+
+// Name satisfies persist.Registry
+func (m *Manager) Name() string {
+	return persistKey
+}
+
+// Value satisfies persist.Registry
+func (m *Manager) Value() []byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	if err := enc.Encode(persistSetups{
+		Setups:  m.setups,
+		Current: m.current,
+	}); err != nil {
+		return nil
+	}
+	return buf.Bytes()
+}
+
+// Load satisfies persist.Registry
+func (m *Manager) Load(v []byte) error {
+	if len(v) == 0 {
+		return nil
+	}
+
+	var p persistSetups
+	if err := gob.NewDecoder(bytes.NewBuffer(v)).Decode(&p); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.setups = p.Setups
+	if m.setups == nil {
+		m.setups = make([]shared.Setup, 0)
+	}
+	m.current = p.Current
+	return nil
+}
+
+// Apply satisfies persist.Registry. The setup is not applied again, as every device restores its own settings
+func (m *Manager) Apply() error {
+	return nil
+}
+
+// Close satisfied persist.Registry
+func (m *Manager) Close() error {
+	return nil
+}
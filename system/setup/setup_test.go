@@ -0,0 +1,154 @@
+package setup
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/zllovesuki/G14Manager/system/shared"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDevice is written to by setups with a charge limit, and fails on the value in fail
+type fakeDevice struct {
+	name    string
+	value   uint8
+	fail    uint8
+	applied int
+}
+
+func (f *fakeDevice) Name() string {
+	return f.name
+}
+
+func (f *fakeDevice) Value() []byte {
+	return []byte{f.value}
+}
+
+func (f *fakeDevice) Load(v []byte) error {
+	f.value = v[0]
+	return nil
+}
+
+func (f *fakeDevice) Apply() error {
+	f.applied++
+	return nil
+}
+
+func (f *fakeDevice) Close() error {
+	return nil
+}
+
+func (f *fakeDevice) ApplySetup(s shared.Setup) (bool, error) {
+	if s.ChargeLimit == 0 {
+		return false, nil
+	}
+	f.value = s.ChargeLimit
+	if f.fail != 0 && f.fail == s.ChargeLimit {
+		return true, errors.New("device error")
+	}
+	return true, nil
+}
+
+func TestManagerApply(t *testing.T) {
+	first := &fakeDevice{name: "first", value: 80}
+	second := &fakeDevice{name: "second", value: 80, fail: 60}
+	third := &fakeDevice{name: "third", value: 80}
+	m, err := NewManager(first, second, third)
+	require.NoError(t, err)
+
+	_, err = m.Save(shared.Setup{Name: "Travel", ChargeLimit: 60})
+	require.NoError(t, err)
+	_, err = m.Save(shared.Setup{Name: "Gaming", ChargeLimit: 100})
+	require.NoError(t, err)
+
+	s, err := m.SwitchToSetup("gaming")
+	require.NoError(t, err)
+	require.Equal(t, "Gaming", s.Name)
+	for _, d := range []*fakeDevice{first, second, third} {
+		require.EqualValues(t, 100, d.value)
+	}
+	current, ok := m.Current()
+	require.True(t, ok)
+	require.Equal(t, "gaming", current.ID)
+
+	// the second device fails, so the first and the second are restored
+	_, err = m.SwitchToSetup("Travel")
+	var applyErr *ApplyError
+	require.True(t, errors.As(err, &applyErr))
+	require.Equal(t, "second", applyErr.Device)
+	require.True(t, applyErr.RolledBack)
+	for _, d := range []*fakeDevice{first, second, third} {
+		require.EqualValues(t, 100, d.value)
+	}
+	require.Equal(t, 1, first.applied)
+	require.Equal(t, 1, second.applied)
+	require.Equal(t, 0, third.applied)
+
+	current, ok = m.Current()
+	require.True(t, ok)
+	require.Equal(t, "gaming", current.ID)
+
+	_, err = m.SwitchToSetup("Meeting")
+	require.Error(t, err)
+}
+
+func TestManagerSave(t *testing.T) {
+	m, err := NewManager()
+	require.NoError(t, err)
+
+	s, err := m.Save(shared.Setup{Name: "Travel", ChargeLimit: 60})
+	require.NoError(t, err)
+	require.Equal(t, "travel", s.ID)
+
+	// saved by name keeps the ID
+	s, err = m.Save(shared.Setup{Name: "Travel", ChargeLimit: 80})
+	require.NoError(t, err)
+	require.Equal(t, "travel", s.ID)
+	require.Len(t, m.Setups(), 1)
+
+	// renamed by ID
+	s, err = m.Save(shared.Setup{ID: "travel", Name: "On the Go", ChargeLimit: 80})
+	require.NoError(t, err)
+	require.Equal(t, "travel", s.ID)
+
+	s, err = m.Save(shared.Setup{Name: "Travel"})
+	require.NoError(t, err)
+	require.Equal(t, "travel-2", s.ID)
+
+	_, err = m.Save(shared.Setup{ID: "travel", Name: "Travel"})
+	require.Error(t, err)
+
+	require.NoError(t, m.Delete("On the Go"))
+	require.Error(t, m.Delete("On the Go"))
+	require.Len(t, m.Setups(), 1)
+
+	restored, err := NewManager()
+	require.NoError(t, err)
+	require.NoError(t, restored.Load(m.Value()))
+	require.Equal(t, m.Setups(), restored.Setups())
+}
+
+func TestValidate(t *testing.T) {
+	require.NoError(t, Validate(shared.Setup{Name: "Empty"}))
+	require.NoError(t, Validate(shared.Setup{
+		Name:               "Meeting",
+		ThermalProfile:     "quiet",
+		ChargeLimit:        80,
+		KeyboardBrightness: "Low",
+		RefreshRate:        60,
+		GPU:                "off",
+		MicMute:            "Off",
+	}))
+
+	invalid := []shared.Setup{
+		{},
+		{Name: "Limit", ChargeLimit: 20},
+		{Name: "Keyboard", KeyboardBrightness: "max"},
+		{Name: "GPU", GPU: "auto"},
+		{Name: "Mic", MicMute: "yes"},
+	}
+	for _, s := range invalid {
+		require.Error(t, Validate(s), s.Name)
+	}
+}
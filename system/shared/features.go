@@ -1,13 +1,120 @@
 package shared
 
+import "time"
+
 type Features struct {
 	AutoThermal AutoThermal
 	FnRemap     map[uint32]uint16
 	RogRemap    []string
+	FanSampler  FanSampler
+	// DriftWatchdog is how often the hardware state is checked for drift
+	DriftWatchdog DriftWatchdog
+	// SoftwareFan is the closed-loop fan control, which is disabled by default
+	SoftwareFan SoftwareFan
+	Schedules   []Schedule
+	// ProcessRules are matched in order, and the first rule with a running executable wins
+	ProcessRules []ProcessRule
+	// CycleProfiles are the profiles Fn+F5 cycles through, in order. Empty means every profile.
+	// Profiles not in the list are only reachable by rules or over gRPC
+	CycleProfiles []string
+	// ReverseCycleKey is the name of the key (see keyboard.KeyNames) that cycles backward. Empty disables it
+	ReverseCycleKey string
+	Boost           Boost
+}
+
+// Boost switches to Profile for Duration, and reverts to the previous profile when the time is up,
+// on suspend, or when the charger is unplugged. Empty Profile is the first Turbo profile, and zero Duration
+// is the default duration. Pressing the ROG key RogKeyPresses times starts (or cancels) the boost, and
+// zero disables it. RogKeyPresses must not be one of the presses of RogRemap
+type Boost struct {
+	Profile       string
+	Duration      time.Duration
+	RogKeyPresses int
 }
 
+// AutoThermal switches profiles when the charger is plugged in or unplugged. Barrel and USBCPD are
+// the profiles for each type of charger, and PluggedIn is the fallback if they are empty.
+// On battery, BatteryRules take precedence over Unplugged
 type AutoThermal struct {
-	Enabled   bool
-	PluggedIn string
-	Unplugged string
+	Enabled      bool
+	PluggedIn    string
+	Unplugged    string
+	Barrel       string
+	USBCPD       string
+	BatteryRules []BatteryRule
+}
+
+// BatteryRule switches to Profile on battery when the battery percentage is below Below
+// (e.g. Quiet below 30%). When multiple rules match, the one with the lowest Below wins
+type BatteryRule struct {
+	Below   uint8
+	Profile string
+}
+
+// BatteryProfile returns the profile of the matching battery rule with the lowest threshold
+// at the percentage. ok is false if no rule matches
+func (a AutoThermal) BatteryProfile(percentage uint8) (rule BatteryRule, ok bool) {
+	for _, r := range a.BatteryRules {
+		if percentage < r.Below && (!ok || r.Below < rule.Below) {
+			rule, ok = r, true
+		}
+	}
+	return
+}
+
+// Profile returns the profile for the power source
+func (a AutoThermal) Profile(source PowerSource) string {
+	switch {
+	case source == PowerSourceBattery:
+		return a.Unplugged
+	case source == PowerSourceBarrel && a.Barrel != "":
+		return a.Barrel
+	case source == PowerSourceUSBCPD && a.USBCPD != "":
+		return a.USBCPD
+	default:
+		return a.PluggedIn
+	}
+}
+
+type FanSampler struct {
+	Interval time.Duration
+}
+
+// SoftwareFan holds Target (in Celsius) by rewriting the fan curves, or by switching the throttle plan
+// if ThrottlePlan is set. Zero Target is the default target
+type SoftwareFan struct {
+	Enabled      bool
+	Target       uint32
+	ThrottlePlan bool
+}
+
+// DriftWatchdog checks the hardware state every Interval, and zero Interval is the default interval.
+// The watchdog is enabled unless Disabled is set, so features saved before it existed keep it enabled
+type DriftWatchdog struct {
+	Disabled bool
+	Interval time.Duration
+}
+
+// AutoThermalPriority is the priority of AutoThermal relative to Schedule.Priority
+const AutoThermalPriority = 0
+
+// Schedule switches to Profile between Start and End (time of day) on Days.
+// If End is before Start, the schedule ends on the next day. Days are the days the schedule starts on,
+// and empty Days means every day. Schedules with Priority above AutoThermalPriority take precedence over
+// AutoThermal; otherwise AutoThermal wins once the charger state is known. Between overlapping schedules,
+// the higher Priority wins
+type Schedule struct {
+	Profile  string
+	Days     []time.Weekday
+	Start    time.Duration // since midnight
+	End      time.Duration // since midnight
+	Priority int
+}
+
+// ProcessRule switches to Profile while Executable (e.g. game.exe, case insensitive) is running.
+// Process rules take precedence over schedules and AutoThermal, and the previous profile is restored
+// when the executable exits
+type ProcessRule struct {
+	Executable string
+	Profile    string
 }
@@ -0,0 +1,24 @@
+package shared
+
+// PowerSource is where the laptop draws power from. It is the Value of plugin.EvtChargerPluggedIn
+// and plugin.EvtPowerSourceState
+type PowerSource int
+
+// Defines the power sources reported by the firmware
+const (
+	PowerSourceUnknown PowerSource = iota
+	PowerSourceBattery
+	// PowerSourceBarrel is the 180W barrel charger
+	PowerSourceBarrel
+	// PowerSourceUSBCPD is a USB-C Power Delivery charger, which may supply much less power (e.g. 65W)
+	PowerSourceUSBCPD
+)
+
+func (p PowerSource) String() string {
+	return [...]string{
+		"Unknown",
+		"Battery",
+		"180W charger",
+		"USB-C PD charger",
+	}[p]
+}
@@ -0,0 +1,20 @@
+package shared
+
+// Setup bundles the settings of every device (e.g. "Travel", "Gaming", "Meeting"), and is applied
+// as a whole. Empty (or zero) fields leave the device unchanged
+type Setup struct {
+	ID   string
+	Name string
+	// ThermalProfile is the ID of the thermal profile
+	ThermalProfile string
+	// ChargeLimit is the battery charge limit in percentage (40 to 100)
+	ChargeLimit uint8
+	// KeyboardBrightness is off, low, medium, or high
+	KeyboardBrightness string
+	// RefreshRate is the refresh rate of the internal display in Hz
+	RefreshRate uint32
+	// GPU turns the dGPU on or off
+	GPU string
+	// MicMute mutes (on) or unmutes (off) the default recording device
+	MicMute string
+}
@@ -0,0 +1,152 @@
+package thermal
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/zllovesuki/G14Manager/system/atkacpi"
+	"github.com/zllovesuki/G14Manager/system/shared"
+)
+
+// ApplyStep is a step of applying a profile, in the order they are applied
+type ApplyStep int
+
+// Defines the steps of applying a profile. Values match protocol.ApplyStep
+const (
+	StepNone ApplyStep = iota
+	StepThrottlePlan
+	StepCPUFanCurve
+	StepGPUFanCurve
+	StepWindowsPowerPlan
+)
+
+func (s ApplyStep) String() string {
+	return [...]string{
+		"none",
+		"throttle plan",
+		"CPU fan curve",
+		"GPU fan curve",
+		"Windows power plan",
+	}[s]
+}
+
+// ApplyError is returned when a profile cannot be applied. The hardware is rolled back to the previously
+// applied profile if there is one. The Windows power plan is applied last, so it is never changed on failure
+type ApplyError struct {
+	Profile     string
+	Step        ApplyStep
+	Err         error
+	Previous    string // empty if nothing was applied before
+	RolledBack  bool
+	RollbackErr error
+}
+
+func (e *ApplyError) Error() string {
+	msg := fmt.Sprintf("Cannot apply %s: %s failed: %s", e.Profile, e.Step, e.Err)
+	switch {
+	case e.RolledBack:
+		msg += fmt.Sprintf(" (restored %s)", e.Previous)
+	case e.RollbackErr != nil:
+		msg += fmt.Sprintf(" (cannot restore %s: %s)", e.Previous, e.RollbackErr)
+	}
+	return msg
+}
+
+func (e *ApplyError) Unwrap() error {
+	return e.Err
+}
+
+// applyHardware applies the throttle plan then the fan curves of the profile, and returns the failed step.
+// The throttle plan is read back into c.readBack. What the software fan control drives is left to it
+func (c *Control) applyHardware(profile Profile) (ApplyStep, error) {
+	c.readBack = AppliedState{}
+
+	actuator, software := ActuateFanCurve, false
+	if c.Software != nil {
+		actuator, software = c.Software.Mode()
+		// switching the throttle plan resets the fan curves, so they are rewritten on the next step
+		defer c.Software.Reset()
+	}
+	if software && actuator == ActuateThrottlePlan {
+		log.Printf("thermal: software control drives the throttle plan and fan curves, skipping those of %s\n", profile.Name)
+		return StepNone, nil
+	}
+
+	// note: always set thermal throttle plan first, then override with user fan curve
+	if err := c.setThrottlePlan(profile); err != nil {
+		return StepThrottlePlan, err
+	}
+	if software {
+		log.Printf("thermal: software control drives the fan curves, skipping those of %s\n", profile.Name)
+		return StepNone, nil
+	}
+	if err := c.setFanCurve(atkacpi.DevsCPUFanCurve, "cpu", profile.CPUFanCurve); err != nil {
+		return StepCPUFanCurve, err
+	}
+
+	time.Sleep(time.Millisecond * 250)
+
+	if err := c.setFanCurve(atkacpi.DevsGPUFanCurve, "gpu", profile.GPUFanCurve); err != nil {
+		return StepGPUFanCurve, err
+	}
+	return StepNone, nil
+}
+
+// configureSoftware changes the mode of the software fan control, and reapplies the current profile
+// if it changed, so that the profile takes back (or hands over) the fan curves. c.mu must be held
+func (c *Control) configureSoftware(feats shared.SoftwareFan) {
+	if c.Software == nil {
+		return
+	}
+	actuator := ActuateFanCurve
+	if feats.ThrottlePlan {
+		actuator = ActuateThrottlePlan
+	}
+	changed, err := c.Software.Configure(feats.Enabled, actuator, float64(feats.Target))
+	if err != nil {
+		log.Printf("thermal: cannot configure software control: %s\n", err)
+		c.notify(fmt.Sprintf("Cannot configure software fan control: %s", err))
+		return
+	}
+	if !changed || c.applied == nil {
+		return
+	}
+	if _, err := c.setProfileLocked(c.currentProfileIndex); err != nil {
+		log.Println(err)
+		c.notify(err.Error())
+	}
+}
+
+// applyProfile applies the profile as a transaction: if any step fails, the hardware state of the
+// previously applied profile is restored. The firmware cannot report the custom fan curves,
+// so the previously applied profile is the record of the hardware state
+func (c *Control) applyProfile(profile Profile, previous *Profile) error {
+	step, err := c.applyHardware(profile)
+	if err == nil {
+		if _, err = c.Config.PowerCfg.Set(profile.WindowsPowerPlan); err != nil {
+			step = StepWindowsPowerPlan
+		}
+	}
+	if err == nil {
+		return nil
+	}
+
+	applyErr := &ApplyError{
+		Profile: profile.Name,
+		Step:    step,
+		Err:     err,
+	}
+	if previous == nil {
+		return applyErr
+	}
+
+	applyErr.Previous = previous.Name
+	log.Printf("thermal: %s failed for %s, restoring %s\n", step, profile.Name, previous.Name)
+	if _, err := c.applyHardware(*previous); err != nil {
+		applyErr.RollbackErr = err
+	} else {
+		applyErr.RolledBack = true
+	}
+	return applyErr
+}
@@ -0,0 +1,123 @@
+package thermal
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/zllovesuki/G14Manager/system/atkacpi"
+	"github.com/zllovesuki/G14Manager/system/power"
+
+	"github.com/stretchr/testify/require"
+)
+
+var errInjected = errors.New("injected failure")
+
+// failingWMI fails the next DEVS calls to the device
+type failingWMI struct {
+	*atkacpi.Simulator
+	dev      uint32
+	failures int
+}
+
+func (f *failingWMI) Evaluate(id atkacpi.Method, args []byte) ([]byte, error) {
+	if id == atkacpi.DEVS && f.failures > 0 && binary.LittleEndian.Uint32(args) == f.dev {
+		f.failures--
+		return nil, errInjected
+	}
+	return f.Simulator.Evaluate(id, args)
+}
+
+func newApplyTest(t *testing.T) (*Control, *failingWMI) {
+	wmi := &failingWMI{Simulator: atkacpi.NewSimulator()}
+	c, err := NewControl(Config{
+		WMI:      wmi,
+		PowerCfg: &power.Cfg{},
+		Profiles: GetDefaultThermalProfiles(),
+	})
+	require.NoError(t, err)
+	return c, wmi
+}
+
+func TestApplyRollback(t *testing.T) {
+	c, wmi := newApplyTest(t)
+
+	_, err := c.SwitchToProfile("Fanless")
+	require.NoError(t, err)
+	fanless := c.CurrentProfile()
+
+	wmi.dev, wmi.failures = atkacpi.DevsGPUFanCurve, 1
+	_, err = c.SwitchToProfile("Quiet")
+
+	var applyErr *ApplyError
+	require.True(t, errors.As(err, &applyErr))
+	require.True(t, errors.Is(err, errInjected))
+	require.Equal(t, StepGPUFanCurve, applyErr.Step)
+	require.Equal(t, "Quiet", applyErr.Profile)
+	require.Equal(t, "Fanless", applyErr.Previous)
+	require.True(t, applyErr.RolledBack)
+	require.Contains(t, err.Error(), "GPU fan curve failed")
+
+	// the CPU fan curve of Quiet was written, then restored
+	require.Equal(t, "Fanless", c.CurrentProfile().Name)
+	require.Equal(t, fanless.CPUFanCurve.Bytes(), wmi.FanCurve(atkacpi.DevsCPUFanCurve))
+	require.Equal(t, fanless.GPUFanCurve.Bytes(), wmi.FanCurve(atkacpi.DevsGPUFanCurve))
+}
+
+func TestApplyRollbackFailure(t *testing.T) {
+	c, wmi := newApplyTest(t)
+
+	// nothing to restore yet
+	wmi.dev, wmi.failures = atkacpi.DevsThrottleCtrl, 1
+	_, err := c.SwitchToProfile("Quiet")
+	var applyErr *ApplyError
+	require.True(t, errors.As(err, &applyErr))
+	require.Equal(t, StepThrottlePlan, applyErr.Step)
+	require.False(t, applyErr.RolledBack)
+	require.NoError(t, applyErr.RollbackErr)
+
+	_, err = c.SwitchToProfile("Quiet")
+	require.NoError(t, err)
+
+	// restoring fails as well
+	wmi.dev, wmi.failures = atkacpi.DevsCPUFanCurve, 2
+	_, err = c.SwitchToProfile("Fanless")
+	require.True(t, errors.As(err, &applyErr))
+	require.Equal(t, StepCPUFanCurve, applyErr.Step)
+	require.False(t, applyErr.RolledBack)
+	require.Error(t, applyErr.RollbackErr)
+	require.Equal(t, "Quiet", c.CurrentProfile().Name)
+}
+
+func TestApplyInvalidCurve(t *testing.T) {
+	c, wmi := newApplyTest(t)
+
+	_, err := c.SwitchToProfile("Fanless")
+	require.NoError(t, err)
+	fanless := c.CurrentProfile()
+
+	// a table the firmware would not take is not written, and the throttle plan is restored
+	profiles := GetDefaultThermalProfiles()
+	profiles[1].CPUFanCurve = &FanTable{ByteTable: make([]byte, 12)}
+	c.Config.Profiles = profiles
+	_, err = c.SwitchToProfile(profiles[1].ID)
+
+	var applyErr *ApplyError
+	require.True(t, errors.As(err, &applyErr))
+	require.Equal(t, StepCPUFanCurve, applyErr.Step)
+	require.True(t, applyErr.RolledBack)
+	require.Contains(t, err.Error(), "invalid cpu fan curve")
+	require.Equal(t, "Fanless", c.CurrentProfile().Name)
+	require.Equal(t, fanless.ThrottlePlan, wmi.ThrottlePlan())
+	require.Equal(t, fanless.CPUFanCurve.Bytes(), wmi.FanCurve(atkacpi.DevsCPUFanCurve))
+
+	// so is a table with a decreasing fan percentage
+	decreasing, err := NewFanTable("20c:0%,50c:0%,55c:0%,60c:0%,65c:31%,70c:49%,75c:56%,98c:56%")
+	require.NoError(t, err)
+	decreasing.ByteTable[15] = 40
+	profiles[1].CPUFanCurve = decreasing
+	_, err = c.SwitchToProfile(profiles[1].ID)
+	require.True(t, errors.As(err, &applyErr))
+	require.True(t, errors.Is(err, ErrFanPercentageDecreasing))
+	require.Equal(t, "Fanless", c.CurrentProfile().Name)
+}
@@ -0,0 +1,220 @@
+package thermal
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/zllovesuki/G14Manager/system/shared"
+)
+
+const (
+	// DefaultBoostDuration is the duration of a boost when neither the request nor the config has one
+	DefaultBoostDuration = time.Minute * 30
+	// MaximumBoostDuration is the longest boost
+	MaximumBoostDuration = time.Hour * 4
+	// boostCheckInterval is how often the boost is checked for the countdown and the end
+	boostCheckInterval = time.Second
+)
+
+// boostState is the active boost. Profile and Previous are profile IDs. It is persisted
+// with the current profile, so the boost survives a restart
+type boostState struct {
+	Profile  string
+	Previous string
+	Until    time.Time
+	shown    int // the minutes left last shown
+}
+
+// BoostStatus is the active boost, with the names of the profiles
+type BoostStatus struct {
+	Profile  string
+	Previous string
+	Until    time.Time
+}
+
+// ValidateBoost checks that the boost refers to one of the profiles (if any), that the duration
+// is within MaximumBoostDuration, and that the ROG key presses are not already remapped
+func ValidateBoost(b shared.Boost, profiles []Profile, rogRemap []string) error {
+	if b.Profile != "" && ResolveProfile(profiles, b.Profile) < 0 {
+		return fmt.Errorf("boost refers to unknown profile %s", b.Profile)
+	}
+	if b.Duration < 0 || b.Duration > MaximumBoostDuration {
+		return fmt.Errorf("boost duration must be between 0 and %s, got %s", MaximumBoostDuration, b.Duration)
+	}
+	if b.RogKeyPresses < 0 {
+		return fmt.Errorf("boost ROG key presses must not be negative, got %d", b.RogKeyPresses)
+	}
+	if b.RogKeyPresses > 0 && b.RogKeyPresses <= len(rogRemap) {
+		return fmt.Errorf("ROG key pressed %d time(s) already runs %s", b.RogKeyPresses, rogRemap[b.RogKeyPresses-1])
+	}
+	return nil
+}
+
+// boostProfileIndex returns the index of the profile to boost to: ref (an ID or name from the user),
+// the profile of the config (an ID), or the first Turbo profile, in that order. c.mu must be held
+func (c *Control) boostProfileIndex(ref string) (int, error) {
+	if ref != "" {
+		index := c.findProfileIndex(ref)
+		if index < 0 {
+			return -1, errors.New("Cannot find profile: " + ref)
+		}
+		return index, nil
+	}
+	if c.Boost.Profile != "" {
+		index := FindProfile(c.Config.Profiles, c.Boost.Profile)
+		if index < 0 {
+			return -1, errors.New("Cannot find profile: " + c.Boost.Profile)
+		}
+		return index, nil
+	}
+	for i, p := range c.Config.Profiles {
+		if p.ThrottlePlan == ThrottlePlanTurbo {
+			return i, nil
+		}
+	}
+	return -1, errors.New("no boost profile is configured, and there is no Turbo profile")
+}
+
+// StartBoost switches to the profile with the given ID or name for the duration, and reverts to the current profile
+// when the boost ends. Empty ref and zero duration use the config. Boosting again while boosting extends the boost,
+// and keeps the profile to revert to
+func (c *Control) StartBoost(ref string, duration time.Duration) (BoostStatus, error) {
+	c.mu.RLock()
+	var id string
+	index, err := c.boostProfileIndex(ref)
+	if err == nil {
+		id = c.Config.Profiles[index].ID
+	}
+	if duration == 0 {
+		duration = c.Boost.Duration
+	}
+	previous := c.currentProfileLocked().ID
+	if c.boost != nil {
+		previous = c.boost.Previous
+	}
+	c.mu.RUnlock()
+
+	if err != nil {
+		return BoostStatus{}, err
+	}
+	if duration == 0 {
+		duration = DefaultBoostDuration
+	}
+	if duration < 0 || duration > MaximumBoostDuration {
+		return BoostStatus{}, fmt.Errorf("boost duration must be between 0 and %s, got %s", MaximumBoostDuration, duration)
+	}
+
+	name, err := c.setProfileByID(id)
+	if err != nil {
+		return BoostStatus{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.boost = &boostState{
+		Profile:  id,
+		Previous: previous,
+		Until:    c.Clock.Now().Add(duration),
+		shown:    minutesLeft(duration),
+	}
+	log.Printf("thermal: boosting to %s until %s\n", name, c.boost.Until.Format("15:04:05"))
+	return c.boostStatus(), nil
+}
+
+// CancelBoost ends the active boost, and returns the name of the profile reverted to
+func (c *Control) CancelBoost() (string, error) {
+	if _, ok := c.CurrentBoost(); !ok {
+		return "", errors.New("no boost is active")
+	}
+	return c.endBoost("cancelled")
+}
+
+// CurrentBoost returns the active boost. ok is false if there is none
+func (c *Control) CurrentBoost() (status BoostStatus, ok bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.boost == nil {
+		return
+	}
+	return c.boostStatus(), true
+}
+
+// boostStatus returns the status of the active boost. c.mu must be held
+func (c *Control) boostStatus() BoostStatus {
+	return BoostStatus{
+		Profile:  c.profileName(c.boost.Profile),
+		Previous: c.profileName(c.boost.Previous),
+		Until:    c.boost.Until,
+	}
+}
+
+func (c *Control) boosting() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.boost != nil
+}
+
+// endBoost ends the boost and reverts to the profile before the boost. It returns the name of the profile
+// reverted to, or an empty string if there is no boost or the profile was changed during the boost
+func (c *Control) endBoost(why string) (string, error) {
+	c.mu.Lock()
+	b := c.boost
+	c.boost = nil
+	current := c.currentProfileLocked()
+	c.mu.Unlock()
+
+	if b == nil {
+		return "", nil
+	}
+	if current.ID != b.Profile {
+		log.Printf("thermal: boost ended (%s), keeping %s\n", why, current.Name)
+		return "", nil
+	}
+	log.Printf("thermal: boost ended (%s), reverting to %s\n", why, b.Previous)
+	return c.setProfileByID(b.Previous)
+}
+
+// checkBoost ends the boost when the time is up. Otherwise, it returns the countdown when the minutes left change.
+// A boost overridden by another profile (e.g. Fn+F5) ends without reverting
+func (c *Control) checkBoost(now time.Time) (string, error) {
+	c.mu.Lock()
+	b := c.boost
+	if b == nil {
+		c.mu.Unlock()
+		return "", nil
+	}
+	if current := c.currentProfileLocked(); current.ID != b.Profile {
+		c.boost = nil
+		c.mu.Unlock()
+		log.Printf("thermal: boost overridden by %s\n", current.Name)
+		return "", nil
+	}
+	if left := b.Until.Sub(now); left > 0 {
+		minutes := minutesLeft(left)
+		if minutes == b.shown {
+			c.mu.Unlock()
+			return "", nil
+		}
+		b.shown = minutes
+		name := c.profileName(b.Profile)
+		c.mu.Unlock()
+		return fmt.Sprintf("%s boost: %d min left", name, minutes), nil
+	}
+	c.mu.Unlock()
+
+	name, err := c.endBoost("time is up")
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Boost ended, thermal plan changed to %s", name), nil
+}
+
+// minutesLeft rounds up, so the countdown shows 1 min in the last minute
+func minutesLeft(d time.Duration) int {
+	return int((d + time.Minute - 1) / time.Minute)
+}
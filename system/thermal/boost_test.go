@@ -0,0 +1,128 @@
+package thermal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zllovesuki/G14Manager/system/shared"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoost(t *testing.T) {
+	c, clock := newScheduleTest(t)
+
+	_, err := c.CancelBoost()
+	require.Error(t, err)
+
+	// the first Turbo profile for the default duration
+	status, err := c.StartBoost("", 0)
+	require.NoError(t, err)
+	require.Equal(t, "Turbo", status.Profile)
+	require.Equal(t, "Fanless", status.Previous)
+	require.Equal(t, clock.now.Add(DefaultBoostDuration), status.Until)
+	require.Equal(t, "Turbo", c.CurrentProfile().Name)
+
+	// the countdown is shown when the minutes left change
+	message, err := c.checkBoost(clock.now)
+	require.NoError(t, err)
+	require.Empty(t, message)
+	clock.now = clock.now.Add(time.Minute + time.Second)
+	message, err = c.checkBoost(clock.now)
+	require.NoError(t, err)
+	require.Equal(t, "Turbo boost: 29 min left", message)
+	message, err = c.checkBoost(clock.now)
+	require.NoError(t, err)
+	require.Empty(t, message)
+
+	// rules are not checked while boosting
+	next, _, err := c.checkRules()
+	require.NoError(t, err)
+	require.Empty(t, next)
+
+	// boosting again extends the boost, and keeps the profile to revert to
+	status, err = c.StartBoost("performance", time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, "Performance", status.Profile)
+	require.Equal(t, "Fanless", status.Previous)
+
+	clock.now = clock.now.Add(time.Hour)
+	message, err = c.checkBoost(clock.now)
+	require.NoError(t, err)
+	require.Equal(t, "Boost ended, thermal plan changed to Fanless", message)
+	require.Equal(t, "Fanless", c.CurrentProfile().Name)
+	_, ok := c.CurrentBoost()
+	require.False(t, ok)
+
+	_, err = c.StartBoost("", MaximumBoostDuration+time.Minute)
+	require.Error(t, err)
+	_, err = c.StartBoost("Nonexistent", 0)
+	require.Error(t, err)
+}
+
+func TestBoostOverridden(t *testing.T) {
+	c, clock := newScheduleTest(t)
+
+	_, err := c.StartBoost("Turbo", time.Minute*10)
+	require.NoError(t, err)
+
+	// changing the profile during the boost ends the boost without reverting
+	_, err = c.SwitchToProfile("Quiet")
+	require.NoError(t, err)
+	message, err := c.checkBoost(clock.now)
+	require.NoError(t, err)
+	require.Empty(t, message)
+	_, ok := c.CurrentBoost()
+	require.False(t, ok)
+	require.Equal(t, "Quiet", c.CurrentProfile().Name)
+
+	_, err = c.StartBoost("Turbo", time.Minute*10)
+	require.NoError(t, err)
+	name, err := c.CancelBoost()
+	require.NoError(t, err)
+	require.Equal(t, "Quiet", name)
+}
+
+func TestBoostPersisted(t *testing.T) {
+	c, clock := newScheduleTest(t)
+
+	_, err := c.StartBoost("Turbo", time.Minute*10)
+	require.NoError(t, err)
+	v := c.Value()
+
+	// the boost survives a restart
+	restarted, _ := newScheduleTest(t)
+	restarted.Clock = clock
+	require.NoError(t, restarted.Load(v))
+	require.Equal(t, "Turbo", restarted.CurrentProfile().Name)
+	status, ok := restarted.CurrentBoost()
+	require.True(t, ok)
+	require.Equal(t, "Fanless", status.Previous)
+
+	// and reverts if it ended in the meantime
+	clock.now = clock.now.Add(time.Minute * 10)
+	restarted, _ = newScheduleTest(t)
+	restarted.Clock = clock
+	require.NoError(t, restarted.Load(v))
+	require.Equal(t, "Fanless", restarted.CurrentProfile().Name)
+	_, ok = restarted.CurrentBoost()
+	require.False(t, ok)
+}
+
+func TestValidateBoost(t *testing.T) {
+	profiles := GetDefaultThermalProfiles()
+	rogRemap := []string{"Taskmgr.exe"}
+	require.NoError(t, ValidateBoost(shared.Boost{}, profiles, rogRemap))
+	require.NoError(t, ValidateBoost(shared.Boost{Profile: "turbo", Duration: time.Hour, RogKeyPresses: 2}, profiles, rogRemap))
+
+	invalid := []shared.Boost{
+		{Profile: "Nonexistent"},
+		{Duration: -time.Minute},
+		{Duration: MaximumBoostDuration + time.Minute},
+		{RogKeyPresses: -1},
+		{RogKeyPresses: 1},
+	}
+	for _, b := range invalid {
+		require.Error(t, ValidateBoost(b, profiles, rogRemap))
+	}
+}
@@ -0,0 +1,316 @@
+package thermal
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Interpolation defines how fan percentages between control points are computed
+type Interpolation int
+
+// Defines the supported interpolations
+const (
+	InterpolationLinear Interpolation = iota
+	// InterpolationMonotoneCubic is a smooth curve that never overshoots the control points (Fritsch-Carlson)
+	InterpolationMonotoneCubic
+)
+
+func (i Interpolation) String() string {
+	return [...]string{
+		"linear",
+		"cubic",
+	}[i]
+}
+
+// Defines the reasons a curve is rejected, in addition to the ones of FanTable
+var (
+	ErrTooFewPoints          = errors.New("Curve must have at least 2 points")
+	ErrDuplicatedTemperature = errors.New("Temperature must not repeat")
+	ErrTemperatureSpanTooLow = errors.New("Curve must span at least 7 degrees")
+	ErrUnknownInterpolation  = errors.New("Interpolation must be linear or cubic")
+)
+
+// CurvePoint is a control point of a Curve
+type CurvePoint struct {
+	Temperature   int
+	FanPercentage int
+}
+
+// Curve is a fan curve with any number of control points. Since the embedded controller only
+// accepts 8 points, the curve is resampled with FanTable
+type Curve struct {
+	Points        []CurvePoint
+	Interpolation Interpolation
+
+	// tangents of the monotone cubic
+	tangents []float64
+}
+
+// NewCurve returns a Curve with the control points sorted by temperature
+func NewCurve(points []CurvePoint, interpolation Interpolation) (*Curve, error) {
+	if interpolation != InterpolationLinear && interpolation != InterpolationMonotoneCubic {
+		return nil, &FanTableError{Err: ErrUnknownInterpolation}
+	}
+	if len(points) < 2 {
+		return nil, &FanTableError{Err: fmt.Errorf("%w, got %d", ErrTooFewPoints, len(points))}
+	}
+	c := &Curve{
+		Points:        make([]CurvePoint, len(points)),
+		Interpolation: interpolation,
+	}
+	for i, p := range points {
+		if p.Temperature < minTemperature || p.Temperature > maxTemperature {
+			return nil, c.pointError(i, p, ErrTemperatureRange)
+		}
+		if p.FanPercentage < 0 || p.FanPercentage > 100 {
+			return nil, c.pointError(i, p, ErrFanPercentageRange)
+		}
+	}
+	copy(c.Points, points)
+	sort.SliceStable(c.Points, func(i, j int) bool {
+		return c.Points[i].Temperature < c.Points[j].Temperature
+	})
+	for i := 1; i < len(c.Points); i++ {
+		if c.Points[i].Temperature == c.Points[i-1].Temperature {
+			return nil, c.pointError(i, c.Points[i], ErrDuplicatedTemperature)
+		}
+	}
+	// 8 distinct temperatures are needed for the table
+	if c.Points[len(c.Points)-1].Temperature-c.Points[0].Temperature < 7 {
+		return nil, &FanTableError{Err: ErrTemperatureSpanTooLow}
+	}
+	if interpolation == InterpolationMonotoneCubic {
+		c.tangents = c.monotoneTangents()
+	}
+	return c, nil
+}
+
+// ParseCurve parses a curve in the format of "cubic:20c:0%,60c:20%,90c:100%". The interpolation
+// prefix ("linear:" or "cubic:") is optional and defaults to linear. Errors returned are *FanTableError
+func ParseCurve(curve string) (*Curve, error) {
+	interpolation := InterpolationLinear
+	curve = strings.TrimSpace(curve)
+	for _, i := range []Interpolation{InterpolationLinear, InterpolationMonotoneCubic} {
+		if strings.HasPrefix(curve, i.String()+":") {
+			interpolation = i
+			curve = strings.TrimPrefix(curve, i.String()+":")
+			break
+		}
+	}
+	texts := strings.Split(curve, ",")
+	points := make([]CurvePoint, 0, len(texts))
+	for i, p := range texts {
+		match := pointRe.FindStringSubmatch(p)
+		if match == nil {
+			return nil, pointError(i, texts, ErrMalformedPoint)
+		}
+		degree, _ := strconv.Atoi(match[1])
+		fanPct, _ := strconv.Atoi(match[2])
+		points = append(points, CurvePoint{
+			Temperature:   degree,
+			FanPercentage: fanPct,
+		})
+	}
+	return NewCurve(points, interpolation)
+}
+
+// isCurve returns true if the string has an interpolation prefix
+func isCurve(curve string) bool {
+	for _, i := range []Interpolation{InterpolationLinear, InterpolationMonotoneCubic} {
+		if strings.HasPrefix(strings.TrimSpace(curve), i.String()+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// At returns the fan percentage at the temperature. Temperatures outside of
+// the control points take the fan percentage of the nearest point
+func (c *Curve) At(temperature float64) float64 {
+	first, last := c.Points[0], c.Points[len(c.Points)-1]
+	if temperature <= float64(first.Temperature) {
+		return float64(first.FanPercentage)
+	}
+	if temperature >= float64(last.Temperature) {
+		return float64(last.FanPercentage)
+	}
+	k := sort.Search(len(c.Points), func(i int) bool {
+		return float64(c.Points[i].Temperature) > temperature
+	}) - 1
+	x0, x1 := float64(c.Points[k].Temperature), float64(c.Points[k+1].Temperature)
+	y0, y1 := float64(c.Points[k].FanPercentage), float64(c.Points[k+1].FanPercentage)
+	h := x1 - x0
+	t := (temperature - x0) / h
+
+	if c.Interpolation == InterpolationLinear {
+		return y0 + t*(y1-y0)
+	}
+
+	// cubic Hermite spline
+	t2, t3 := t*t, t*t*t
+	h00 := 2*t3 - 3*t2 + 1
+	h10 := t3 - 2*t2 + t
+	h01 := -2*t3 + 3*t2
+	h11 := t3 - t2
+	y := h00*y0 + h10*h*c.tangents[k] + h01*y1 + h11*h*c.tangents[k+1]
+	return math.Max(0, math.Min(100, y))
+}
+
+// monotoneTangents computes the tangents with Fritsch-Carlson method
+func (c *Curve) monotoneTangents() []float64 {
+	n := len(c.Points)
+	secants := make([]float64, n-1)
+	for k := 0; k < n-1; k++ {
+		secants[k] = float64(c.Points[k+1].FanPercentage-c.Points[k].FanPercentage) /
+			float64(c.Points[k+1].Temperature-c.Points[k].Temperature)
+	}
+	m := make([]float64, n)
+	m[0], m[n-1] = secants[0], secants[n-2]
+	for k := 1; k < n-1; k++ {
+		if secants[k-1]*secants[k] > 0 {
+			m[k] = (secants[k-1] + secants[k]) / 2
+		}
+	}
+	for k := 0; k < n-1; k++ {
+		if secants[k] == 0 {
+			m[k], m[k+1] = 0, 0
+			continue
+		}
+		a, b := m[k]/secants[k], m[k+1]/secants[k]
+		if a < 0 {
+			m[k], a = 0, 0
+		}
+		if b < 0 {
+			m[k+1], b = 0, 0
+		}
+		if s := a*a + b*b; s > 9 {
+			tau := 3 / math.Sqrt(s)
+			m[k] = tau * a * secants[k]
+			m[k+1] = tau * b * secants[k]
+		}
+	}
+	return m
+}
+
+// FanTable resamples the curve to the 8 points required by the embedded controller, validated
+// against the safety floor. If there are more than 8 control points, temperatures are picked
+// greedily where the resampled table deviates from the curve the most. It also returns the quantization error: the maximum difference in
+// fan percentage between the curve and the table (assuming the embedded controller interpolates
+// linearly between points), including rounding
+func (c *Curve) FanTable(floor SafetyFloor) (*FanTable, float64, error) {
+	low, high := c.Points[0].Temperature, c.Points[len(c.Points)-1].Temperature
+	selected := map[int]bool{low: true, high: true}
+	if len(c.Points) <= 8 {
+		// control points fit in the table, so a table parsed as a curve is resampled to itself
+		for _, p := range c.Points {
+			selected[p.Temperature] = true
+		}
+	}
+
+	for len(selected) < 8 {
+		next, ok := c.nextSample(selected, low, high)
+		if !ok {
+			return nil, 0, &FanTableError{Err: ErrTemperatureSpanTooLow}
+		}
+		selected[next] = true
+	}
+
+	temps := make([]int, 0, 8)
+	for t := range selected {
+		temps = append(temps, t)
+	}
+	sort.Ints(temps)
+
+	t := &FanTable{
+		ByteTable: make([]byte, 16),
+	}
+	for i, temp := range temps {
+		t.ByteTable[i] = byte(temp)
+		t.ByteTable[i+8] = byte(math.Round(c.At(float64(temp))))
+	}
+	if err := t.Validate(floor); err != nil {
+		return nil, 0, err
+	}
+	t.resampled, t.quantErr = true, c.quantizationError(temps, low, high)
+	return t, t.quantErr, nil
+}
+
+// nextSample returns the temperature with the largest error. If the table matches the curve
+// already, it returns the middle of the largest gap so the points are spread out.
+// ok is false if every temperature is sampled
+func (c *Curve) nextSample(selected map[int]bool, low, high int) (next int, ok bool) {
+	temps := make([]int, 0, len(selected))
+	for t := range selected {
+		temps = append(temps, t)
+	}
+	sort.Ints(temps)
+
+	best, bestErr := -1, 0.0
+	for t := low + 1; t < high; t++ {
+		if selected[t] {
+			continue
+		}
+		if e := math.Abs(c.At(float64(t)) - c.tableAt(temps, float64(t))); e > bestErr+1e-9 {
+			best, bestErr = t, e
+		}
+	}
+	if best >= 0 {
+		return best, true
+	}
+
+	gap := 0
+	for i := 1; i < len(temps); i++ {
+		if d := temps[i] - temps[i-1]; d > 1 && d > gap {
+			gap = d
+			best = temps[i-1] + d/2
+		}
+	}
+	return best, best >= 0
+}
+
+// tableAt interpolates linearly between the rounded fan percentages at the sampled temperatures
+func (c *Curve) tableAt(temps []int, temperature float64) float64 {
+	k := sort.Search(len(temps), func(i int) bool {
+		return float64(temps[i]) > temperature
+	}) - 1
+	if k < 0 {
+		return math.Round(c.At(float64(temps[0])))
+	}
+	if k >= len(temps)-1 {
+		return math.Round(c.At(float64(temps[len(temps)-1])))
+	}
+	x0, x1 := float64(temps[k]), float64(temps[k+1])
+	y0, y1 := math.Round(c.At(x0)), math.Round(c.At(x1))
+	return y0 + (temperature-x0)/(x1-x0)*(y1-y0)
+}
+
+func (c *Curve) quantizationError(temps []int, low, high int) float64 {
+	maxErr := 0.0
+	for t := low; t <= high; t++ {
+		if e := math.Abs(c.At(float64(t)) - c.tableAt(temps, float64(t))); e > maxErr {
+			maxErr = e
+		}
+	}
+	return maxErr
+}
+
+// String returns the curve in the format accepted by ParseCurve
+func (c *Curve) String() string {
+	points := make([]string, 0, len(c.Points))
+	for _, p := range c.Points {
+		points = append(points, fmt.Sprintf("%dc:%d%%", p.Temperature, p.FanPercentage))
+	}
+	return c.Interpolation.String() + ":" + strings.Join(points, ",")
+}
+
+func (c *Curve) pointError(i int, p CurvePoint, err error) *FanTableError {
+	return &FanTableError{
+		Point: i + 1,
+		Value: fmt.Sprintf("%dc:%d%%", p.Temperature, p.FanPercentage),
+		Err:   err,
+	}
+}
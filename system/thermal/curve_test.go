@@ -0,0 +1,109 @@
+package thermal
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCurveLinear(t *testing.T) {
+	c, err := ParseCurve("20c:0%,60c:20%,100c:100%")
+	require.NoError(t, err)
+	require.Equal(t, InterpolationLinear, c.Interpolation)
+	require.Equal(t, 10.0, c.At(40))
+	require.Equal(t, 0.0, c.At(10))
+	require.Equal(t, 100.0, c.At(110))
+
+	table, quantErr, err := c.FanTable(DefaultSafetyFloor)
+	require.NoError(t, err)
+	// control points are kept, and the table is exact since the curve is piecewise linear
+	require.Equal(t, byte(20), table.ByteTable[0])
+	require.Equal(t, byte(100), table.ByteTable[7])
+	require.Contains(t, table.String(), "60c:20%")
+	require.InDelta(t, 0, quantErr, 0.5)
+
+	// round trip
+	parsed, err := NewFanTable(table.String())
+	require.NoError(t, err)
+	require.Equal(t, table.Bytes(), parsed.Bytes())
+}
+
+func TestCurveMonotoneCubic(t *testing.T) {
+	c, err := ParseCurve("cubic:30c:0%,40c:5%,50c:10%,60c:20%,70c:35%,80c:55%,90c:65%,95c:90%,100c:100%")
+	require.NoError(t, err)
+	require.Equal(t, "cubic:30c:0%,40c:5%,50c:10%,60c:20%,70c:35%,80c:55%,90c:65%,95c:90%,100c:100%", c.String())
+
+	// passes through control points without overshooting
+	require.InDelta(t, 35, c.At(70), 1e-9)
+	prev := -1.0
+	for temp := 30.0; temp <= 100; temp += 0.5 {
+		v := c.At(temp)
+		require.GreaterOrEqual(t, v, prev, "%.1fc", temp)
+		prev = v
+	}
+
+	table, quantErr, err := c.FanTable(DefaultSafetyFloor)
+	require.NoError(t, err)
+	require.NoError(t, table.Validate(DefaultSafetyFloor))
+	require.Less(t, quantErr, 5.0)
+	require.Greater(t, quantErr, 0.0)
+	cubicErr := quantErr
+
+	// a table parsed as a curve resamples to itself
+	again, err := ParseCurve("linear:" + table.String())
+	require.NoError(t, err)
+	resampled, quantErr, err := again.FanTable(DefaultSafetyFloor)
+	require.NoError(t, err)
+	require.Equal(t, table.String(), resampled.String())
+	require.Equal(t, 0.0, quantErr)
+
+	// ParseFanTable accepts curves with a prefix, and returns the quantization error with the table
+	parsed, err := NewFanTable(c.String())
+	require.NoError(t, err)
+	require.Equal(t, table.Bytes(), parsed.Bytes())
+	ok, parsedErr := parsed.Resampled()
+	require.True(t, ok)
+	require.Equal(t, cubicErr, parsedErr)
+
+	// the smallest span gives a point per degree
+	narrow, err := NewFanTable("linear:20c:0%,27c:70%")
+	require.NoError(t, err)
+	require.Equal(t, "20c:0%,21c:10%,22c:20%,23c:30%,24c:40%,25c:50%,26c:60%,27c:70%", narrow.String())
+}
+
+func TestResampleReport(t *testing.T) {
+	cpu, err := NewFanTable("linear:20c:0%,60c:20%,100c:100%")
+	require.NoError(t, err)
+	gpu, err := NewFanTable("20c:0%,50c:0%,55c:0%,60c:0%,65c:31%,70c:49%,75c:56%,98c:56%")
+	require.NoError(t, err)
+	ok, _ := gpu.Resampled()
+	require.False(t, ok)
+
+	require.Equal(t, "", ResampleReport([]Profile{{Name: "Quiet", GPUFanCurve: gpu}}))
+	require.Equal(t, "Profile Quiet: CPU fan curve resampled to "+cpu.String()+" (quantization error 0.0%)",
+		ResampleReport([]Profile{{Name: "Quiet", CPUFanCurve: cpu, GPUFanCurve: gpu}}))
+}
+
+func TestCurveErrors(t *testing.T) {
+	cases := []struct {
+		curve string
+		err   error
+	}{
+		{"cubic:20c:0%", ErrTooFewPoints},
+		{"cubic:20c:0%,24c:10%", ErrTemperatureSpanTooLow},
+		{"linear:20c:0%,26c:10%", ErrTemperatureSpanTooLow},
+		{"linear:20c:0%,60c:10%,60c:20%", ErrDuplicatedTemperature},
+		{"linear:20c:0%,60c:10%,200c:20%", ErrTemperatureRange},
+		{"cubic:20c:0%,60c:0%,98c:0%", ErrBelowSafetyFloor},
+	}
+	for _, c := range cases {
+		_, err := NewFanTable(c.curve)
+		require.True(t, errors.Is(err, c.err), "%s: %v", c.curve, err)
+		var fErr *FanTableError
+		require.True(t, errors.As(err, &fErr))
+	}
+
+	_, err := ParseCurve("spline:20c:0%,60c:10%")
+	require.True(t, errors.Is(err, ErrMalformedPoint))
+}
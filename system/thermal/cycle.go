@@ -0,0 +1,63 @@
+package thermal
+
+import (
+	"fmt"
+	"log"
+)
+
+// ValidateCycleProfiles checks that the cycle list refers to existing profiles without duplicates
+func ValidateCycleProfiles(names []string, profiles []Profile) error {
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if seen[name] {
+			return fmt.Errorf("profile %s is in the cycle list more than once", name)
+		}
+		seen[name] = true
+		if ResolveProfile(profiles, name) < 0 {
+			return fmt.Errorf("cycle list refers to unknown profile %s", name)
+		}
+	}
+	return nil
+}
+
+// cycleList returns the indices of the profiles Fn+F5 cycles through. c.mu must be held
+func (c *Control) cycleList() []int {
+	list := make([]int, 0, len(c.Config.Profiles))
+	for _, id := range c.CycleProfiles {
+		if i := FindProfile(c.Config.Profiles, id); i >= 0 {
+			list = append(list, i)
+		} else {
+			log.Printf("thermal: cycle list refers to unknown profile %s\n", id)
+		}
+	}
+	if len(list) > 0 {
+		return list
+	}
+	for i := range c.Config.Profiles {
+		list = append(list, i)
+	}
+	return list
+}
+
+// cycleTarget returns the ID and name of the profile howMany steps away from the current profile in the cycle list.
+// Negative howMany cycles backward. If the current profile is not in the list, the first step
+// lands on the first (or last, if backward) profile in the list
+func (c *Control) cycleTarget(howMany int) (id string, name string) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	list := c.cycleList()
+	n := len(list)
+	pos := -1
+	for i, index := range list {
+		if index == c.currentProfileIndex {
+			pos = i
+			break
+		}
+	}
+	if pos < 0 && howMany < 0 {
+		pos = n
+	}
+	target := c.Config.Profiles[list[((pos+howMany)%n+n)%n]]
+	return target.ID, target.Name
+}
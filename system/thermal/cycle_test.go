@@ -0,0 +1,78 @@
+package thermal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/zllovesuki/G14Manager/system/plugin"
+	"github.com/zllovesuki/G14Manager/util"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCycleProfiles(t *testing.T) {
+	c, _ := newScheduleTest(t)
+	names := make([]string, 0, len(c.Config.Profiles))
+	for _, p := range c.Config.Profiles {
+		names = append(names, p.Name)
+	}
+	target := func(howMany int) string {
+		_, name := c.cycleTarget(howMany)
+		return name
+	}
+
+	// every profile in order by default, in both directions
+	require.Equal(t, names[1], target(1))
+	require.Equal(t, names[len(names)-1], target(-1))
+	require.Equal(t, names[0], target(len(names)))
+
+	// references in the config are IDs
+	c.CycleProfiles = []string{"quiet", "balanced", "performance"}
+	_, err := c.SwitchToProfile("Balanced")
+	require.NoError(t, err)
+	require.Equal(t, "Performance", target(1))
+	require.Equal(t, "Quiet", target(-1))
+	require.Equal(t, "Quiet", target(2))
+	require.Equal(t, "Performance", target(-5))
+
+	// hidden profiles are only reachable directly, and cycling from them starts at either end
+	_, err = c.SwitchToProfile("Turbo")
+	require.NoError(t, err)
+	require.Equal(t, "Quiet", target(1))
+	require.Equal(t, "Performance", target(-1))
+
+	name, err := c.NextProfile(-2)
+	require.NoError(t, err)
+	require.Equal(t, "Balanced", name)
+}
+
+func TestCyclePreview(t *testing.T) {
+	c, _ := newScheduleTest(t)
+	c.CycleProfiles = []string{"fanless", "quiet", "balanced"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cb := make(chan plugin.Callback, 4)
+	c.Run(ctx, cb)
+
+	// the preview does not switch the profile
+	c.Notify(plugin.Notification{Event: plugin.EvtSentinelPreviewThermalProfile, Value: int64(-1)})
+	n := (<-cb).Value.(util.Notification)
+	require.Equal(t, "Next thermal plan: Balanced", n.Message)
+	require.True(t, n.Immediate)
+	require.Equal(t, "Fanless", c.CurrentProfile().Name)
+
+	// pressing forward and backward by the same steps is a no-op
+	c.Notify(plugin.Notification{Event: plugin.EvtSentinelCycleThermalProfile, Value: int64(0)})
+	c.Notify(plugin.Notification{Event: plugin.EvtSentinelCycleThermalProfile, Value: int64(-1)})
+	require.Equal(t, "Thermal plan changed to Balanced", (<-cb).Value.(util.Notification).Message)
+	require.Equal(t, plugin.CbPersistConfig, (<-cb).Event)
+}
+
+func TestValidateCycleProfiles(t *testing.T) {
+	profiles := GetDefaultThermalProfiles()
+	require.NoError(t, ValidateCycleProfiles(nil, profiles))
+	require.NoError(t, ValidateCycleProfiles([]string{"Quiet", "Turbo"}, profiles))
+	require.Error(t, ValidateCycleProfiles([]string{"Quiet", "Quiet"}, profiles))
+	require.Error(t, ValidateCycleProfiles([]string{"Nonexistent"}, profiles))
+}
@@ -44,6 +44,7 @@ func GetDefaultThermalProfiles() []Profile {
 		var cpuTable, gpuTable *FanTable
 		var err error
 		profile := Profile{
+			ID:               ProfileID(d.name),
 			Name:             d.name,
 			ThrottlePlan:     d.throttlePlan,
 			WindowsPowerPlan: d.windowsPowerPlan,
@@ -0,0 +1,47 @@
+package thermal
+
+import (
+	"github.com/zllovesuki/G14Manager/system/atkacpi"
+	"github.com/zllovesuki/G14Manager/system/drift"
+)
+
+var _ drift.Checker = &Control{}
+
+// CheckDrift satisfies system/drift.Checker. The throttle plan is compared with what the embedded controller
+// reported when the current profile was applied. Fan curves are not checked, as the firmware only reports
+// the factory fan curves, not the ones that were written
+func (c *Control) CheckDrift() ([]drift.Drift, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.applied == nil {
+		return nil, nil
+	}
+
+	var drifts []drift.Drift
+
+	if c.readBack.ThrottlePlanState == ReadBackVerified {
+		resp, err := atkacpi.DstsGet(atkacpi.DevsThrottleCtrl).Execute(c.wmi)
+		if err != nil {
+			return nil, err
+		}
+		plan, err := resp.ThrottlePlan()
+		if err != nil {
+			return nil, err
+		}
+		if plan != c.readBack.ThrottlePlan {
+			drifts = append(drifts, drift.Drift{
+				Setting:  "throttle plan",
+				Desired:  ThrottlePlanName(c.readBack.ThrottlePlan),
+				Reported: ThrottlePlanName(plan),
+			})
+		}
+	}
+
+	return drifts, nil
+}
+
+// Reapply satisfies system/drift.Checker
+func (c *Control) Reapply() error {
+	return c.Apply()
+}
@@ -0,0 +1,65 @@
+package thermal
+
+import (
+	"testing"
+
+	"github.com/zllovesuki/G14Manager/system/atkacpi"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckDrift(t *testing.T) {
+	c, wmi := newReadBackTest(t)
+
+	// nothing was applied yet
+	drifts, err := c.CheckDrift()
+	require.NoError(t, err)
+	require.Len(t, drifts, 0)
+
+	_, err = c.SwitchToProfile("Quiet")
+	require.NoError(t, err)
+
+	drifts, err = c.CheckDrift()
+	require.NoError(t, err)
+	require.Len(t, drifts, 0)
+
+	// other software switches the throttle plan, which resets the fan curves
+	_, err = atkacpi.DevsSet(atkacpi.DevsThrottleCtrl, ThrottlePlanTurbo).Execute(wmi.Simulator)
+	require.NoError(t, err)
+
+	// only the throttle plan is checked
+	drifts, err = c.CheckDrift()
+	require.NoError(t, err)
+	require.Len(t, drifts, 1)
+	require.Equal(t, "throttle plan", drifts[0].Setting)
+	require.Equal(t, "Performance", drifts[0].Desired)
+	require.Equal(t, "Turbo", drifts[0].Reported)
+
+	require.NoError(t, c.Reapply())
+	require.Equal(t, ThrottlePlanPerformance, wmi.Simulator.ThrottlePlan())
+	require.Equal(t, c.CurrentProfile().CPUFanCurve.Bytes(), wmi.Simulator.FanCurve(atkacpi.DevsCPUFanCurve))
+
+	drifts, err = c.CheckDrift()
+	require.NoError(t, err)
+	require.Len(t, drifts, 0)
+}
+
+func TestCheckDriftFactoryCurves(t *testing.T) {
+	c, wmi := newReadBackTest(t)
+
+	// the simulator reports the factory curves, which are not compared with the custom curves
+	_, err := c.SwitchToProfile("Fanless")
+	require.NoError(t, err)
+
+	drifts, err := c.CheckDrift()
+	require.NoError(t, err)
+	require.Len(t, drifts, 0)
+
+	_, err = atkacpi.DevsSet(atkacpi.DevsThrottleCtrl, ThrottlePlanSilent).Execute(wmi.Simulator)
+	require.NoError(t, err)
+
+	drifts, err = c.CheckDrift()
+	require.NoError(t, err)
+	require.Len(t, drifts, 1)
+	require.Equal(t, "throttle plan", drifts[0].Setting)
+}
@@ -0,0 +1,151 @@
+package thermal
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/zllovesuki/G14Manager/system/atkacpi"
+)
+
+// ThrottlePlans lists all the throttle plans known to the embedded controller
+var ThrottlePlans = []uint32{
+	ThrottlePlanPerformance,
+	ThrottlePlanTurbo,
+	ThrottlePlanSilent,
+}
+
+// FactoryCurve contains the default fan curves of a throttle plan, as programmed in the embedded controller
+type FactoryCurve struct {
+	ThrottlePlan uint32
+	CPUFanCurve  *FanTable
+	GPUFanCurve  *FanTable
+}
+
+// ReadFactoryCurve reads the default fan curves of the given throttle plan from the embedded controller
+func ReadFactoryCurve(wmi atkacpi.WMI, throttlePlan uint32) (FactoryCurve, error) {
+	cpu, err := readFactoryFanTable(wmi, atkacpi.DstsDefaultCPUFanCurve, throttlePlan)
+	if err != nil {
+		return FactoryCurve{}, fmt.Errorf("cannot read default cpu fan curve of throttle plan 0x%x: %w", throttlePlan, err)
+	}
+	gpu, err := readFactoryFanTable(wmi, atkacpi.DstsDefaultGPUFanCurve, throttlePlan)
+	if err != nil {
+		return FactoryCurve{}, fmt.Errorf("cannot read default gpu fan curve of throttle plan 0x%x: %w", throttlePlan, err)
+	}
+	return FactoryCurve{
+		ThrottlePlan: throttlePlan,
+		CPUFanCurve:  cpu,
+		GPUFanCurve:  gpu,
+	}, nil
+}
+
+// ReadFactoryCurves reads the default fan curves of all throttle plans from the embedded controller
+func ReadFactoryCurves(wmi atkacpi.WMI) ([]FactoryCurve, error) {
+	curves := make([]FactoryCurve, 0, len(ThrottlePlans))
+	for _, plan := range ThrottlePlans {
+		curve, err := ReadFactoryCurve(wmi, plan)
+		if err != nil {
+			return nil, err
+		}
+		curves = append(curves, curve)
+	}
+	return curves, nil
+}
+
+func readFactoryFanTable(wmi atkacpi.WMI, dev uint32, throttlePlan uint32) (*FanTable, error) {
+	resp, err := atkacpi.DstsGetWithParam(dev, throttlePlan).Execute(wmi)
+	if err != nil {
+		return nil, err
+	}
+	b, err := resp.FanCurve()
+	if err != nil {
+		return nil, err
+	}
+	return NewFanTableFromBytes(b)
+}
+
+// FactoryCurves returns the default fan curves of all throttle plans. The curves are read from
+// the embedded controller once, and cached afterward
+func (c *Control) FactoryCurves() ([]FactoryCurve, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.factoryCurvesLocked()
+}
+
+func (c *Control) factoryCurvesLocked() ([]FactoryCurve, error) {
+	if c.factoryCurves != nil {
+		return c.factoryCurves, nil
+	}
+	curves, err := ReadFactoryCurves(c.wmi)
+	if err != nil {
+		return nil, err
+	}
+	c.factoryCurves = curves
+	return curves, nil
+}
+
+// FactoryProfile returns a copy of the profile with the given ID or name, with both fan curves
+// replaced by the factory curves of its throttle plan
+func (c *Control) FactoryProfile(name string) (Profile, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	index := c.findProfileIndex(name)
+	if index < 0 {
+		return Profile{}, errors.New("Cannot find profile: " + name)
+	}
+
+	return c.factoryProfileLocked(c.Config.Profiles[index])
+}
+
+func (c *Control) factoryProfileLocked(profile Profile) (Profile, error) {
+	curves, err := c.factoryCurvesLocked()
+	if err != nil {
+		return Profile{}, err
+	}
+	for _, curve := range curves {
+		if curve.ThrottlePlan == profile.ThrottlePlan {
+			profile.CPUFanCurve = curve.CPUFanCurve
+			profile.GPUFanCurve = curve.GPUFanCurve
+			return profile, nil
+		}
+	}
+	return Profile{}, fmt.Errorf("no factory curve for throttle plan 0x%x", profile.ThrottlePlan)
+}
+
+// ResetProfileToFactory replaces the fan curves of the profile with the given ID or name with the factory
+// curves of its throttle plan. If the profile is currently active, it will be reapplied.
+func (c *Control) ResetProfileToFactory(name string) (Profile, error) {
+	c.mu.Lock()
+	index := c.findProfileIndex(name)
+	if index < 0 {
+		c.mu.Unlock()
+		return Profile{}, errors.New("Cannot find profile: " + name)
+	}
+	profile, err := c.factoryProfileLocked(c.Config.Profiles[index])
+	if err != nil {
+		c.mu.Unlock()
+		return Profile{}, err
+	}
+
+	// copy on write, as the profiles slice may be shared with whoever announced it
+	profiles := make([]Profile, len(c.Config.Profiles))
+	copy(profiles, c.Config.Profiles)
+	profiles[index] = profile
+	c.Config.Profiles = profiles
+
+	isCurrent := index == c.currentProfileIndex
+	c.mu.Unlock()
+
+	log.Printf("thermal: profile %s reset to factory fan curves\n", name)
+
+	if isCurrent {
+		// the profiles may be updated in the meantime, so reapply by ID instead of index
+		if _, err := c.setProfileByID(profile.ID); err != nil {
+			return profile, err
+		}
+	}
+
+	return profile, nil
+}
@@ -5,51 +5,221 @@ package thermal
 import (
 	"errors"
 	"fmt"
+	"log"
 	"regexp"
 	"strconv"
+	"strings"
 )
 
 var (
-	curveRe = regexp.MustCompile(`\s*(\d{1,3})c:(\d{1,3})%\s*`)
+	pointRe = regexp.MustCompile(`^\s*(\d{1,3})c:(\d{1,3})%\s*$`)
 )
 
+// Defines the reasons a fan curve is rejected
+var (
+	ErrPointCount              = errors.New("Fan curve must have exactly 8 points")
+	ErrMalformedPoint          = errors.New("Point must be in the format of 60c:30%")
+	ErrTemperatureRange        = errors.New("Temperature must be between 20C and 120C")
+	ErrFanPercentageRange      = errors.New("Fan percentage must be between 0% and 100%")
+	ErrTemperatureDecreasing   = errors.New("Temperature must not decrease")
+	ErrFanPercentageDecreasing = errors.New("Fan percentage must not decrease")
+	ErrBelowSafetyFloor        = errors.New("Fan percentage is below the safety floor")
+)
+
+const (
+	minTemperature = 20
+	maxTemperature = 120
+)
+
+// FanTableError describes why a fan curve is rejected. Use errors.Is to check the reason
+type FanTableError struct {
+	// Point is the 1-based index of the offending point, or 0 if the curve as a whole is invalid
+	Point int
+	// Value is the offending point as written
+	Value string
+	Err   error
+}
+
+func (e *FanTableError) Error() string {
+	if e.Point == 0 {
+		return fmt.Sprintf("fan curve: %s", e.Err)
+	}
+	return fmt.Sprintf("fan curve point %d (%s): %s", e.Point, e.Value, e.Err)
+}
+
+func (e *FanTableError) Unwrap() error {
+	return e.Err
+}
+
+// SafetyFloor is the minimum fan percentage at or above a temperature.
+// The zero value disables the check
+type SafetyFloor struct {
+	Temperature   uint8
+	FanPercentage uint8
+}
+
+// DefaultSafetyFloor requires the fan to spin at 30% or more at 85C and above
+var DefaultSafetyFloor = SafetyFloor{
+	Temperature:   85,
+	FanPercentage: 30,
+}
+
+// ParseSafetyFloor parses a safety floor in the same format as a fan curve point, such as 85c:30%
+func ParseSafetyFloor(floor string) (SafetyFloor, error) {
+	match := pointRe.FindStringSubmatch(floor)
+	if match == nil {
+		return SafetyFloor{}, ErrMalformedPoint
+	}
+	degree, _ := strconv.Atoi(match[1])
+	fanPct, _ := strconv.Atoi(match[2])
+	if degree < minTemperature || degree > maxTemperature {
+		return SafetyFloor{}, ErrTemperatureRange
+	}
+	if fanPct > 100 {
+		return SafetyFloor{}, ErrFanPercentageRange
+	}
+	return SafetyFloor{
+		Temperature:   uint8(degree),
+		FanPercentage: uint8(fanPct),
+	}, nil
+}
+
+func (s SafetyFloor) String() string {
+	return fmt.Sprintf("%dc:%d%%", s.Temperature, s.FanPercentage)
+}
+
+// FanTable is the fan curve sent to the embedded controller:
+// 8 temperatures followed by 8 fan percentages
 type FanTable struct {
 	ByteTable []byte
+
+	// set if the table was resampled from a Curve
+	resampled bool
+	quantErr  float64
 }
 
+// NewFanTable parses the fan curve (e.g. "20c:0%,50c:0%,55c:0%,60c:0%,65c:31%,70c:49%,75c:56%,98c:56%")
+// and validates it against DefaultSafetyFloor. An empty curve returns a nil FanTable
 func NewFanTable(curve string) (*FanTable, error) {
+	return ParseFanTable(curve, DefaultSafetyFloor)
+}
+
+// ParseFanTable parses the fan curve and validates it against the safety floor. A curve with an
+// interpolation prefix (e.g. "cubic:20c:0%,60c:20%,90c:100%") may have any number of points,
+// and is resampled to 8 points (see Curve). Errors returned are *FanTableError
+func ParseFanTable(curve string, floor SafetyFloor) (*FanTable, error) {
 	if len(curve) == 0 {
 		return nil, nil
 	}
-	match := curveRe.FindAllStringSubmatch(curve, -1)
+	if isCurve(curve) {
+		c, err := ParseCurve(curve)
+		if err != nil {
+			return nil, err
+		}
+		t, quantErr, err := c.FanTable(floor)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("thermal: resampled %s to %s (quantization error %.1f%%)\n", c, t, quantErr)
+		return t, nil
+	}
+	points := strings.Split(curve, ",")
+	if len(points) != 8 {
+		return nil, &FanTableError{
+			Err: fmt.Errorf("%w, got %d", ErrPointCount, len(points)),
+		}
+	}
 	t := &FanTable{
 		ByteTable: make([]byte, 16),
 	}
-	if len(match) != 8 {
-		return t, nil
-	}
-	for i, b := range match {
-		degree, err := strconv.Atoi(b[1])
-		if err != nil {
-			return nil, errors.New("Temperature parse error")
+	for i, p := range points {
+		match := pointRe.FindStringSubmatch(p)
+		if match == nil {
+			return nil, pointError(i, points, ErrMalformedPoint)
 		}
-		if degree < 20 {
-			return nil, errors.New("Temperature must be greater than or equal to 20C")
+		// guaranteed to be digits by the regexp
+		degree, _ := strconv.Atoi(match[1])
+		fanPct, _ := strconv.Atoi(match[2])
+		if degree < minTemperature || degree > maxTemperature {
+			return nil, pointError(i, points, ErrTemperatureRange)
+		}
+		if fanPct > 100 {
+			return nil, pointError(i, points, ErrFanPercentageRange)
 		}
 		t.ByteTable[i] = byte(degree)
+		t.ByteTable[i+8] = byte(fanPct)
+	}
+	if err := t.Validate(floor); err != nil {
+		fErr := err.(*FanTableError)
+		fErr.Value = strings.TrimSpace(points[fErr.Point-1])
+		return nil, fErr
+	}
+	return t, nil
+}
 
-		fanPct, err := strconv.Atoi(b[2])
-		if err != nil {
-			return nil, errors.New("Fan percentage parse error")
+// Validate checks that temperatures and fan percentages do not decrease, and that
+// the fan percentage is at least the safety floor at or above the floor temperature.
+// Since the last point applies to all temperatures above it, it is always checked against the floor.
+// Errors returned are *FanTableError
+func (f *FanTable) Validate(floor SafetyFloor) error {
+	b := f.ByteTable
+	for i := 0; i < 8; i++ {
+		if i > 0 && b[i] < b[i-1] {
+			return f.pointError(i, ErrTemperatureDecreasing)
 		}
-		if fanPct < 0 || fanPct > 100 {
+		if i > 0 && b[i+8] < b[i+7] {
+			return f.pointError(i, ErrFanPercentageDecreasing)
+		}
+		if (b[i] >= floor.Temperature || i == 7) && b[i+8] < floor.FanPercentage {
+			return f.pointError(i, fmt.Errorf("%w (%s)", ErrBelowSafetyFloor, floor))
+		}
+	}
+	return nil
+}
+
+func (f *FanTable) pointError(i int, err error) *FanTableError {
+	return &FanTableError{
+		Point: i + 1,
+		Value: fmt.Sprintf("%dc:%d%%", f.ByteTable[i], f.ByteTable[i+8]),
+		Err:   err,
+	}
+}
+
+func pointError(i int, points []string, err error) *FanTableError {
+	return &FanTableError{
+		Point: i + 1,
+		Value: strings.TrimSpace(points[i]),
+		Err:   err,
+	}
+}
+
+// NewFanTableFromBytes returns a FanTable from its binary representation, such as the factory
+// fan curve returned by the embedded controller
+func NewFanTableFromBytes(b []byte) (*FanTable, error) {
+	if len(b) != 16 {
+		return nil, fmt.Errorf("Fan table must be 16 bytes, got %d", len(b))
+	}
+	for i := 0; i < 8; i++ {
+		if b[i+8] > 100 {
 			return nil, errors.New("Fan percentage out of range")
 		}
-		t.ByteTable[i+8] = byte(fanPct)
 	}
+	t := &FanTable{
+		ByteTable: make([]byte, 16),
+	}
+	copy(t.ByteTable, b)
 	return t, nil
 }
 
+// Resampled returns true if the table was resampled from a curve with an interpolation prefix,
+// along with the quantization error in fan percentage (see Curve.FanTable)
+func (f *FanTable) Resampled() (bool, float64) {
+	if f == nil {
+		return false, 0
+	}
+	return f.resampled, f.quantErr
+}
+
 // Bytes returns the binary representation of the table
 func (f *FanTable) Bytes() []byte {
 	if f == nil {
@@ -0,0 +1,80 @@
+package thermal
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFanTable(t *testing.T) {
+	table, err := NewFanTable("20c:0%, 50c:0%,55c:0%,60c:0%,65c:31%,70c:49%,75c:56%,98c:56%")
+	require.NoError(t, err)
+	require.Equal(t, []byte{20, 50, 55, 60, 65, 70, 75, 98, 0, 0, 0, 0, 31, 49, 56, 56}, table.Bytes())
+	require.Equal(t, "20c:0%,50c:0%,55c:0%,60c:0%,65c:31%,70c:49%,75c:56%,98c:56%", table.String())
+
+	table, err = NewFanTable("")
+	require.NoError(t, err)
+	require.Nil(t, table)
+}
+
+func TestFanTableErrors(t *testing.T) {
+	cases := []struct {
+		curve string
+		point int
+		value string
+		err   error
+	}{
+		{"20c:0%,50c:0%,55c:0%,60c:0%,65c:31%,70c:49%,75c:56%", 0, "", ErrPointCount},
+		{"20c:0%,50c:0%,55c:0%,60c:0%,65c:31%,70c:49%,75c:56%,98c:56%,", 0, "", ErrPointCount},
+		{"20c:0%,50c:0%,55c:0%,60c:0%,65c:31%,70c:49%,75c:56%,98c:56%x", 8, "98c:56%x", ErrMalformedPoint},
+		{"20c:0%,50c:0%,55c:0%,60c0%,65c:31%,70c:49%,75c:56%,98c:56%", 4, "60c0%", ErrMalformedPoint},
+		{"10c:0%,50c:0%,55c:0%,60c:0%,65c:31%,70c:49%,75c:56%,98c:56%", 1, "10c:0%", ErrTemperatureRange},
+		{"20c:0%,50c:0%,55c:0%,60c:0%,65c:31%,70c:49%,75c:56%,98c:156%", 8, "98c:156%", ErrFanPercentageRange},
+		{"20c:0%,50c:0%,55c:0%,60c:0%,58c:31%,70c:49%,75c:56%,98c:56%", 5, "58c:31%", ErrTemperatureDecreasing},
+		{"20c:0%,50c:0%,55c:0%,60c:0%,65c:31%,70c:29%,75c:56%,98c:56%", 6, "70c:29%", ErrFanPercentageDecreasing},
+		{"20c:0%,50c:0%,55c:0%,60c:0%,65c:0%,70c:0%,75c:0%,98c:0%", 8, "98c:0%", ErrBelowSafetyFloor},
+	}
+	for _, c := range cases {
+		_, err := NewFanTable(c.curve)
+		require.Error(t, err, c.curve)
+		require.True(t, errors.Is(err, c.err), err.Error())
+
+		var fErr *FanTableError
+		require.True(t, errors.As(err, &fErr))
+		require.Equal(t, c.point, fErr.Point, c.curve)
+		require.Equal(t, c.value, fErr.Value, c.curve)
+	}
+}
+
+func TestSafetyFloor(t *testing.T) {
+	curve := "20c:0%,50c:0%,55c:0%,60c:0%,65c:31%,70c:49%,75c:56%,98c:56%"
+
+	floor, err := ParseSafetyFloor("70c:50%")
+	require.NoError(t, err)
+	require.Equal(t, SafetyFloor{Temperature: 70, FanPercentage: 50}, floor)
+
+	_, err = ParseFanTable(curve, floor)
+	require.True(t, errors.Is(err, ErrBelowSafetyFloor))
+	var fErr *FanTableError
+	require.True(t, errors.As(err, &fErr))
+	require.Equal(t, 6, fErr.Point)
+
+	// zero value disables the floor
+	_, err = ParseFanTable("20c:0%,50c:0%,55c:0%,60c:0%,65c:0%,70c:0%,75c:0%,98c:0%", SafetyFloor{})
+	require.NoError(t, err)
+
+	_, err = ParseSafetyFloor("85c:30")
+	require.Error(t, err)
+	_, err = ParseSafetyFloor("150c:30%")
+	require.Error(t, err)
+
+	// all default profiles must satisfy the default floor
+	for _, p := range GetDefaultThermalProfiles() {
+		for _, table := range []*FanTable{p.CPUFanCurve, p.GPUFanCurve} {
+			if table != nil {
+				require.NoError(t, table.Validate(DefaultSafetyFloor), p.Name)
+			}
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package thermal
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/zllovesuki/G14Manager/system/plugin"
+)
+
+// hookQueueSize is the number of profile switches whose hooks can be pending until the loop
+// forwards them to the controller
+const hookQueueSize = 8
+
+// ValidateHooks checks every hook of the profile
+func ValidateHooks(p Profile) error {
+	for _, hooks := range [][]plugin.Hook{p.OnEnter, p.OnExit} {
+		for _, h := range hooks {
+			if err := h.Validate(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// StripCommandHooks returns a copy of the profiles without command hooks, and describes the removed hooks.
+// Command hooks run arbitrary command lines, so profiles from elsewhere (e.g. an imported file) must not
+// install them unless the user allows it
+func StripCommandHooks(profiles []Profile) ([]Profile, []string) {
+	stripped := make([]Profile, 0, len(profiles))
+	removed := make([]string, 0)
+	for _, p := range profiles {
+		strip := func(phase plugin.HookPhase, hooks []plugin.Hook) []plugin.Hook {
+			kept := make([]plugin.Hook, 0, len(hooks))
+			for _, h := range hooks {
+				if h.Action == plugin.HookCommand {
+					removed = append(removed, fmt.Sprintf("Profile %s: removed %s hook %s", p.Name, phase, h))
+					continue
+				}
+				kept = append(kept, h)
+			}
+			if len(kept) == 0 {
+				return nil
+			}
+			return kept
+		}
+		p.OnEnter = strip(plugin.HookEnter, p.OnEnter)
+		p.OnExit = strip(plugin.HookExit, p.OnExit)
+		stripped = append(stripped, p)
+	}
+	return stripped, removed
+}
+
+// ValidateCommandHooks checks that the profiles do not add command hooks to the existing profiles
+// (matched by ID), so unchanged command hooks can be sent back as is
+func ValidateCommandHooks(profiles []Profile, existing []Profile) error {
+	for _, p := range profiles {
+		var allowed []plugin.Hook
+		for _, e := range existing {
+			if p.ID != "" && e.ID == p.ID {
+				allowed = append(append(allowed, e.OnEnter...), e.OnExit...)
+				break
+			}
+		}
+	next:
+		for _, h := range append(append([]plugin.Hook{}, p.OnEnter...), p.OnExit...) {
+			if h.Action != plugin.HookCommand {
+				continue
+			}
+			for _, a := range allowed {
+				if a == h {
+					continue next
+				}
+			}
+			return fmt.Errorf("profile %s: command hook %s must be explicitly allowed", p.Name, h.Value)
+		}
+	}
+	return nil
+}
+
+// hookRequests returns the exit hooks of the previous profile (if any), followed by the enter hooks of the next profile
+func hookRequests(previous *Profile, next Profile) []plugin.HookRequest {
+	requests := make([]plugin.HookRequest, 0)
+	if previous != nil {
+		for _, h := range previous.OnExit {
+			requests = append(requests, plugin.HookRequest{Profile: previous.Name, Phase: plugin.HookExit, Hook: h})
+		}
+	}
+	for _, h := range next.OnEnter {
+		requests = append(requests, plugin.HookRequest{Profile: next.Name, Phase: plugin.HookEnter, Hook: h})
+	}
+	return requests
+}
+
+// queueHooks queues the hooks for the loop to send them with CbRunHooks. The profile switch is never blocked by hooks
+func (c *Control) queueHooks(previous *Profile, next Profile) {
+	requests := hookRequests(previous, next)
+	if len(requests) == 0 {
+		return
+	}
+	select {
+	case c.hookCh <- requests:
+	default:
+		log.Printf("thermal: too many pending hooks, dropping %d hook(s) of %s\n", len(requests), next.Name)
+	}
+}
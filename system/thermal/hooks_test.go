@@ -0,0 +1,93 @@
+package thermal
+
+import (
+	"testing"
+
+	"github.com/zllovesuki/G14Manager/system/atkacpi"
+	"github.com/zllovesuki/G14Manager/system/plugin"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfileHooks(t *testing.T) {
+	c, wmi := newApplyTest(t)
+	brightness := plugin.Hook{Action: plugin.HookKeyboardBrightness, Value: "off"}
+	chargeLimit := plugin.Hook{Action: plugin.HookChargeLimit, Value: "60"}
+	gpu := plugin.Hook{Action: plugin.HookGPU, Value: "on"}
+	c.Config.Profiles[0].OnEnter = []plugin.Hook{brightness, chargeLimit}
+	c.Config.Profiles[0].OnExit = []plugin.Hook{gpu}
+
+	pending := func() []plugin.HookRequest {
+		select {
+		case r := <-c.hookCh:
+			return r
+		default:
+			return nil
+		}
+	}
+
+	_, err := c.SwitchToProfile("Fanless")
+	require.NoError(t, err)
+	require.Equal(t, []plugin.HookRequest{
+		{Profile: "Fanless", Phase: plugin.HookEnter, Hook: brightness},
+		{Profile: "Fanless", Phase: plugin.HookEnter, Hook: chargeLimit},
+	}, pending())
+
+	// reapplying the active profile does not run the hooks
+	require.NoError(t, c.Apply())
+	require.Nil(t, pending())
+
+	// nor does a failed switch
+	wmi.dev, wmi.failures = atkacpi.DevsThrottleCtrl, 1
+	_, err = c.SwitchToProfile("Turbo")
+	require.Error(t, err)
+	require.Nil(t, pending())
+
+	_, err = c.SwitchToProfile("Turbo")
+	require.NoError(t, err)
+	require.Equal(t, []plugin.HookRequest{
+		{Profile: "Fanless", Phase: plugin.HookExit, Hook: gpu},
+	}, pending())
+
+	// profiles without hooks
+	_, err = c.SwitchToProfile("Balanced")
+	require.NoError(t, err)
+	require.Nil(t, pending())
+}
+
+func TestValidateHooks(t *testing.T) {
+	p := GetDefaultThermalProfiles()[0]
+	require.NoError(t, ValidateHooks(p))
+	p.OnExit = []plugin.Hook{{Action: plugin.HookChargeLimit, Value: "101"}}
+	require.Error(t, ValidateHooks(p))
+
+	spec := NewProfileSpec(p)
+	_, err := spec.Profile(DefaultSafetyFloor)
+	require.Error(t, err)
+}
+
+func TestCommandHooks(t *testing.T) {
+	command := plugin.Hook{Action: plugin.HookCommand, Value: "calc.exe"}
+	brightness := plugin.Hook{Action: plugin.HookKeyboardBrightness, Value: "low"}
+	profiles := []Profile{
+		{ID: "quiet", Name: "Quiet", OnEnter: []plugin.Hook{command, brightness}},
+		{ID: "turbo", Name: "Turbo", OnExit: []plugin.Hook{command}},
+	}
+
+	stripped, removed := StripCommandHooks(profiles)
+	require.Equal(t, []plugin.Hook{brightness}, stripped[0].OnEnter)
+	require.Nil(t, stripped[1].OnExit)
+	require.Equal(t, []string{
+		"Profile Quiet: removed enter hook command=calc.exe",
+		"Profile Turbo: removed exit hook command=calc.exe",
+	}, removed)
+	// the original profiles are not modified
+	require.Len(t, profiles[0].OnEnter, 2)
+
+	// unchanged command hooks are allowed, but new ones are not
+	require.NoError(t, ValidateCommandHooks(profiles, profiles))
+	require.NoError(t, ValidateCommandHooks(stripped, profiles))
+	require.Error(t, ValidateCommandHooks(profiles, stripped))
+	renamed := []Profile{{ID: "other", Name: "Quiet", OnEnter: []plugin.Hook{command}}}
+	require.Error(t, ValidateCommandHooks(renamed, profiles))
+}
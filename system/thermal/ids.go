@@ -0,0 +1,204 @@
+package thermal
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/zllovesuki/G14Manager/system/shared"
+)
+
+// ProfileID returns the ID derived from the name (e.g. "Quiet Night" is "quiet-night"), which is
+// the ID of profiles created without one
+func ProfileID(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteRune('-')
+			dash = true
+		}
+	}
+	id := strings.TrimSuffix(b.String(), "-")
+	if id == "" {
+		return "profile"
+	}
+	return id
+}
+
+// AssignIDs returns a copy of the profiles, where profiles without an ID are given one: profiles with
+// the same name as one of the existing profiles keep its ID, and the others are derived from the name
+// (with a numeric suffix if taken). The ID of a profile does not change when it is renamed
+func AssignIDs(profiles []Profile, existing []Profile) []Profile {
+	assigned := make([]Profile, len(profiles))
+	copy(assigned, profiles)
+
+	taken := make(map[string]bool, len(assigned))
+	for _, p := range assigned {
+		if p.ID != "" {
+			taken[p.ID] = true
+		}
+	}
+next:
+	for i := range assigned {
+		if assigned[i].ID != "" {
+			continue
+		}
+		for _, e := range existing {
+			if e.ID != "" && e.Name == assigned[i].Name && !taken[e.ID] {
+				assigned[i].ID = e.ID
+				taken[e.ID] = true
+				continue next
+			}
+		}
+		id := ProfileID(assigned[i].Name)
+		for n := 2; taken[id]; n++ {
+			id = fmt.Sprintf("%s-%d", ProfileID(assigned[i].Name), n)
+		}
+		assigned[i].ID = id
+		taken[id] = true
+	}
+	return assigned
+}
+
+// ValidateProfiles checks that every profile has a unique ID and name
+func ValidateProfiles(profiles []Profile) error {
+	ids := make(map[string]bool, len(profiles))
+	names := make(map[string]bool, len(profiles))
+	for _, p := range profiles {
+		if p.ID == "" {
+			return fmt.Errorf("profile %s has no ID", p.Name)
+		}
+		if ids[p.ID] {
+			return fmt.Errorf("duplicated profile ID %s", p.ID)
+		}
+		if names[p.Name] {
+			return fmt.Errorf("duplicated profile name %s", p.Name)
+		}
+		ids[p.ID] = true
+		names[p.Name] = true
+	}
+	return nil
+}
+
+// FindProfile returns the index of the profile with the ID, or -1 if there is none
+func FindProfile(profiles []Profile, id string) int {
+	if id == "" {
+		return -1
+	}
+	for i, p := range profiles {
+		if p.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// FindProfileByName returns the index of the profile with the name, or -1 if there is none
+func FindProfileByName(profiles []Profile, name string) int {
+	if name == "" {
+		return -1
+	}
+	for i, p := range profiles {
+		if p.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// ResolveProfile returns the index of the profile referred to by ref, or -1 if there is none. References
+// are profile IDs, and names are resolved as well for names from the user and references saved before profiles had IDs.
+// Use FindProfile when ref is known to be an ID
+func ResolveProfile(profiles []Profile, ref string) int {
+	if i := FindProfile(profiles, ref); i >= 0 {
+		return i
+	}
+	return FindProfileByName(profiles, ref)
+}
+
+// ResolveFeatures returns a copy of the features with every reference to a profile replaced by the ID of the profile.
+// References that cannot be resolved are kept as is, and reported in the error
+func ResolveFeatures(feats shared.Features, profiles []Profile) (shared.Features, error) {
+	var unresolved []string
+	resolve := func(what string, ref *string) {
+		if *ref == "" {
+			return
+		}
+		i := ResolveProfile(profiles, *ref)
+		if i < 0 {
+			unresolved = append(unresolved, fmt.Sprintf("%s refers to unknown profile %s", what, *ref))
+			return
+		}
+		*ref = profiles[i].ID
+	}
+
+	resolve("AutoThermal (plugged in)", &feats.AutoThermal.PluggedIn)
+	resolve("AutoThermal (unplugged)", &feats.AutoThermal.Unplugged)
+	resolve("AutoThermal (barrel)", &feats.AutoThermal.Barrel)
+	resolve("AutoThermal (USB-C PD)", &feats.AutoThermal.USBCPD)
+	resolve("boost", &feats.Boost.Profile)
+
+	// copy on write, as the slices are shared with the caller
+	rules := append([]shared.BatteryRule(nil), feats.AutoThermal.BatteryRules...)
+	for i := range rules {
+		resolve(fmt.Sprintf("battery rule below %d%%", rules[i].Below), &rules[i].Profile)
+	}
+	feats.AutoThermal.BatteryRules = rules
+
+	schedules := append([]shared.Schedule(nil), feats.Schedules...)
+	for i := range schedules {
+		resolve(fmt.Sprintf("schedule %s-%s", FormatTimeOfDay(schedules[i].Start), FormatTimeOfDay(schedules[i].End)), &schedules[i].Profile)
+	}
+	feats.Schedules = schedules
+
+	processRules := append([]shared.ProcessRule(nil), feats.ProcessRules...)
+	for i := range processRules {
+		resolve(fmt.Sprintf("process rule for %s", processRules[i].Executable), &processRules[i].Profile)
+	}
+	feats.ProcessRules = processRules
+
+	cycle := append([]string(nil), feats.CycleProfiles...)
+	for i := range cycle {
+		resolve("cycle list", &cycle[i])
+	}
+	feats.CycleProfiles = cycle
+
+	if len(unresolved) > 0 {
+		return feats, fmt.Errorf("unresolved references: %s", strings.Join(unresolved, "; "))
+	}
+	return feats, nil
+}
+
+// resolveReferences replaces every reference to a profile in the config by the ID of the profile
+func (conf *Config) resolveReferences() error {
+	feats, err := ResolveFeatures(shared.Features{
+		AutoThermal: shared.AutoThermal{
+			PluggedIn:    conf.AutoThermalConfig.PluggedIn,
+			Unplugged:    conf.AutoThermalConfig.Unplugged,
+			Barrel:       conf.AutoThermalConfig.Barrel,
+			USBCPD:       conf.AutoThermalConfig.USBCPD,
+			BatteryRules: conf.AutoThermalConfig.BatteryRules,
+		},
+		Schedules:     conf.Schedules,
+		ProcessRules:  conf.ProcessRules,
+		CycleProfiles: conf.CycleProfiles,
+		Boost:         conf.Boost,
+	}, conf.Profiles)
+	if err != nil {
+		return err
+	}
+	conf.AutoThermalConfig.PluggedIn = feats.AutoThermal.PluggedIn
+	conf.AutoThermalConfig.Unplugged = feats.AutoThermal.Unplugged
+	conf.AutoThermalConfig.Barrel = feats.AutoThermal.Barrel
+	conf.AutoThermalConfig.USBCPD = feats.AutoThermal.USBCPD
+	conf.AutoThermalConfig.BatteryRules = feats.AutoThermal.BatteryRules
+	conf.Schedules = feats.Schedules
+	conf.ProcessRules = feats.ProcessRules
+	conf.CycleProfiles = feats.CycleProfiles
+	conf.Boost = feats.Boost
+	return nil
+}
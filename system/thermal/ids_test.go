@@ -0,0 +1,246 @@
+package thermal
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+	"time"
+
+	"github.com/zllovesuki/G14Manager/rpc/announcement"
+	"github.com/zllovesuki/G14Manager/system/atkacpi"
+	"github.com/zllovesuki/G14Manager/system/power"
+	"github.com/zllovesuki/G14Manager/system/process"
+	"github.com/zllovesuki/G14Manager/system/shared"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfileID(t *testing.T) {
+	require.Equal(t, "quiet", ProfileID("Quiet"))
+	require.Equal(t, "quiet-night", ProfileID(" Quiet  Night! "))
+	require.Equal(t, "profile", ProfileID("***"))
+}
+
+func TestAssignIDs(t *testing.T) {
+	existing := GetDefaultThermalProfiles()
+
+	profiles := []Profile{
+		{Name: "Quiet"},                    // keeps the existing ID
+		{ID: "turbo", Name: "Turbo Boost"}, // renamed
+		{Name: "Turbo"},                    // new, and the ID derived from the name is taken
+	}
+	assigned := AssignIDs(profiles, existing)
+	require.Equal(t, "quiet", assigned[0].ID)
+	require.Equal(t, "turbo", assigned[1].ID)
+	require.Equal(t, "turbo-2", assigned[2].ID)
+	require.NoError(t, ValidateProfiles(assigned))
+
+	// the input is not modified
+	require.Empty(t, profiles[0].ID)
+
+	require.Error(t, ValidateProfiles([]Profile{{Name: "Quiet"}}))
+	require.Error(t, ValidateProfiles([]Profile{{ID: "a", Name: "Quiet"}, {ID: "a", Name: "Turbo"}}))
+	require.Error(t, ValidateProfiles([]Profile{{ID: "a", Name: "Quiet"}, {ID: "b", Name: "Quiet"}}))
+}
+
+func TestFindProfile(t *testing.T) {
+	profiles := []Profile{
+		{ID: "quiet", Name: "turbo"},
+		{ID: "turbo", Name: "Turbo"},
+	}
+	// IDs are resolved by ID only
+	require.Equal(t, 1, FindProfile(profiles, "turbo"))
+	require.Equal(t, -1, FindProfile(profiles, "Turbo"))
+	require.Equal(t, 1, FindProfileByName(profiles, "Turbo"))
+	require.Equal(t, -1, FindProfile(profiles, ""))
+	require.Equal(t, -1, FindProfileByName(profiles, ""))
+
+	// IDs take precedence over names
+	require.Equal(t, 1, ResolveProfile(profiles, "turbo"))
+	require.Equal(t, 1, ResolveProfile(profiles, "Turbo"))
+	require.Equal(t, -1, ResolveProfile(profiles, "Quiet"))
+	require.Equal(t, -1, ResolveProfile(profiles, ""))
+}
+
+func TestResolveFeatures(t *testing.T) {
+	profiles := GetDefaultThermalProfiles()
+	feats := shared.Features{
+		AutoThermal: shared.AutoThermal{
+			PluggedIn:    "Performance",
+			Unplugged:    "quiet",
+			BatteryRules: []shared.BatteryRule{{Below: 15, Profile: "Fanless"}},
+		},
+		Schedules:     []shared.Schedule{{Profile: "Quiet", Start: time.Hour, End: 2 * time.Hour}},
+		ProcessRules:  []shared.ProcessRule{{Executable: "game.exe", Profile: "Turbo"}},
+		CycleProfiles: []string{"Quiet", "balanced"},
+	}
+
+	resolved, err := ResolveFeatures(feats, profiles)
+	require.NoError(t, err)
+	require.Equal(t, "performance", resolved.AutoThermal.PluggedIn)
+	require.Equal(t, "quiet", resolved.AutoThermal.Unplugged)
+	require.Empty(t, resolved.AutoThermal.Barrel)
+	require.Equal(t, "fanless", resolved.AutoThermal.BatteryRules[0].Profile)
+	require.Equal(t, "quiet", resolved.Schedules[0].Profile)
+	require.Equal(t, "turbo", resolved.ProcessRules[0].Profile)
+	require.Equal(t, []string{"quiet", "balanced"}, resolved.CycleProfiles)
+
+	// the input is not modified
+	require.Equal(t, "Quiet", feats.Schedules[0].Profile)
+
+	feats.ProcessRules[0].Profile = "Nonexistent"
+	resolved, err = ResolveFeatures(feats, profiles)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "game.exe")
+	require.Equal(t, "Nonexistent", resolved.ProcessRules[0].Profile)
+}
+
+func TestThermalPersistLegacy(t *testing.T) {
+	c, _ := newScheduleTest(t)
+
+	// values saved before profiles had IDs are the name of the profile
+	var buf bytes.Buffer
+	require.NoError(t, gob.NewEncoder(&buf).Encode("Balanced"))
+	require.NoError(t, c.Load(buf.Bytes()))
+	require.Equal(t, "Balanced", c.CurrentProfile().Name)
+
+	// and the ID is saved from now on
+	var saved persistedProfile
+	require.NoError(t, gob.NewDecoder(bytes.NewBuffer(c.Value())).Decode(&saved))
+	require.Equal(t, persistedProfile{ID: "balanced", Name: "Balanced"}, saved)
+}
+
+func TestThermalRename(t *testing.T) {
+	c, clock := newScheduleTest(t)
+	c.AutoThermal = true
+	c.AutoThermalConfig.PluggedIn = "performance"
+	c.AutoThermalConfig.Unplugged = "quiet"
+	c.charger = chargerUnplugged
+
+	_, err := c.SwitchToProfile("turbo")
+	require.NoError(t, err)
+	saved := c.Value()
+
+	renamed := make([]Profile, len(c.Config.Profiles))
+	copy(renamed, c.Config.Profiles)
+	renamed[1].Name = "Silent"
+	renamed[4].Name = "Turbo Boost"
+	// move Turbo Boost first
+	renamed[0], renamed[4] = renamed[4], renamed[0]
+	c.ConfigUpdate(announcement.Update{Type: announcement.ProfilesUpdate, Config: renamed})
+
+	// the current profile and AutoThermal follow the IDs
+	require.Equal(t, "Turbo Boost", c.CurrentProfile().Name)
+	id, _, ok := c.desiredProfile(clock.now)
+	require.True(t, ok)
+	require.Equal(t, "quiet", id)
+	require.Equal(t, "Silent", c.profileName(id))
+
+	// the saved profile is resolved by ID after renaming
+	loaded, _ := newScheduleTest(t)
+	loaded.Config.Profiles = renamed
+	require.NoError(t, loaded.Load(saved))
+	require.Equal(t, "Turbo Boost", loaded.CurrentProfile().Name)
+
+	// the saved profile is reported if it does not exist, and resolved once the profiles are updated
+	loaded, _ = newScheduleTest(t)
+	loaded.Config.Profiles = renamed[1:]
+	require.Error(t, loaded.Load(saved))
+	loaded.ConfigUpdate(announcement.Update{Type: announcement.ProfilesUpdate, Config: renamed})
+	require.Equal(t, "Turbo Boost", loaded.CurrentProfile().Name)
+	require.Len(t, loaded.noticeCh, 0)
+}
+
+func TestThermalRemoveCurrent(t *testing.T) {
+	c, _ := newScheduleTest(t)
+	_, err := c.SwitchToProfile("turbo")
+	require.NoError(t, err)
+
+	// a profile named after the ID of the removed profile is not the current profile
+	remaining := make([]Profile, 0, len(c.Config.Profiles))
+	for _, p := range c.Config.Profiles {
+		if p.ID != "turbo" {
+			remaining = append(remaining, p)
+		}
+	}
+	remaining[1].Name = "turbo"
+	c.ConfigUpdate(announcement.Update{Type: announcement.ProfilesUpdate, Config: remaining})
+
+	require.Equal(t, remaining[0].ID, c.CurrentProfile().ID)
+	require.Equal(t, remaining[0].ID, c.applied.ID)
+	require.Equal(t, "Profile Turbo is not found, thermal plan changed to "+remaining[0].Name, (<-c.noticeCh).Message)
+}
+
+func TestThermalConcurrentProfilesUpdate(t *testing.T) {
+	c, _ := newScheduleTest(t)
+	_, err := c.SwitchToProfile("turbo")
+	require.NoError(t, err)
+
+	// reordering the profiles moves the current profile, which readers must never observe halfway
+	profiles := c.Profiles()
+	reversed := make([]Profile, len(profiles))
+	for i, p := range profiles {
+		reversed[len(profiles)-1-i] = p
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			next := profiles
+			if i%2 == 0 {
+				next = reversed
+			}
+			c.ConfigUpdate(announcement.Update{Type: announcement.ProfilesUpdate, Config: next})
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			require.Equal(t, "turbo", c.CurrentProfile().ID)
+			return
+		default:
+		}
+		require.Equal(t, "turbo", c.CurrentProfile().ID)
+		require.Len(t, c.Profiles(), len(profiles))
+	}
+}
+
+func TestThermalNameCollidesWithID(t *testing.T) {
+	// the name of the first profile is the ID of the second
+	profiles := []Profile{
+		{ID: "quiet", Name: "turbo", ThrottlePlan: ThrottlePlanSilent},
+		{ID: "turbo", Name: "Turbo", ThrottlePlan: ThrottlePlanTurbo},
+	}
+	procs := process.NewFake()
+	c, err := NewControl(Config{
+		WMI:           atkacpi.NewSimulator(),
+		PowerCfg:      &power.Cfg{},
+		Profiles:      profiles,
+		ProcessRules:  []shared.ProcessRule{{Executable: "game.exe", Profile: "quiet"}},
+		CycleProfiles: []string{"quiet", "turbo"},
+		Processes:     procs,
+	})
+	require.NoError(t, err)
+	_, err = c.SwitchToProfile("Turbo")
+	require.NoError(t, err)
+
+	// the rule switches to the profile with the ID, not to the profile with the ID that is its name
+	procs.Start("game.exe")
+	next, _, err := c.checkRules()
+	require.NoError(t, err)
+	require.Equal(t, "turbo", next)
+	require.Equal(t, "quiet", c.CurrentProfile().ID)
+
+	// and so does cycling
+	id, name := c.cycleTarget(1)
+	require.Equal(t, "turbo", id)
+	require.Equal(t, "Turbo", name)
+	_, err = c.NextProfile(1)
+	require.NoError(t, err)
+	require.Equal(t, "turbo", c.CurrentProfile().ID)
+	_, err = c.NextProfile(1)
+	require.NoError(t, err)
+	require.Equal(t, "quiet", c.CurrentProfile().ID)
+}
@@ -0,0 +1,299 @@
+package thermal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/zllovesuki/G14Manager/system/plugin"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Format is the file format of exported profiles
+type Format int
+
+// Defines the supported formats. FormatAtrofac can only be imported
+const (
+	// FormatAuto detects the format when importing
+	FormatAuto Format = iota
+	FormatJSON
+	FormatYAML
+	// FormatAtrofac is the config.yaml of atrofac (https://github.com/cronosun/atrofac)
+	FormatAtrofac
+)
+
+func (f Format) String() string {
+	return [...]string{
+		"Auto",
+		"JSON",
+		"YAML",
+		"atrofac",
+	}[f]
+}
+
+// ProfileSpec is the representation of a Profile in files. ThrottlePlan is one of Performance, Turbo, or Silent,
+// and fan curves are in the format accepted by NewFanTable. ID is optional, and profiles without one are given
+// one by AssignIDs
+type ProfileSpec struct {
+	ID               string        `yaml:"id,omitempty" json:",omitempty"`
+	Name             string        `yaml:"name"`
+	WindowsPowerPlan string        `yaml:"windows_power_plan"`
+	ThrottlePlan     string        `yaml:"throttle_plan"`
+	CPUFanCurve      string        `yaml:"cpu_fan_curve,omitempty" json:",omitempty"`
+	GPUFanCurve      string        `yaml:"gpu_fan_curve,omitempty" json:",omitempty"`
+	OnEnter          []plugin.Hook `yaml:"on_enter,omitempty" json:",omitempty"`
+	OnExit           []plugin.Hook `yaml:"on_exit,omitempty" json:",omitempty"`
+}
+
+type profileFile struct {
+	Profiles []ProfileSpec `yaml:"profiles"`
+}
+
+type atrofacFile struct {
+	ActivePlan string                 `yaml:"active_plan"`
+	Plans      map[string]atrofacPlan `yaml:"plans"`
+}
+
+type atrofacPlan struct {
+	Plan     string `yaml:"plan"`
+	CPUCurve string `yaml:"cpu_curve"`
+	GPUCurve string `yaml:"gpu_curve"`
+}
+
+// ThrottlePlanName returns the name of the throttle plan (e.g. Performance)
+func ThrottlePlanName(plan uint32) string {
+	switch plan {
+	case ThrottlePlanPerformance:
+		return "Performance"
+	case ThrottlePlanTurbo:
+		return "Turbo"
+	case ThrottlePlanSilent:
+		return "Silent"
+	default:
+		return fmt.Sprintf("Unknown (0x%x)", plan)
+	}
+}
+
+// ParseThrottlePlan returns the throttle plan by its name. The name is case insensitive
+func ParseThrottlePlan(name string) (uint32, error) {
+	switch strings.ToLower(name) {
+	case "performance":
+		return ThrottlePlanPerformance, nil
+	case "turbo":
+		return ThrottlePlanTurbo, nil
+	case "silent":
+		return ThrottlePlanSilent, nil
+	default:
+		return 0, fmt.Errorf("unrecognized throttle plan %s", name)
+	}
+}
+
+// NewProfileSpec returns the representation of the profile in files
+func NewProfileSpec(p Profile) ProfileSpec {
+	return ProfileSpec{
+		ID:               p.ID,
+		Name:             p.Name,
+		WindowsPowerPlan: p.WindowsPowerPlan,
+		ThrottlePlan:     ThrottlePlanName(p.ThrottlePlan),
+		CPUFanCurve:      p.CPUFanCurve.String(),
+		GPUFanCurve:      p.GPUFanCurve.String(),
+		OnEnter:          p.OnEnter,
+		OnExit:           p.OnExit,
+	}
+}
+
+// Profile parses the spec, validating fan curves against the safety floor
+func (s ProfileSpec) Profile(floor SafetyFloor) (Profile, error) {
+	if s.Name == "" {
+		return Profile{}, errors.New("profile name must not be empty")
+	}
+	plan, err := ParseThrottlePlan(s.ThrottlePlan)
+	if err != nil {
+		return Profile{}, fmt.Errorf("profile %s: %w", s.Name, err)
+	}
+	profile := Profile{
+		ID:               s.ID,
+		Name:             s.Name,
+		WindowsPowerPlan: s.WindowsPowerPlan,
+		ThrottlePlan:     plan,
+		OnEnter:          s.OnEnter,
+		OnExit:           s.OnExit,
+	}
+	if err := ValidateHooks(profile); err != nil {
+		return Profile{}, fmt.Errorf("profile %s: %w", s.Name, err)
+	}
+	profile.CPUFanCurve, err = ParseFanTable(s.CPUFanCurve, floor)
+	if err != nil {
+		return Profile{}, fmt.Errorf("profile %s: CPU %w", s.Name, err)
+	}
+	profile.GPUFanCurve, err = ParseFanTable(s.GPUFanCurve, floor)
+	if err != nil {
+		return Profile{}, fmt.Errorf("profile %s: GPU %w", s.Name, err)
+	}
+	return profile, nil
+}
+
+// ExportProfiles returns the profiles in JSON or YAML
+func ExportProfiles(profiles []Profile, format Format) ([]byte, error) {
+	file := profileFile{
+		Profiles: make([]ProfileSpec, 0, len(profiles)),
+	}
+	for _, p := range profiles {
+		file.Profiles = append(file.Profiles, NewProfileSpec(p))
+	}
+	switch format {
+	case FormatJSON:
+		return json.MarshalIndent(file, "", "  ")
+	case FormatYAML:
+		return yaml.Marshal(file)
+	default:
+		return nil, fmt.Errorf("cannot export profiles as %s", format)
+	}
+}
+
+// ImportProfiles parses the profiles in the format, validating fan curves against the safety floor.
+// Profiles imported from atrofac are named after the plans, with the active plan first. Profiles without an ID
+// in the file are returned without one, so they can be matched to existing profiles by name (see AssignIDs)
+func ImportProfiles(b []byte, format Format, floor SafetyFloor) ([]Profile, error) {
+	if format == FormatAuto {
+		format = detectFormat(b)
+	}
+
+	var specs []ProfileSpec
+	switch format {
+	case FormatJSON:
+		var file profileFile
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&file); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+		specs = file.Profiles
+	case FormatYAML:
+		var file profileFile
+		if err := yaml.UnmarshalStrict(b, &file); err != nil {
+			return nil, fmt.Errorf("invalid YAML: %w", err)
+		}
+		specs = file.Profiles
+	case FormatAtrofac:
+		var err error
+		specs, err = atrofacSpecs(b)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("cannot import profiles as %s", format)
+	}
+
+	if len(specs) == 0 {
+		return nil, errors.New("no profiles to import")
+	}
+	return ParseProfiles(specs, floor)
+}
+
+// ParseProfiles parses the specs, validating fan curves against the safety floor.
+// Names and IDs must not repeat
+func ParseProfiles(specs []ProfileSpec, floor SafetyFloor) ([]Profile, error) {
+	names := make(map[string]bool, len(specs))
+	ids := make(map[string]bool, len(specs))
+	profiles := make([]Profile, 0, len(specs))
+	for _, s := range specs {
+		if names[s.Name] {
+			return nil, fmt.Errorf("duplicated profile name %s", s.Name)
+		}
+		if s.ID != "" && ids[s.ID] {
+			return nil, fmt.Errorf("duplicated profile ID %s", s.ID)
+		}
+		names[s.Name] = true
+		ids[s.ID] = true
+		p, err := s.Profile(floor)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, nil
+}
+
+// ResampleReport describes the fan curves of the profiles that were resampled from a curve with an
+// interpolation prefix, and their quantization error, so it can be shown to the user. It is empty if there is none
+func ResampleReport(profiles []Profile) string {
+	var report []string
+	for _, p := range profiles {
+		curves := []struct {
+			name  string
+			table *FanTable
+		}{
+			{"CPU", p.CPUFanCurve},
+			{"GPU", p.GPUFanCurve},
+		}
+		for _, c := range curves {
+			if resampled, quantErr := c.table.Resampled(); resampled {
+				report = append(report, fmt.Sprintf("Profile %s: %s fan curve resampled to %s (quantization error %.1f%%)",
+					p.Name, c.name, c.table, quantErr))
+			}
+		}
+	}
+	return strings.Join(report, "; ")
+}
+
+func detectFormat(b []byte) Format {
+	trimmed := bytes.TrimSpace(b)
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		return FormatJSON
+	}
+	var probe map[string]interface{}
+	if err := yaml.Unmarshal(b, &probe); err == nil {
+		if _, ok := probe["plans"]; ok {
+			return FormatAtrofac
+		}
+	}
+	return FormatYAML
+}
+
+func atrofacSpecs(b []byte) ([]ProfileSpec, error) {
+	var file atrofacFile
+	if err := yaml.Unmarshal(b, &file); err != nil {
+		return nil, fmt.Errorf("invalid atrofac config: %w", err)
+	}
+	names := make([]string, 0, len(file.Plans))
+	for name := range file.Plans {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if names[i] == file.ActivePlan || names[j] == file.ActivePlan {
+			return names[i] == file.ActivePlan
+		}
+		return names[i] < names[j]
+	})
+
+	specs := make([]ProfileSpec, 0, len(names))
+	for _, name := range names {
+		plan := file.Plans[name]
+		spec := ProfileSpec{
+			Name:        name,
+			CPUFanCurve: plan.CPUCurve,
+			GPUFanCurve: plan.GPUCurve,
+		}
+		// atrofac does not change the Windows power plan
+		switch strings.ToLower(plan.Plan) {
+		case "windows", "performance":
+			spec.ThrottlePlan = ThrottlePlanName(ThrottlePlanPerformance)
+			spec.WindowsPowerPlan = "Balanced"
+		case "turbo":
+			spec.ThrottlePlan = ThrottlePlanName(ThrottlePlanTurbo)
+			spec.WindowsPowerPlan = "High performance"
+		case "silent":
+			spec.ThrottlePlan = ThrottlePlanName(ThrottlePlanSilent)
+			spec.WindowsPowerPlan = "Balanced"
+		default:
+			return nil, fmt.Errorf("atrofac plan %s: unrecognized plan %s", name, plan.Plan)
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
@@ -0,0 +1,77 @@
+package thermal
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfileFileRoundTrip(t *testing.T) {
+	defaultProfiles := GetDefaultThermalProfiles()
+
+	for _, format := range []Format{FormatJSON, FormatYAML} {
+		b, err := ExportProfiles(defaultProfiles, format)
+		require.NoError(t, err)
+
+		profiles, err := ImportProfiles(b, format, DefaultSafetyFloor)
+		require.NoError(t, err, format.String())
+		require.Equal(t, defaultProfiles, profiles, format.String())
+
+		profiles, err = ImportProfiles(b, FormatAuto, DefaultSafetyFloor)
+		require.NoError(t, err, format.String())
+		require.Equal(t, defaultProfiles, profiles, format.String())
+	}
+
+	_, err := ExportProfiles(defaultProfiles, FormatAtrofac)
+	require.Error(t, err)
+}
+
+func TestImportAtrofac(t *testing.T) {
+	config := `
+active_plan: silent_low_fan
+plans:
+  performance:
+    plan: performance
+  silent_low_fan:
+    plan: silent
+    update_interval_sec: 120
+    cpu_curve: 30c:0%,40c:5%,50c:10%,60c:20%,70c:35%,80c:55%,90c:65%,100c:65%
+    gpu_curve: 30c:0%,40c:5%,50c:10%,60c:20%,70c:35%,80c:55%,90c:65%,100c:65%
+  a_turbo:
+    plan: turbo
+`
+	profiles, err := ImportProfiles([]byte(config), FormatAuto, DefaultSafetyFloor)
+	require.NoError(t, err)
+	require.Len(t, profiles, 3)
+
+	// active plan comes first, then sorted by name
+	require.Equal(t, "silent_low_fan", profiles[0].Name)
+	require.Equal(t, ThrottlePlanSilent, profiles[0].ThrottlePlan)
+	require.Equal(t, "30c:0%,40c:5%,50c:10%,60c:20%,70c:35%,80c:55%,90c:65%,100c:65%", profiles[0].CPUFanCurve.String())
+	require.Equal(t, "a_turbo", profiles[1].Name)
+	require.Equal(t, ThrottlePlanTurbo, profiles[1].ThrottlePlan)
+	require.Equal(t, "High performance", profiles[1].WindowsPowerPlan)
+	require.Nil(t, profiles[2].CPUFanCurve)
+
+	_, err = ImportProfiles([]byte("plans:\n  x:\n    plan: ludicrous\n"), FormatAtrofac, DefaultSafetyFloor)
+	require.Error(t, err)
+}
+
+func TestImportProfilesErrors(t *testing.T) {
+	cases := []string{
+		`{"Profiles": []}`,
+		`{"Profiles": [{"Name": "A", "ThrottlePlan": "Turbo"}, {"Name": "A", "ThrottlePlan": "Silent"}]}`,
+		`{"Profiles": [{"Name": "A", "ThrottlePlan": "Turbo", "Unknown": 1}]}`,
+		"profiles:\n  - name: A\n    throttle_plan: Ludicrous\n",
+		"profiles:\n  - name: A\n    throttle_plan: Silent\n    extra: true\n",
+	}
+	for _, c := range cases {
+		_, err := ImportProfiles([]byte(c), FormatAuto, DefaultSafetyFloor)
+		require.Error(t, err, c)
+	}
+
+	// fan curve errors are preserved
+	_, err := ImportProfiles([]byte("profiles:\n  - name: A\n    throttle_plan: Silent\n    cpu_fan_curve: 20c:0%\n"), FormatYAML, DefaultSafetyFloor)
+	require.True(t, errors.Is(err, ErrPointCount))
+}
@@ -0,0 +1,105 @@
+package thermal
+
+import (
+	"fmt"
+
+	"github.com/zllovesuki/G14Manager/system/atkacpi"
+)
+
+// ReadBackState is the result of reading a setting back from the embedded controller after writing it
+type ReadBackState int
+
+// Defines the results of reading back. Values match protocol.ReadBack
+const (
+	ReadBackNone       ReadBackState = iota // not written, or not supported by the firmware
+	ReadBackVerified                        // the firmware reports the requested value
+	ReadBackUnverified                      // reserved: never reported, kept so the values match protocol.ReadBack
+	ReadBackUnreadable                      // the firmware does not report the value
+	ReadBackMismatch                        // the firmware reports a different value
+)
+
+func (s ReadBackState) String() string {
+	return [...]string{
+		"not read",
+		"verified",
+		"unverified",
+		"unreadable",
+		"mismatch",
+	}[s]
+}
+
+// ReadBackCurve is the fan curve reported by the embedded controller after writing it. Curve is nil if unreadable,
+// which is always the case for now, as the firmware does not report custom fan curves
+type ReadBackCurve struct {
+	Curve *FanTable
+	State ReadBackState
+}
+
+// ReadBackError is reported when a setting does not read back as it was written. It is not fatal:
+// the profile stays applied, as some firmware may report the setting differently
+type ReadBackError struct {
+	Setting   string
+	Requested uint32
+	Reported  uint32
+	Err       error // the setting cannot be read back at all
+}
+
+func (e *ReadBackError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("Cannot read back %s: %s", e.Setting, e.Err)
+	}
+	return fmt.Sprintf("%s reads back as 0x%x, requested 0x%x", e.Setting, e.Reported, e.Requested)
+}
+
+func (e *ReadBackError) Unwrap() error {
+	return e.Err
+}
+
+// AppliedState is what the embedded controller reported after the last profile was applied,
+// as opposed to the profile that was requested. Err is the ReadBackError, if any
+type AppliedState struct {
+	ThrottlePlan      uint32
+	ThrottlePlanState ReadBackState
+	CPUFanCurve       ReadBackCurve
+	GPUFanCurve       ReadBackCurve
+	Err               error
+}
+
+// AppliedState returns what the embedded controller reported after the current profile was applied
+func (c *Control) AppliedState() AppliedState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.readBack
+}
+
+// readBackThrottlePlan reads the throttle plan back after writing it, and returns a ReadBackError if it is
+// unreadable or does not match. The caller decides what to do with it, as it does not fail the apply. c.mu must be held
+func (c *Control) readBackThrottlePlan(plan uint32) error {
+	c.readBack.ThrottlePlanState = ReadBackUnreadable
+
+	resp, err := atkacpi.DstsGet(atkacpi.DevsThrottleCtrl).Execute(c.wmi)
+	if err == nil {
+		c.readBack.ThrottlePlan, err = resp.ThrottlePlan()
+	}
+	if err != nil {
+		return &ReadBackError{Setting: "throttle plan", Requested: plan, Err: err}
+	}
+
+	if c.readBack.ThrottlePlan != plan {
+		c.readBack.ThrottlePlanState = ReadBackMismatch
+		return &ReadBackError{Setting: "throttle plan", Requested: plan, Reported: c.readBack.ThrottlePlan}
+	}
+	c.readBack.ThrottlePlanState = ReadBackVerified
+	return nil
+}
+
+// readBackFanCurve records that the fan curve cannot be read back: the firmware only reports the factory
+// fan curves, so they are not presented as what was written. c.mu must be held
+func (c *Control) readBackFanCurve(dev uint32) {
+	readBack := &c.readBack.CPUFanCurve
+	if dev == atkacpi.DevsGPUFanCurve {
+		readBack = &c.readBack.GPUFanCurve
+	}
+	*readBack = ReadBackCurve{State: ReadBackUnreadable}
+}
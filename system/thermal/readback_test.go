@@ -0,0 +1,118 @@
+package thermal
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/zllovesuki/G14Manager/system/atkacpi"
+	"github.com/zllovesuki/G14Manager/system/power"
+
+	"github.com/stretchr/testify/require"
+)
+
+// readBackWMI reports the custom fan curves (echo), or a different throttle plan (misreport)
+type readBackWMI struct {
+	*atkacpi.Simulator
+	echo      bool
+	misreport bool
+}
+
+func (r *readBackWMI) Evaluate(id atkacpi.Method, args []byte) ([]byte, error) {
+	if id != atkacpi.DSTS || len(args) < 4 {
+		return r.Simulator.Evaluate(id, args)
+	}
+	switch dev := binary.LittleEndian.Uint32(args); {
+	case r.misreport && dev == atkacpi.DevsThrottleCtrl:
+		out := make([]byte, 16)
+		binary.LittleEndian.PutUint32(out, uint32(atkacpi.PresenceBit)|(r.Simulator.ThrottlePlan()+1)%3)
+		return out, nil
+	case r.echo && (dev == atkacpi.DevsCPUFanCurve || dev == atkacpi.DevsGPUFanCurve):
+		return r.Simulator.FanCurve(dev), nil
+	}
+	return r.Simulator.Evaluate(id, args)
+}
+
+func newReadBackTest(t *testing.T) (*Control, *readBackWMI) {
+	wmi := &readBackWMI{Simulator: atkacpi.NewSimulator()}
+	c, err := NewControl(Config{
+		WMI:      wmi,
+		PowerCfg: &power.Cfg{},
+		Profiles: GetDefaultThermalProfiles(),
+	})
+	require.NoError(t, err)
+	return c, wmi
+}
+
+func TestReadBack(t *testing.T) {
+	c, wmi := newReadBackTest(t)
+
+	// the simulator reports the factory curves, which are not presented as the custom curves
+	_, err := c.SwitchToProfile("Fanless")
+	require.NoError(t, err)
+	state := c.AppliedState()
+	require.Equal(t, ThrottlePlanPerformance, state.ThrottlePlan)
+	require.Equal(t, ReadBackVerified, state.ThrottlePlanState)
+	require.Equal(t, ReadBackUnreadable, state.CPUFanCurve.State)
+	require.Equal(t, ReadBackUnreadable, state.GPUFanCurve.State)
+	require.Nil(t, state.CPUFanCurve.Curve)
+	require.NoError(t, state.Err)
+
+	// profiles without custom curves do not write them
+	_, err = c.SwitchToProfile("Balanced")
+	require.NoError(t, err)
+	state = c.AppliedState()
+	require.Equal(t, ThrottlePlanSilent, state.ThrottlePlan)
+	require.Equal(t, ReadBackNone, state.CPUFanCurve.State)
+
+	// fan curves are unreadable even if the firmware reports them
+	wmi.echo = true
+	_, err = c.SwitchToProfile("Quiet")
+	require.NoError(t, err)
+	state = c.AppliedState()
+	require.Equal(t, ReadBackUnreadable, state.CPUFanCurve.State)
+	require.Equal(t, ReadBackUnreadable, state.GPUFanCurve.State)
+}
+
+func TestReadBackMismatch(t *testing.T) {
+	c, wmi := newReadBackTest(t)
+
+	_, err := c.SwitchToProfile("Quiet")
+	require.NoError(t, err)
+
+	// a mismatch is flagged, and does not fail the switch
+	wmi.misreport = true
+	_, err = c.SwitchToProfile("Turbo")
+	require.NoError(t, err)
+	require.Equal(t, "Turbo", c.CurrentProfile().Name)
+	state := c.AppliedState()
+	require.Equal(t, ReadBackMismatch, state.ThrottlePlanState)
+	require.NotEqual(t, ThrottlePlanTurbo, state.ThrottlePlan)
+
+	// the mismatch is kept in the applied state for the clients
+	var readBackErr *ReadBackError
+	require.True(t, errors.As(state.Err, &readBackErr))
+	require.Equal(t, ThrottlePlanTurbo, readBackErr.Requested)
+	require.Equal(t, state.ThrottlePlan, readBackErr.Reported)
+
+	// and is not reported as drift
+	drifts, err := c.CheckDrift()
+	require.NoError(t, err)
+	require.Len(t, drifts, 0)
+}
+
+func TestReadBackCleared(t *testing.T) {
+	c, wmi := newReadBackTest(t)
+
+	wmi.misreport = true
+	_, err := c.SwitchToProfile("Turbo")
+	require.NoError(t, err)
+	require.Error(t, c.AppliedState().Err)
+
+	// the next apply starts over
+	wmi.misreport = false
+	_, err = c.SwitchToProfile("Quiet")
+	require.NoError(t, err)
+	require.NoError(t, c.AppliedState().Err)
+	require.Equal(t, ReadBackVerified, c.AppliedState().ThrottlePlanState)
+}
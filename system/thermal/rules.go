@@ -0,0 +1,208 @@
+package thermal
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/zllovesuki/G14Manager/system/process"
+	"github.com/zllovesuki/G14Manager/system/shared"
+)
+
+// processCheckInterval is how often running processes are listed for process rules
+const processCheckInterval = time.Second * 5
+
+const autoThermalReason = "AutoThermal"
+
+type chargerState int
+
+const (
+	chargerUnknown chargerState = iota
+	chargerPluggedIn
+	chargerUnplugged
+)
+
+// setPowerSourceLocked records the power source for AutoThermal and battery rules
+func (c *Control) setPowerSourceLocked(source shared.PowerSource) {
+	if source == shared.PowerSourceBattery {
+		c.charger = chargerUnplugged
+		return
+	}
+	c.charger = chargerPluggedIn
+	c.source = source
+}
+
+// ValidateProcessRule checks that the rule refers to one of the profiles and has an executable
+func ValidateProcessRule(r shared.ProcessRule, profiles []Profile) error {
+	if process.Normalize(r.Executable) == "" || process.Normalize(r.Executable) == "." {
+		return fmt.Errorf("process rule for profile %s must specify an executable", r.Profile)
+	}
+	if ResolveProfile(profiles, r.Profile) >= 0 {
+		return nil
+	}
+	return fmt.Errorf("process rule for %s refers to unknown profile %s", r.Executable, r.Profile)
+}
+
+// ValidateBatteryRule checks that the rule refers to one of the profiles and has a threshold between 1 and 100
+func ValidateBatteryRule(r shared.BatteryRule, profiles []Profile) error {
+	if r.Below == 0 || r.Below > 100 {
+		return fmt.Errorf("battery rule for %s must have a threshold between 1 and 100", r.Profile)
+	}
+	if ResolveProfile(profiles, r.Profile) >= 0 {
+		return nil
+	}
+	return fmt.Errorf("battery rule below %d%% refers to unknown profile %s", r.Below, r.Profile)
+}
+
+// matchedProcessRule returns the index of the first rule with a running executable, or -1
+func matchedProcessRule(rules []shared.ProcessRule, running map[string]bool) int {
+	for i, r := range rules {
+		if running[process.Normalize(r.Executable)] {
+			return i
+		}
+	}
+	return -1
+}
+
+// desiredProfile returns the ID of the profile required by process rules, schedules, and AutoThermal at the time,
+// and the reason. The precedence is (highest first):
+//  1. the first process rule with a running executable
+//  2. schedules with priority above AutoThermal
+//  3. AutoThermal, once the charger state is known. On battery, battery rules take precedence over Unplugged
+//  4. the remaining schedules
+//
+// Manual changes (Fn+F5) are not considered here, as they are kept until the next boundary (see checkRules).
+// ok is false if none applies
+func (c *Control) desiredProfile(now time.Time) (id string, reason string, ok bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if i := matchedProcessRule(c.ProcessRules, c.running); i >= 0 {
+		r := c.ProcessRules[i]
+		return r.Profile, fmt.Sprintf("process %s", process.Normalize(r.Executable)), true
+	}
+
+	best := -1
+	for _, i := range activeSchedules(c.Schedules, now) {
+		if best < 0 || c.Schedules[i].Priority > c.Schedules[best].Priority {
+			best = i
+		}
+	}
+
+	if c.AutoThermal && c.charger != chargerUnknown && (best < 0 || c.Schedules[best].Priority <= shared.AutoThermalPriority) {
+		if r, ok := c.batteryRule(); ok {
+			return r.Profile, autoThermalReason, true
+		}
+		source := shared.PowerSourceBattery
+		if c.charger == chargerPluggedIn {
+			source = c.source
+		}
+		return c.autoThermal().Profile(source), autoThermalReason, true
+	}
+	if best >= 0 {
+		s := c.Schedules[best]
+		return s.Profile, fmt.Sprintf("schedule %s-%s", FormatTimeOfDay(s.Start), FormatTimeOfDay(s.End)), true
+	}
+	return "", "", false
+}
+
+// profileName returns the name of the profile with the ID, or the ID itself if there is none. c.mu must be held
+func (c *Control) profileName(id string) string {
+	if i := FindProfile(c.Config.Profiles, id); i >= 0 {
+		return c.Config.Profiles[i].Name
+	}
+	return id
+}
+
+func (c *Control) autoThermal() shared.AutoThermal {
+	return shared.AutoThermal{
+		Enabled:      c.AutoThermal,
+		PluggedIn:    c.AutoThermalConfig.PluggedIn,
+		Unplugged:    c.AutoThermalConfig.Unplugged,
+		Barrel:       c.AutoThermalConfig.Barrel,
+		USBCPD:       c.AutoThermalConfig.USBCPD,
+		BatteryRules: c.AutoThermalConfig.BatteryRules,
+	}
+}
+
+// batteryRule returns the battery rule matching the last battery status. Battery rules only
+// apply when the charger is unplugged. c.mu must be held
+func (c *Control) batteryRule() (shared.BatteryRule, bool) {
+	if c.charger != chargerUnplugged || !c.batteryKnown {
+		return shared.BatteryRule{}, false
+	}
+	return c.autoThermal().BatteryProfile(c.battery.Percentage)
+}
+
+// refreshProcesses lists the running processes if there are process rules. On error,
+// the previously listed processes are kept
+func (c *Control) refreshProcesses() error {
+	c.mu.RLock()
+	watch := c.Processes != nil && len(c.ProcessRules) > 0
+	c.mu.RUnlock()
+	if !watch {
+		return nil
+	}
+
+	running, err := c.Processes.Running()
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.running = running
+	c.mu.Unlock()
+	return nil
+}
+
+// checkRules switches the profile when a process rule starts or stops matching, or when schedules start or end
+// (a boundary). Manual changes (e.g. Fn+F5) in between are kept until the next boundary, and rules are not
+// checked while boosting. When no rule
+// applies anymore and AutoThermal does not apply, the profile before the rules applied is restored.
+// It returns the new profile and the reason, or empty strings if the profile was not changed
+func (c *Control) checkRules() (string, string, error) {
+	if c.boosting() {
+		// boundaries during the boost apply when the boost ends
+		return "", "", nil
+	}
+	if err := c.refreshProcesses(); err != nil {
+		log.Printf("thermal: cannot list processes: %s\n", err)
+	}
+
+	now := c.Clock.Now()
+
+	c.mu.Lock()
+	key := fmt.Sprint(matchedProcessRule(c.ProcessRules, c.running), activeSchedules(c.Schedules, now))
+	boundary := !c.rulesChecked || key != c.rulesKey
+	c.rulesChecked = true
+	c.rulesKey = key
+	c.mu.Unlock()
+
+	if !boundary {
+		return "", "", nil
+	}
+
+	id, reason, ok := c.desiredProfile(now)
+	current := c.CurrentProfile()
+
+	c.mu.Lock()
+	if !ok {
+		if c.beforeRules != "" {
+			id, reason = c.beforeRules, "rules ended"
+		}
+		c.beforeRules = ""
+	} else if reason != autoThermalReason && c.beforeRules == "" {
+		c.beforeRules = current.ID
+	}
+	c.mu.Unlock()
+
+	if id == "" || id == current.ID {
+		return "", "", nil
+	}
+	log.Printf("thermal: switching to %s because of %s\n", id, reason)
+	next, err := c.setProfileByID(id)
+	if err != nil {
+		return "", "", err
+	}
+	return next, reason, nil
+}
@@ -0,0 +1,191 @@
+package thermal
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/zllovesuki/G14Manager/system/battery"
+	"github.com/zllovesuki/G14Manager/system/plugin"
+	"github.com/zllovesuki/G14Manager/system/process"
+	"github.com/zllovesuki/G14Manager/system/shared"
+	"github.com/zllovesuki/G14Manager/util"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessRules(t *testing.T) {
+	c, clock := newScheduleTest(t, quietWeeknights)
+	procs := process.NewFake()
+	c.Processes = procs
+	// references in the config are IDs
+	c.ProcessRules = []shared.ProcessRule{
+		{Executable: "Game.exe", Profile: "turbo"},
+		{Executable: "blender.exe", Profile: "performance"},
+	}
+	c.AutoThermal = true
+	c.AutoThermalConfig.PluggedIn = "balanced"
+	c.AutoThermalConfig.Unplugged = "quiet"
+	c.charger = chargerPluggedIn
+
+	// AutoThermal applies at first, and there is nothing to restore later
+	next, reason, err := c.checkRules()
+	require.NoError(t, err)
+	require.Equal(t, "Balanced", next)
+	require.Equal(t, autoThermalReason, reason)
+
+	// process rules take precedence over AutoThermal, and the first rule wins
+	procs.Start(`C:\Games\GAME.EXE`)
+	procs.Start("blender.exe")
+	next, reason, err = c.checkRules()
+	require.NoError(t, err)
+	require.Equal(t, "Turbo", next)
+	require.Equal(t, "process game.exe", reason)
+
+	// manual override (Fn+F5) lasts until a rule changes
+	_, err = c.NextProfile(1)
+	require.NoError(t, err)
+	next, _, err = c.checkRules()
+	require.NoError(t, err)
+	require.Empty(t, next)
+	require.Equal(t, "Fanless", c.CurrentProfile().Name)
+
+	procs.Stop("game.exe")
+	next, reason, err = c.checkRules()
+	require.NoError(t, err)
+	require.Equal(t, "Performance", next)
+	require.Equal(t, "process blender.exe", reason)
+
+	// errors keep the previously listed processes
+	procs.Err = errors.New("denied")
+	next, _, err = c.checkRules()
+	require.NoError(t, err)
+	require.Empty(t, next)
+	procs.Err = nil
+
+	// and over schedules; AutoThermal applies again once the processes exit
+	clock.now = clock.now.Add(10 * time.Hour)
+	procs.Stop("blender.exe")
+	next, reason, err = c.checkRules()
+	require.NoError(t, err)
+	require.Equal(t, "Balanced", next)
+	require.Equal(t, autoThermalReason, reason)
+}
+
+func TestProcessRulesRestore(t *testing.T) {
+	c, _ := newScheduleTest(t)
+	procs := process.NewFake()
+	c.Processes = procs
+	c.ProcessRules = []shared.ProcessRule{{Executable: "cc1plus", Profile: "turbo"}}
+
+	procs.Start("cc1plus")
+	next, _, err := c.checkRules()
+	require.NoError(t, err)
+	require.Equal(t, "Turbo", next)
+
+	procs.Stop("cc1plus")
+	next, reason, err := c.checkRules()
+	require.NoError(t, err)
+	require.Equal(t, "Fanless", next)
+	require.Equal(t, "rules ended", reason)
+}
+
+func TestValidateProcessRule(t *testing.T) {
+	profiles := GetDefaultThermalProfiles()
+	require.NoError(t, ValidateProcessRule(shared.ProcessRule{Executable: "game.exe", Profile: "Turbo"}, profiles))
+	require.Error(t, ValidateProcessRule(shared.ProcessRule{Executable: " ", Profile: "Turbo"}, profiles))
+	require.Error(t, ValidateProcessRule(shared.ProcessRule{Executable: "game.exe", Profile: "Nonexistent"}, profiles))
+}
+
+func TestAutoThermalChargerType(t *testing.T) {
+	c, clock := newScheduleTest(t)
+	c.AutoThermal = true
+	c.AutoThermalConfig.PluggedIn = "performance"
+	c.AutoThermalConfig.Unplugged = "quiet"
+	c.AutoThermalConfig.USBCPD = "balanced"
+
+	cases := []struct {
+		charger chargerState
+		source  shared.PowerSource
+		profile string
+	}{
+		{chargerUnplugged, shared.PowerSourceUnknown, "quiet"},
+		{chargerPluggedIn, shared.PowerSourceUSBCPD, "balanced"},
+		// no profile for the barrel charger, so it falls back to PluggedIn
+		{chargerPluggedIn, shared.PowerSourceBarrel, "performance"},
+		{chargerPluggedIn, shared.PowerSourceUnknown, "performance"},
+	}
+	for _, tc := range cases {
+		c.charger, c.source = tc.charger, tc.source
+		id, reason, ok := c.desiredProfile(clock.now)
+		require.True(t, ok)
+		require.Equal(t, autoThermalReason, reason)
+		require.Equal(t, tc.profile, id, tc.source.String())
+	}
+}
+
+func TestBatteryRules(t *testing.T) {
+	c, clock := newScheduleTest(t)
+	c.AutoThermal = true
+	c.AutoThermalConfig.PluggedIn = "performance"
+	c.AutoThermalConfig.Unplugged = "balanced"
+	c.AutoThermalConfig.BatteryRules = []shared.BatteryRule{
+		{Below: 15, Profile: "fanless"},
+		{Below: 30, Profile: "quiet"},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cb := make(chan plugin.Callback, 4)
+	c.Run(ctx, cb)
+
+	toast := func() string {
+		return (<-cb).Value.(util.Notification).Message
+	}
+	// the loop handles one notification at a time, so an ignored one waits for the previous
+	flush := func() {
+		c.Notify(plugin.Notification{Event: plugin.EvtLidOpened})
+	}
+
+	// the power source at start up does not switch profiles, but battery rules use it
+	c.Notify(plugin.Notification{Event: plugin.EvtPowerSourceState, Value: shared.PowerSourceBattery})
+	flush()
+	require.Len(t, cb, 0)
+	id, _, _ := c.desiredProfile(clock.now)
+	require.Equal(t, "balanced", id)
+	c.Notify(plugin.Notification{Event: plugin.EvtBatteryLevel, Value: battery.Status{Percentage: 20}})
+	require.Equal(t, "Thermal plan changed to Quiet (battery below 30%)", toast())
+
+	// battery rules do not apply while plugged in
+	c.Notify(plugin.Notification{Event: plugin.EvtChargerPluggedIn})
+	require.Equal(t, "Thermal plan changed to Performance", toast())
+	c.Notify(plugin.Notification{Event: plugin.EvtBatteryLevel, Value: battery.Status{Percentage: 20, Charging: true}})
+	flush()
+	id, _, _ = c.desiredProfile(clock.now)
+	require.Equal(t, "performance", id)
+
+	c.Notify(plugin.Notification{Event: plugin.EvtChargerUnplugged})
+	require.Equal(t, "Thermal plan changed to Quiet", toast())
+
+	// changes within the same threshold are not boundaries
+	_, err := c.SwitchToProfile("Turbo")
+	require.NoError(t, err)
+	c.Notify(plugin.Notification{Event: plugin.EvtBatteryLevel, Value: battery.Status{Percentage: 16}})
+	flush()
+	require.Len(t, cb, 0)
+	require.Equal(t, "Turbo", c.CurrentProfile().Name)
+
+	// the rule with the lowest threshold wins
+	c.Notify(plugin.Notification{Event: plugin.EvtBatteryLevel, Value: battery.Status{Percentage: 14}})
+	require.Equal(t, "Thermal plan changed to Fanless (battery below 15%)", toast())
+	require.Equal(t, "Fanless", c.CurrentProfile().Name)
+}
+
+func TestValidateBatteryRule(t *testing.T) {
+	profiles := GetDefaultThermalProfiles()
+	require.NoError(t, ValidateBatteryRule(shared.BatteryRule{Below: 30, Profile: "Quiet"}, profiles))
+	require.Error(t, ValidateBatteryRule(shared.BatteryRule{Below: 0, Profile: "Quiet"}, profiles))
+	require.Error(t, ValidateBatteryRule(shared.BatteryRule{Below: 101, Profile: "Quiet"}, profiles))
+	require.Error(t, ValidateBatteryRule(shared.BatteryRule{Below: 30, Profile: "Nonexistent"}, profiles))
+}
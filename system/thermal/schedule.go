@@ -0,0 +1,106 @@
+package thermal
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zllovesuki/G14Manager/system/shared"
+)
+
+// schedules are checked every minute instead of setting a timer to the next boundary,
+// so suspend/resume and changes to the system clock are picked up
+const scheduleCheckInterval = time.Minute
+
+// Clock returns the current time. It can be replaced in tests
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// ParseTimeOfDay parses the time of day in 24-hour format (e.g. 22:00) as the duration since midnight
+func ParseTimeOfDay(s string) (time.Duration, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("time of day must be in the format of HH:MM, got %s", s)
+	}
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil || hour < 0 || hour > 23 {
+		return 0, fmt.Errorf("invalid hour in %s", s)
+	}
+	minute, err := strconv.Atoi(parts[1])
+	if err != nil || minute < 0 || minute > 59 {
+		return 0, fmt.Errorf("invalid minute in %s", s)
+	}
+	return time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute, nil
+}
+
+// FormatTimeOfDay formats the duration since midnight as the time of day (e.g. 22:00)
+func FormatTimeOfDay(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d/time.Hour), int(d%time.Hour/time.Minute))
+}
+
+// ValidateSchedule checks that the schedule refers to one of the profiles and has a valid time window
+func ValidateSchedule(s shared.Schedule, profiles []Profile) error {
+	if ResolveProfile(profiles, s.Profile) < 0 {
+		return fmt.Errorf("schedule refers to unknown profile %s", s.Profile)
+	}
+	if s.Start < 0 || s.Start >= 24*time.Hour || s.End < 0 || s.End >= 24*time.Hour {
+		return errors.New("schedule start and end must be within a day")
+	}
+	if s.Start == s.End {
+		return errors.New("schedule start and end must be different")
+	}
+	for _, d := range s.Days {
+		if d < time.Sunday || d > time.Saturday {
+			return fmt.Errorf("invalid day of week %d", d)
+		}
+	}
+	return nil
+}
+
+func startsOn(s shared.Schedule, day time.Weekday) bool {
+	if len(s.Days) == 0 {
+		return true
+	}
+	for _, d := range s.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// scheduleActive returns true if the schedule is active at the time
+func scheduleActive(s shared.Schedule, t time.Time) bool {
+	tod := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	if s.Start < s.End {
+		return tod >= s.Start && tod < s.End && startsOn(s, t.Weekday())
+	}
+	// the window wraps past midnight
+	if tod >= s.Start {
+		return startsOn(s, t.Weekday())
+	}
+	if tod < s.End {
+		return startsOn(s, (t.Weekday()+6)%7)
+	}
+	return false
+}
+
+// activeSchedules returns the indices of the active schedules
+func activeSchedules(schedules []shared.Schedule, t time.Time) []int {
+	active := make([]int, 0)
+	for i, s := range schedules {
+		if scheduleActive(s, t) {
+			active = append(active, i)
+		}
+	}
+	return active
+}
@@ -0,0 +1,156 @@
+package thermal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zllovesuki/G14Manager/system/atkacpi"
+	"github.com/zllovesuki/G14Manager/system/power"
+	"github.com/zllovesuki/G14Manager/system/shared"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (f *fakeClock) Now() time.Time {
+	return f.now
+}
+
+// quietWeeknights is "Quiet between 22:00 and 08:00 on weekdays"
+var quietWeeknights = shared.Schedule{
+	Profile: "Quiet",
+	Days:    []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+	Start:   22 * time.Hour,
+	End:     8 * time.Hour,
+}
+
+func newScheduleTest(t *testing.T, schedules ...shared.Schedule) (*Control, *fakeClock) {
+	// 2021-03-01 is a Monday
+	clock := &fakeClock{now: time.Date(2021, 3, 1, 12, 0, 0, 0, time.Local)}
+	c, err := NewControl(Config{
+		WMI:       atkacpi.NewSimulator(),
+		PowerCfg:  &power.Cfg{},
+		Profiles:  GetDefaultThermalProfiles(),
+		Schedules: schedules,
+		Clock:     clock,
+	})
+	require.NoError(t, err)
+	return c, clock
+}
+
+func TestScheduleActive(t *testing.T) {
+	at := func(day, hour int) time.Time {
+		return time.Date(2021, 3, day, hour, 0, 0, 0, time.Local)
+	}
+	cases := []struct {
+		t      time.Time
+		active bool
+	}{
+		{at(1, 21), false}, // Monday
+		{at(1, 22), true},
+		{at(2, 7), true},   // Tuesday morning, started on Monday
+		{at(2, 8), false},  // ended
+		{at(5, 23), true},  // Friday night
+		{at(6, 7), true},   // Saturday morning, started on Friday
+		{at(6, 23), false}, // Saturday night
+		{at(1, 3), false},  // Monday morning, Sunday night did not start
+	}
+	for _, c := range cases {
+		require.Equal(t, c.active, scheduleActive(quietWeeknights, c.t), c.t.String())
+	}
+
+	daytime := shared.Schedule{Profile: "Turbo", Start: 9 * time.Hour, End: 17 * time.Hour}
+	require.True(t, scheduleActive(daytime, at(7, 9)))
+	require.False(t, scheduleActive(daytime, at(7, 17)))
+}
+
+func TestScheduleBoundaries(t *testing.T) {
+	c, clock := newScheduleTest(t, quietWeeknights)
+
+	// outside of the schedule, and nothing to restore
+	next, _, err := c.checkRules()
+	require.NoError(t, err)
+	require.Empty(t, next)
+	require.Equal(t, "Fanless", c.CurrentProfile().Name)
+
+	clock.now = clock.now.Add(10 * time.Hour)
+	next, reason, err := c.checkRules()
+	require.NoError(t, err)
+	require.Equal(t, "Quiet", next)
+	require.Equal(t, "schedule 22:00-08:00", reason)
+
+	// manual override (Fn+F5) lasts until the next boundary
+	_, err = c.NextProfile(2)
+	require.NoError(t, err)
+	require.Equal(t, "Performance", c.CurrentProfile().Name)
+	clock.now = clock.now.Add(time.Hour)
+	next, _, err = c.checkRules()
+	require.NoError(t, err)
+	require.Empty(t, next)
+	require.Equal(t, "Performance", c.CurrentProfile().Name)
+
+	// the schedule ends, and the profile before the schedule is restored
+	clock.now = clock.now.Add(9 * time.Hour)
+	next, reason, err = c.checkRules()
+	require.NoError(t, err)
+	require.Equal(t, "Fanless", next)
+	require.Equal(t, "rules ended", reason)
+}
+
+func TestSchedulePriority(t *testing.T) {
+	c, clock := newScheduleTest(t, quietWeeknights, shared.Schedule{
+		Profile:  "Turbo",
+		Start:    23 * time.Hour,
+		End:      time.Hour,
+		Priority: 1,
+	})
+	c.AutoThermal = true
+	c.AutoThermalConfig.PluggedIn = "performance"
+	c.AutoThermalConfig.Unplugged = "balanced"
+
+	// charger state is unknown, so the schedule applies (by ID, as schedules are resolved by NewControl)
+	clock.now = clock.now.Add(10 * time.Hour)
+	id, _, ok := c.desiredProfile(clock.now)
+	require.True(t, ok)
+	require.Equal(t, "quiet", id)
+
+	// AutoThermal takes precedence over schedules with the default priority
+	c.charger = chargerPluggedIn
+	id, reason, ok := c.desiredProfile(clock.now)
+	require.True(t, ok)
+	require.Equal(t, "performance", id)
+	require.Equal(t, autoThermalReason, reason)
+
+	// and the higher priority schedule takes precedence over AutoThermal
+	clock.now = clock.now.Add(time.Hour)
+	id, _, ok = c.desiredProfile(clock.now)
+	require.True(t, ok)
+	require.Equal(t, "turbo", id)
+}
+
+func TestValidateSchedule(t *testing.T) {
+	profiles := GetDefaultThermalProfiles()
+	require.NoError(t, ValidateSchedule(quietWeeknights, profiles))
+
+	invalid := []shared.Schedule{
+		{Profile: "Nonexistent", Start: time.Hour, End: 2 * time.Hour},
+		{Profile: "Quiet", Start: time.Hour, End: time.Hour},
+		{Profile: "Quiet", Start: time.Hour, End: 24 * time.Hour},
+		{Profile: "Quiet", Start: time.Hour, End: 2 * time.Hour, Days: []time.Weekday{7}},
+	}
+	for _, s := range invalid {
+		require.Error(t, ValidateSchedule(s, profiles))
+	}
+
+	d, err := ParseTimeOfDay("22:30")
+	require.NoError(t, err)
+	require.Equal(t, 22*time.Hour+30*time.Minute, d)
+	require.Equal(t, "22:30", FormatTimeOfDay(d))
+	for _, s := range []string{"", "22", "24:00", "12:60", "ab:00"} {
+		_, err := ParseTimeOfDay(s)
+		require.Error(t, err, s)
+	}
+}
@@ -0,0 +1,489 @@
+package thermal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/zllovesuki/G14Manager/system/atkacpi"
+	"github.com/zllovesuki/G14Manager/system/shared"
+)
+
+const (
+	softwareControlName = "SoftwareFanControl"
+	// after this many consecutive failed temperature reads, fans are commanded to MaxFan
+	softwareFailSafeAfter = 3
+)
+
+// Defines the defaults of SoftwareControl
+const (
+	DefaultSoftwareTarget     = 75.0
+	DefaultSoftwareInterval   = time.Second * 2
+	DefaultSoftwareHysteresis = 3.0
+	DefaultSoftwareMaxStep    = 10.0
+)
+
+// DefaultGains are conservative gains in fan percentage per degree Celsius
+var DefaultGains = PIDGains{
+	Kp: 4,
+	Ki: 0.1,
+	Kd: 1,
+}
+
+// Sensor identifies a temperature sensor
+type Sensor int
+
+// Defines the sensors used by SoftwareControl
+const (
+	SensorCPU Sensor = iota
+	SensorGPU
+)
+
+func (s Sensor) String() string {
+	return [...]string{
+		"CPU",
+		"GPU",
+	}[s]
+}
+
+// TemperatureSource reads the current temperature of a sensor in Celsius
+type TemperatureSource interface {
+	Temperature(s Sensor) (float64, error)
+}
+
+// Actuator defines what SoftwareControl rewrites to follow the target temperature
+type Actuator int
+
+// Defines the supported actuators
+const (
+	// ActuateFanCurve rewrites the fan curve of each fan to a flat curve at the PID output
+	ActuateFanCurve Actuator = iota
+	// ActuateThrottlePlan switches between Silent, Performance, and Turbo by the higher PID output of both fans
+	ActuateThrottlePlan
+)
+
+// PIDGains are the proportional, integral, and derivative gains
+type PIDGains struct {
+	Kp float64
+	Ki float64
+	Kd float64
+}
+
+// SoftwareConfig configures SoftwareControl
+type SoftwareConfig struct {
+	WMI          atkacpi.WMI
+	Capabilities atkacpi.Capabilities
+	Source       TemperatureSource
+	// Enabled, Actuator and Target are the initial mode, which Configure changes at runtime
+	Enabled  bool
+	Actuator Actuator
+	// Target is the temperature to hold in Celsius. Defaults to DefaultSoftwareTarget
+	Target float64
+	Gains  PIDGains
+	// Interval defaults to DefaultSoftwareInterval
+	Interval time.Duration
+	// Hysteresis is the minimum change in fan percentage before rewriting. Defaults to DefaultSoftwareHysteresis
+	Hysteresis float64
+	// MaxStep is the maximum change in fan percentage per interval. Defaults to DefaultSoftwareMaxStep
+	MaxStep float64
+	// MinFan and MaxFan bound the PID output. MaxFan defaults to 100
+	MinFan float64
+	MaxFan float64
+	// Floor is enforced on the fan curves written. The zero value disables the check
+	Floor SafetyFloor
+}
+
+type pid struct {
+	gains    PIDGains
+	integral float64
+	lastTemp float64
+	primed   bool
+}
+
+// update returns the output clamped to [min, max]. The integral stops accumulating
+// when the output is saturated (anti-windup), and the derivative is on the measurement
+// to avoid kicks when the target changes
+func (p *pid) update(temp, target, dt, min, max float64) float64 {
+	e := temp - target
+	var derivative float64
+	if p.primed {
+		derivative = (temp - p.lastTemp) / dt
+	}
+	p.lastTemp = temp
+	p.primed = true
+
+	integral := p.integral + e*dt
+	out := p.gains.Kp*e + p.gains.Ki*integral + p.gains.Kd*derivative
+	switch {
+	case out > max:
+		out = max
+		if e < 0 {
+			p.integral = integral
+		}
+	case out < min:
+		out = min
+		if e > 0 {
+			p.integral = integral
+		}
+	default:
+		p.integral = integral
+	}
+	return out
+}
+
+type fanLoop struct {
+	sensor  Sensor
+	dev     uint32
+	pid     pid
+	output  float64
+	applied float64
+	written bool
+}
+
+// SoftwareControl is an optional closed-loop fan controller. It reads temperatures from a
+// TemperatureSource and continuously rewrites fan curves (or the throttle plan) to hold the
+// target temperature. While it is enabled, Control leaves what it actuates to it (see Config.Software).
+// SoftwareControl is safe for multiple goroutines
+type SoftwareControl struct {
+	conf SoftwareConfig
+
+	mu       sync.Mutex
+	loops    []*fanLoop
+	plan     uint32
+	planSet  bool
+	failures int
+}
+
+// ValidateSoftwareFan checks the software fan control features. Zero Target is the default target
+func ValidateSoftwareFan(s shared.SoftwareFan) error {
+	if s.Target != 0 && (s.Target < minTemperature || s.Target > maxTemperature) {
+		return ErrTemperatureRange
+	}
+	return nil
+}
+
+// NewSoftwareControl returns a SoftwareControl to be ran under a supervisor
+func NewSoftwareControl(conf SoftwareConfig) (*SoftwareControl, error) {
+	if conf.WMI == nil {
+		return nil, errors.New("nil WMI is invalid")
+	}
+	if conf.Source == nil {
+		return nil, errors.New("nil TemperatureSource is invalid")
+	}
+	if conf.Target == 0 {
+		conf.Target = DefaultSoftwareTarget
+	}
+	if conf.Target < minTemperature || conf.Target > maxTemperature {
+		return nil, ErrTemperatureRange
+	}
+	if conf.Gains == (PIDGains{}) {
+		conf.Gains = DefaultGains
+	}
+	if conf.Interval <= 0 {
+		conf.Interval = DefaultSoftwareInterval
+	}
+	if conf.Hysteresis <= 0 {
+		conf.Hysteresis = DefaultSoftwareHysteresis
+	}
+	if conf.MaxStep <= 0 {
+		conf.MaxStep = DefaultSoftwareMaxStep
+	}
+	if conf.MaxFan <= 0 || conf.MaxFan > 100 {
+		conf.MaxFan = 100
+	}
+	if conf.MinFan < 0 || conf.MinFan > conf.MaxFan {
+		return nil, fmt.Errorf("MinFan must be between 0 and %.0f", conf.MaxFan)
+	}
+
+	s := &SoftwareControl{
+		conf: conf,
+	}
+	if conf.Enabled {
+		if err := s.buildLoops(conf.Actuator); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// buildLoops replaces the fan loops (and their PID state) with those the actuator can drive. s.mu must be held
+// if the SoftwareControl is running
+func (s *SoftwareControl) buildLoops(actuator Actuator) error {
+	if actuator == ActuateThrottlePlan && !s.conf.Capabilities.Supports(atkacpi.DevsThrottleCtrl) {
+		return errors.New("throttle plan is not supported by the firmware")
+	}
+	var loops []*fanLoop
+	for _, l := range []fanLoop{
+		{sensor: SensorCPU, dev: atkacpi.DevsCPUFanCurve},
+		{sensor: SensorGPU, dev: atkacpi.DevsGPUFanCurve},
+	} {
+		l := l
+		l.pid.gains = s.conf.Gains
+		if actuator == ActuateFanCurve && !s.conf.Capabilities.Supports(l.dev) {
+			log.Printf("thermal: %s fan curve is not supported by the firmware, software control skips it\n", l.sensor)
+			continue
+		}
+		loops = append(loops, &l)
+	}
+	if len(loops) == 0 {
+		return errors.New("fan curves are not supported by the firmware")
+	}
+	s.loops = loops
+	s.planSet = false
+	s.failures = 0
+	return nil
+}
+
+// Configure changes the mode at runtime, and returns whether it changed. Changing the actuator or
+// enabling the SoftwareControl starts the PID loops over
+func (s *SoftwareControl) Configure(enabled bool, actuator Actuator, target float64) (bool, error) {
+	if target == 0 {
+		target = DefaultSoftwareTarget
+	}
+	if target < minTemperature || target > maxTemperature {
+		return false, ErrTemperatureRange
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conf.Enabled == enabled && (!enabled || s.conf.Actuator == actuator && s.conf.Target == target) {
+		return false, nil
+	}
+	if enabled && (!s.conf.Enabled || s.conf.Actuator != actuator) {
+		if err := s.buildLoops(actuator); err != nil {
+			return false, err
+		}
+	}
+	s.conf.Enabled = enabled
+	s.conf.Actuator = actuator
+	s.conf.Target = target
+	log.Printf("thermal: software control enabled: %t, target %.0fC\n", enabled, target)
+	return true, nil
+}
+
+// Mode returns the actuator, and whether the SoftwareControl is enabled
+func (s *SoftwareControl) Mode() (Actuator, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.conf.Actuator, s.conf.Enabled
+}
+
+// Reset forgets what was written, so that the next Step rewrites the fan curves (or the throttle plan)
+// regardless of hysteresis. Control calls it after applying a profile, as switching the throttle plan
+// resets the fan curves
+func (s *SoftwareControl) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, l := range s.loops {
+		l.written = false
+	}
+	s.planSet = false
+}
+
+func (s *SoftwareControl) String() string {
+	return softwareControlName
+}
+
+// Serve satisfies suture.Service
+func (s *SoftwareControl) Serve(haltCtx context.Context) error {
+	log.Println("thermal: starting software control loop")
+
+	ticker := time.NewTicker(s.conf.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-haltCtx.Done():
+			log.Println("thermal: stopping software control loop")
+			return nil
+		case <-ticker.C:
+			if err := s.Step(); err != nil {
+				log.Printf("thermal: software control: %+v\n", err)
+			}
+		}
+	}
+}
+
+// Step reads the temperatures once, advances the PID loops by Interval, and rewrites fan curves
+// or the throttle plan if the output changed by more than Hysteresis (at most MaxStep per step).
+// Serve calls Step periodically; tests can call it directly for deterministic results.
+// Step does nothing while the SoftwareControl is disabled
+func (s *SoftwareControl) Step() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.conf.Enabled {
+		return nil
+	}
+
+	dt := s.conf.Interval.Seconds()
+	temps := make([]float64, len(s.loops))
+	for i, l := range s.loops {
+		t, err := s.conf.Source.Temperature(l.sensor)
+		if err != nil {
+			s.failures++
+			if s.failures >= softwareFailSafeAfter {
+				log.Printf("thermal: cannot read temperatures %d times in a row, commanding fans to %.0f%%\n", s.failures, s.conf.MaxFan)
+				return s.failSafe(err)
+			}
+			return fmt.Errorf("cannot read %s temperature: %w", l.sensor, err)
+		}
+		temps[i] = t
+	}
+	s.failures = 0
+
+	for i, l := range s.loops {
+		l.output = l.pid.update(temps[i], s.conf.Target, dt, s.conf.MinFan, s.conf.MaxFan)
+	}
+
+	if s.conf.Actuator == ActuateThrottlePlan {
+		return s.actuateThrottlePlan()
+	}
+	for _, l := range s.loops {
+		if err := s.actuateFanCurve(l, l.output, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SoftwareControl) failSafe(cause error) error {
+	if s.conf.Actuator == ActuateThrottlePlan {
+		if err := s.setThrottlePlan(ThrottlePlanTurbo); err != nil {
+			return err
+		}
+		return cause
+	}
+	for _, l := range s.loops {
+		if err := s.actuateFanCurve(l, s.conf.MaxFan, true); err != nil {
+			return err
+		}
+	}
+	return cause
+}
+
+func (s *SoftwareControl) actuateFanCurve(l *fanLoop, desired float64, force bool) error {
+	desired = math.Round(desired)
+	if l.written && !force {
+		// rate limiting
+		desired = math.Max(l.applied-s.conf.MaxStep, math.Min(l.applied+s.conf.MaxStep, desired))
+		// hysteresis, unless reaching the bounds
+		atBound := desired == s.conf.MinFan || desired == s.conf.MaxFan
+		if math.Abs(desired-l.applied) < s.conf.Hysteresis && !(atBound && desired != l.applied) {
+			return nil
+		}
+	}
+
+	table := s.flatTable(desired)
+	cmd, err := atkacpi.SetFanCurve(l.dev, table.Bytes())
+	if err != nil {
+		return err
+	}
+	if _, err := cmd.Execute(s.conf.WMI); err != nil {
+		return fmt.Errorf("cannot set %s fan curve: %w", l.sensor, err)
+	}
+	log.Printf("thermal: software control set %s fan to %.0f%%\n", l.sensor, desired)
+	l.applied = desired
+	l.written = true
+	return nil
+}
+
+// flatTable returns a fan curve at the fan percentage regardless of the temperature,
+// except that the safety floor is kept so the fans still spin if SoftwareControl stops
+func (s *SoftwareControl) flatTable(pct float64) *FanTable {
+	t := &FanTable{
+		ByteTable: make([]byte, 16),
+	}
+	for i := 0; i < 8; i++ {
+		temp := byte(30 + i*10)
+		p := byte(pct)
+		if temp >= s.conf.Floor.Temperature && p < s.conf.Floor.FanPercentage {
+			p = s.conf.Floor.FanPercentage
+		}
+		t.ByteTable[i] = temp
+		t.ByteTable[i+8] = p
+	}
+	return t
+}
+
+// actuateThrottlePlan maps the higher output of both loops to Silent, Performance, and Turbo
+// by thirds of [MinFan, MaxFan], moving at most one plan per step with Hysteresis around the thresholds
+func (s *SoftwareControl) actuateThrottlePlan() error {
+	var demand float64
+	for _, l := range s.loops {
+		demand = math.Max(demand, l.output)
+	}
+	levels := []uint32{ThrottlePlanSilent, ThrottlePlanPerformance, ThrottlePlanTurbo}
+	span := (s.conf.MaxFan - s.conf.MinFan) / 3
+	level := func(d float64) int {
+		return int(math.Min(2, math.Max(0, math.Floor((d-s.conf.MinFan)/span))))
+	}
+
+	if !s.planSet {
+		return s.setThrottlePlan(levels[level(demand)])
+	}
+
+	current := 0
+	for i, p := range levels {
+		if p == s.plan {
+			current = i
+		}
+	}
+	next := current
+	switch {
+	case current < 2 && demand >= s.conf.MinFan+span*float64(current+1)+s.conf.Hysteresis:
+		next = current + 1
+	case current > 0 && demand < s.conf.MinFan+span*float64(current)-s.conf.Hysteresis:
+		next = current - 1
+	}
+	if next == current {
+		return nil
+	}
+	return s.setThrottlePlan(levels[next])
+}
+
+func (s *SoftwareControl) setThrottlePlan(plan uint32) error {
+	if s.planSet && s.plan == plan {
+		return nil
+	}
+	if _, err := atkacpi.DevsSet(atkacpi.DevsThrottleCtrl, plan).Execute(s.conf.WMI); err != nil {
+		return fmt.Errorf("cannot set throttle plan: %w", err)
+	}
+	log.Printf("thermal: software control set throttle plan to %s\n", ThrottlePlanName(plan))
+	s.plan = plan
+	s.planSet = true
+	return nil
+}
+
+// Output returns the last PID output of the sensor in fan percentage
+func (s *SoftwareControl) Output(sensor Sensor) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, l := range s.loops {
+		if l.sensor == sensor {
+			return l.output
+		}
+	}
+	return 0
+}
+
+// Applied returns the fan percentage last written for the sensor. ok is false if nothing was written yet
+func (s *SoftwareControl) Applied(sensor Sensor) (pct float64, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, l := range s.loops {
+		if l.sensor == sensor {
+			return l.applied, l.written
+		}
+	}
+	return 0, false
+}
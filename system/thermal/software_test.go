@@ -0,0 +1,240 @@
+package thermal
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/zllovesuki/G14Manager/rpc/announcement"
+	"github.com/zllovesuki/G14Manager/system/atkacpi"
+	"github.com/zllovesuki/G14Manager/system/power"
+	"github.com/zllovesuki/G14Manager/system/shared"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSource struct {
+	temps [2]float64
+	err   error
+}
+
+func (f *fakeSource) Temperature(s Sensor) (float64, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	return f.temps[s], nil
+}
+
+// countingWMI counts DEVS calls to the simulator
+type countingWMI struct {
+	*atkacpi.Simulator
+	devs int
+}
+
+func (c *countingWMI) Evaluate(id atkacpi.Method, args []byte) ([]byte, error) {
+	if id == atkacpi.DEVS {
+		c.devs++
+	}
+	return c.Simulator.Evaluate(id, args)
+}
+
+func newSoftwareTest(t *testing.T, actuator Actuator) (*SoftwareControl, *fakeSource, *countingWMI) {
+	source := &fakeSource{temps: [2]float64{70, 60}}
+	wmi := &countingWMI{Simulator: atkacpi.NewSimulator()}
+	s, err := NewSoftwareControl(SoftwareConfig{
+		WMI:      wmi,
+		Source:   source,
+		Enabled:  true,
+		Actuator: actuator,
+		Target:   70,
+		Gains:    PIDGains{Kp: 5, Ki: 0.5},
+		Interval: time.Second,
+		Floor:    DefaultSafetyFloor,
+	})
+	require.NoError(t, err)
+	return s, source, wmi
+}
+
+func TestSoftwareFanCurve(t *testing.T) {
+	s, source, wmi := newSoftwareTest(t, ActuateFanCurve)
+
+	// at target (CPU) and below target (GPU): fans at minimum, floor is kept
+	require.NoError(t, s.Step())
+	require.Equal(t, 2, wmi.devs)
+	require.Equal(t, []byte{30, 40, 50, 60, 70, 80, 90, 100, 0, 0, 0, 0, 0, 0, 30, 30}, wmi.FanCurve(atkacpi.DevsCPUFanCurve))
+
+	// hotter by 4C: proportional output of 20%+, but rate limited to 10% per step
+	source.temps[SensorCPU] = 74
+	require.NoError(t, s.Step())
+	require.Greater(t, s.Output(SensorCPU), 20.0)
+	applied, ok := s.Applied(SensorCPU)
+	require.True(t, ok)
+	require.Equal(t, 10.0, applied)
+	require.Equal(t, byte(10), wmi.FanCurve(atkacpi.DevsCPUFanCurve)[8])
+
+	// ramps up over the next steps
+	require.NoError(t, s.Step())
+	applied, _ = s.Applied(SensorCPU)
+	require.Equal(t, 20.0, applied)
+
+	// GPU stays put, so nothing is rewritten for it
+	gpu, _ := s.Applied(SensorGPU)
+	require.Equal(t, 0.0, gpu)
+
+	// integral keeps increasing the output while above target
+	prev := s.Output(SensorCPU)
+	require.NoError(t, s.Step())
+	require.Greater(t, s.Output(SensorCPU), prev)
+}
+
+func TestSoftwareHysteresis(t *testing.T) {
+	s, source, wmi := newSoftwareTest(t, ActuateFanCurve)
+	require.NoError(t, s.Step())
+	writes := wmi.devs
+
+	// 0.2C above the target moves the output by ~1%, which is within hysteresis
+	source.temps[SensorCPU] = 70.2
+	require.NoError(t, s.Step())
+	require.Equal(t, writes, wmi.devs)
+}
+
+func TestSoftwareFailSafe(t *testing.T) {
+	s, source, wmi := newSoftwareTest(t, ActuateFanCurve)
+	require.NoError(t, s.Step())
+
+	source.err = errors.New("sensor gone")
+	for i := 1; i < softwareFailSafeAfter; i++ {
+		require.Error(t, s.Step())
+		require.Equal(t, byte(0), wmi.FanCurve(atkacpi.DevsCPUFanCurve)[8])
+	}
+	require.Error(t, s.Step())
+	for _, dev := range []uint32{atkacpi.DevsCPUFanCurve, atkacpi.DevsGPUFanCurve} {
+		require.Equal(t, byte(100), wmi.FanCurve(dev)[8])
+	}
+
+	// recovers with rate limiting once the sensor is back
+	source.err = nil
+	require.NoError(t, s.Step())
+	applied, _ := s.Applied(SensorCPU)
+	require.Equal(t, 90.0, applied)
+}
+
+func TestSoftwareThrottlePlan(t *testing.T) {
+	s, source, wmi := newSoftwareTest(t, ActuateThrottlePlan)
+
+	require.NoError(t, s.Step())
+	require.Equal(t, ThrottlePlanSilent, wmi.ThrottlePlan())
+
+	// very hot: moves one plan per step
+	source.temps = [2]float64{95, 95}
+	require.NoError(t, s.Step())
+	require.Equal(t, ThrottlePlanPerformance, wmi.ThrottlePlan())
+	require.NoError(t, s.Step())
+	require.Equal(t, ThrottlePlanTurbo, wmi.ThrottlePlan())
+	writes := wmi.devs
+	require.NoError(t, s.Step())
+	require.Equal(t, writes, wmi.devs)
+}
+
+func TestSoftwareConfigErrors(t *testing.T) {
+	_, err := NewSoftwareControl(SoftwareConfig{Source: &fakeSource{}, Target: 70})
+	require.Error(t, err)
+	_, err = NewSoftwareControl(SoftwareConfig{WMI: atkacpi.NewSimulator(), Target: 70})
+	require.Error(t, err)
+	_, err = NewSoftwareControl(SoftwareConfig{WMI: atkacpi.NewSimulator(), Source: &fakeSource{}, Target: 5})
+	require.Error(t, err)
+	_, err = NewSoftwareControl(SoftwareConfig{
+		WMI:          atkacpi.NewSimulator(),
+		Source:       &fakeSource{},
+		Target:       70,
+		Enabled:      true,
+		Capabilities: atkacpi.Capabilities{atkacpi.DevsCPUFanCurve: false, atkacpi.DevsGPUFanCurve: false},
+	})
+	require.Error(t, err)
+
+	require.NoError(t, ValidateSoftwareFan(shared.SoftwareFan{}))
+	require.NoError(t, ValidateSoftwareFan(shared.SoftwareFan{Target: 80}))
+	require.Equal(t, ErrTemperatureRange, ValidateSoftwareFan(shared.SoftwareFan{Target: 5}))
+}
+
+func TestSoftwareConfigure(t *testing.T) {
+	s, source, wmi := newSoftwareTest(t, ActuateFanCurve)
+	require.NoError(t, s.Step())
+	writes := wmi.devs
+
+	// nothing is written while disabled
+	changed, err := s.Configure(false, ActuateFanCurve, 70)
+	require.NoError(t, err)
+	require.True(t, changed)
+	source.temps[SensorCPU] = 90
+	require.NoError(t, s.Step())
+	require.Equal(t, writes, wmi.devs)
+
+	changed, err = s.Configure(false, ActuateFanCurve, 70)
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	_, err = s.Configure(true, ActuateFanCurve, 5)
+	require.Equal(t, ErrTemperatureRange, err)
+
+	// enabling again starts the PID loops over with the default target
+	changed, err = s.Configure(true, ActuateThrottlePlan, 0)
+	require.NoError(t, err)
+	require.True(t, changed)
+	actuator, enabled := s.Mode()
+	require.True(t, enabled)
+	require.Equal(t, ActuateThrottlePlan, actuator)
+	require.NoError(t, s.Step())
+	require.Greater(t, wmi.devs, writes)
+
+	// the throttle plan is rewritten after Reset, even if the output did not change
+	writes = wmi.devs
+	require.NoError(t, s.Step())
+	require.Equal(t, writes, wmi.devs)
+	s.Reset()
+	require.NoError(t, s.Step())
+	require.Equal(t, writes+1, wmi.devs)
+}
+
+func TestSoftwareControlProfiles(t *testing.T) {
+	s, source, wmi := newSoftwareTest(t, ActuateFanCurve)
+	c, err := NewControl(Config{
+		WMI:      wmi,
+		PowerCfg: &power.Cfg{},
+		Profiles: GetDefaultThermalProfiles(),
+		Software: s,
+	})
+	require.NoError(t, err)
+
+	// the profile sets the throttle plan, but leaves the fan curves to the software control
+	_, err = c.SwitchToProfile("Fanless")
+	require.NoError(t, err)
+	require.Equal(t, ThrottlePlanPerformance, wmi.ThrottlePlan())
+	require.NotEqual(t, c.CurrentProfile().CPUFanCurve.Bytes(), wmi.FanCurve(atkacpi.DevsCPUFanCurve))
+	require.NoError(t, s.Step())
+	require.Equal(t, byte(0), wmi.FanCurve(atkacpi.DevsCPUFanCurve)[8])
+
+	// disabling the software control gives the fan curves back to the profile
+	c.ConfigUpdate(announcement.Update{
+		Type:   announcement.FeaturesUpdate,
+		Config: shared.Features{},
+	})
+	require.Equal(t, c.CurrentProfile().CPUFanCurve.Bytes(), wmi.FanCurve(atkacpi.DevsCPUFanCurve))
+	source.temps[SensorCPU] = 90
+	require.NoError(t, s.Step())
+	require.Equal(t, c.CurrentProfile().CPUFanCurve.Bytes(), wmi.FanCurve(atkacpi.DevsCPUFanCurve))
+
+	// switching the throttle plan by temperature leaves both to the software control
+	source.temps[SensorCPU] = 70
+	c.ConfigUpdate(announcement.Update{
+		Type: announcement.FeaturesUpdate,
+		Config: shared.Features{
+			SoftwareFan: shared.SoftwareFan{Enabled: true, Target: 70, ThrottlePlan: true},
+		},
+	})
+	require.NoError(t, s.Step())
+	require.Equal(t, ThrottlePlanSilent, wmi.ThrottlePlan())
+	_, err = c.SwitchToProfile("Fanless")
+	require.NoError(t, err)
+	require.Equal(t, ThrottlePlanSilent, wmi.ThrottlePlan())
+}
@@ -0,0 +1,67 @@
+//go:build linux
+// +build linux
+
+package thermal
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// HwmonSource reads temperatures from hwmon devices, such as k10temp (CPU) and amdgpu (GPU)
+type HwmonSource struct {
+	// Path defaults to /sys/class/hwmon
+	Path string
+	// Devices maps each sensor to the name of its hwmon device
+	Devices map[Sensor]string
+}
+
+var _ TemperatureSource = &HwmonSource{}
+
+// NewTemperatureSource returns the TemperatureSource of the platform
+func NewTemperatureSource() TemperatureSource {
+	return NewHwmonSource()
+}
+
+// NewHwmonSource returns a HwmonSource with the hwmon devices of Ryzen and Radeon
+func NewHwmonSource() *HwmonSource {
+	return &HwmonSource{
+		Path: "/sys/class/hwmon",
+		Devices: map[Sensor]string{
+			SensorCPU: "k10temp",
+			SensorGPU: "amdgpu",
+		},
+	}
+}
+
+// Temperature satisfies TemperatureSource. It reads temp1_input of the device
+func (h *HwmonSource) Temperature(s Sensor) (float64, error) {
+	name, ok := h.Devices[s]
+	if !ok {
+		return 0, fmt.Errorf("no hwmon device for %s", s)
+	}
+	entries, err := ioutil.ReadDir(h.Path)
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range entries {
+		dir := filepath.Join(h.Path, entry.Name())
+		n, err := ioutil.ReadFile(filepath.Join(dir, "name"))
+		if err != nil || strings.TrimSpace(string(n)) != name {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dir, "temp1_input"))
+		if err != nil {
+			return 0, err
+		}
+		milli, err := strconv.Atoi(strings.TrimSpace(string(b)))
+		if err != nil {
+			return 0, fmt.Errorf("invalid temperature from %s: %w", name, err)
+		}
+		return float64(milli) / 1000, nil
+	}
+	return 0, fmt.Errorf("cannot find hwmon device %s", name)
+}
@@ -0,0 +1,36 @@
+//go:build linux
+// +build linux
+
+package thermal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHwmonSource(t *testing.T) {
+	root := t.TempDir()
+	for dir, files := range map[string]map[string]string{
+		"hwmon0": {"name": "acpitz\n", "temp1_input": "30000\n"},
+		"hwmon1": {"name": "k10temp\n", "temp1_input": "65125\n"},
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, dir), 0755))
+		for name, content := range files {
+			require.NoError(t, ioutil.WriteFile(filepath.Join(root, dir, name), []byte(content), 0644))
+		}
+	}
+
+	source := NewHwmonSource()
+	source.Path = root
+
+	temp, err := source.Temperature(SensorCPU)
+	require.NoError(t, err)
+	require.Equal(t, 65.125, temp)
+
+	_, err = source.Temperature(SensorGPU)
+	require.Error(t, err)
+}
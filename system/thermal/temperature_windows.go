@@ -0,0 +1,46 @@
+//go:build windows
+// +build windows
+
+package thermal
+
+import (
+	"errors"
+
+	"github.com/bi-zone/wmi"
+)
+
+// msAcpiThermalZoneTemperature is MSAcpi_ThermalZoneTemperature. CurrentTemperature is in tenths of Kelvin
+type msAcpiThermalZoneTemperature struct {
+	InstanceName       string
+	CurrentTemperature uint32
+}
+
+// ThermalZoneSource reads temperatures from the ACPI thermal zones. The firmware does not expose
+// a separate GPU sensor, so every sensor reads the hottest thermal zone
+type ThermalZoneSource struct{}
+
+var _ TemperatureSource = ThermalZoneSource{}
+
+// NewTemperatureSource returns the TemperatureSource of the platform
+func NewTemperatureSource() TemperatureSource {
+	return ThermalZoneSource{}
+}
+
+// Temperature satisfies TemperatureSource
+func (ThermalZoneSource) Temperature(s Sensor) (float64, error) {
+	var zones []msAcpiThermalZoneTemperature
+	q := wmi.CreateQueryFrom(&zones, "MSAcpi_ThermalZoneTemperature", "")
+	if err := wmi.QueryNamespace(q, &zones, `root\wmi`); err != nil {
+		return 0, err
+	}
+	if len(zones) == 0 {
+		return 0, errors.New("no ACPI thermal zone found")
+	}
+	var hottest uint32
+	for _, z := range zones {
+		if z.CurrentTemperature > hottest {
+			hottest = z.CurrentTemperature
+		}
+	}
+	return float64(hottest)/10 - 273.15, nil
+}
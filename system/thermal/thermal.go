@@ -11,12 +11,13 @@ device 0x24 in profile 0x2 has fan curve [20 50 55 60 65 70 75 98 21 26 31 38 43
 device 0x25 in profile 0x0 has fan curve [20 48 51 54 57 61 65 98 14 21 25 28 34 44 51 61]
 device 0x25 in profile 0x1 has fan curve [20 44 47 50 53 56 60 98 11 14 18 21 25 28 34 40]
 device 0x25 in profile 0x2 has fan curve [20 50 55 60 65 70 75 98 25 28 34 40 44 49 61 70]
+
+These are captured from a G14, and they can be read at runtime with ReadFactoryCurve
 */
 
 import (
 	"bytes"
 	"context"
-	"encoding/binary"
 	"encoding/gob"
 	"errors"
 	"fmt"
@@ -27,17 +28,23 @@ import (
 
 	"github.com/zllovesuki/G14Manager/rpc/announcement"
 	"github.com/zllovesuki/G14Manager/system/atkacpi"
+	"github.com/zllovesuki/G14Manager/system/battery"
 	"github.com/zllovesuki/G14Manager/system/persist"
 	"github.com/zllovesuki/G14Manager/system/plugin"
 	"github.com/zllovesuki/G14Manager/system/power"
+	"github.com/zllovesuki/G14Manager/system/process"
 	"github.com/zllovesuki/G14Manager/system/shared"
 	"github.com/zllovesuki/G14Manager/util"
 )
 
 const (
 	thermalPersistKey = "ThermalProfile"
+	// previewDelay is how long the upcoming profile is shown while Fn+F5 is still being pressed
+	previewDelay = time.Millisecond * 500
 )
 
+// The throttle plan is read back after it is written (see AppliedState), which verifies that the
+// embedded controller accepted the value, but not what each plan does
 // TODO: validate these constants are actually what they say they are
 const (
 	ThrottlePlanPerformance uint32 = 0x00
@@ -45,14 +52,20 @@ const (
 	ThrottlePlanSilent      uint32 = 0x02
 )
 
-// Profile contain each thermal profile definition
+// Profile contain each thermal profile definition. References to profiles (e.g. in schedules)
+// use the ID, which does not change when the profile is renamed
 // TODO: Revisit this
 type Profile struct {
+	ID               string
 	Name             string
 	WindowsPowerPlan string
 	ThrottlePlan     uint32
 	CPUFanCurve      *FanTable
 	GPUFanCurve      *FanTable
+	// OnEnter and OnExit hooks run when the profile becomes active and inactive, respectively.
+	// Reapplying the active profile does not run the hooks
+	OnEnter []plugin.Hook
+	OnExit  []plugin.Hook
 }
 
 // Control defines contains the Windows Power Option and list of thermal profiles
@@ -62,21 +75,57 @@ type Control struct {
 	mu                  sync.RWMutex
 	wmi                 atkacpi.WMI
 	currentProfileIndex int
-
-	errorCh chan error
-	queue   chan plugin.Notification
+	applied             *Profile // the last applied profile, nil until one is applied
+	readBack            AppliedState
+	factoryCurves       []FactoryCurve
+
+	charger      chargerState
+	source       shared.PowerSource // the type of charger if plugged in
+	battery      battery.Status
+	batteryKnown bool
+	running      map[string]bool
+	rulesChecked bool
+	rulesKey     string
+	beforeRules  string // ID of the profile before rules applied
+
+	pendingProfile string      // the saved profile (ID, or name if saved without one) not found when loaded
+	boost          *boostState // nil if not boosting
+
+	errorCh  chan error
+	queue    chan plugin.Notification
+	hookCh   chan []plugin.HookRequest
+	noticeCh chan util.Notification
 }
 
 // Config defines the entry point for Windows Power Option and a list of thermal profiles
 type Config struct {
 	WMI               atkacpi.WMI
+	Capabilities      atkacpi.Capabilities
 	PowerCfg          *power.Cfg
 	Profiles          []Profile
 	AutoThermal       bool
 	AutoThermalConfig struct {
 		PluggedIn string
 		Unplugged string
+		// Barrel and USBCPD fall back to PluggedIn if empty
+		Barrel string
+		USBCPD string
+		// BatteryRules take precedence over Unplugged on battery
+		BatteryRules []shared.BatteryRule
 	}
+	Schedules    []shared.Schedule
+	ProcessRules []shared.ProcessRule
+	// CycleProfiles are the profiles NextProfile cycles through. Empty means every profile
+	CycleProfiles []string
+	// Boost is the default of StartBoost, and the ROG key presses to start it
+	Boost shared.Boost
+	// Processes is required for ProcessRules
+	Processes process.Watcher
+	// Software is the optional closed-loop fan control. While it is enabled, profiles do not write the fan curves
+	// it rewrites (or the throttle plan and fan curves, if it switches the throttle plan)
+	Software *SoftwareControl
+	// Clock defaults to the system clock
+	Clock Clock
 }
 
 var _ plugin.Plugin = &Control{}
@@ -92,11 +141,43 @@ func NewControl(conf Config) (*Control, error) {
 	if len(conf.Profiles) == 0 {
 		return nil, errors.New("empty Profiles is invalid")
 	}
+	conf.Profiles = AssignIDs(conf.Profiles, nil)
+	if err := ValidateProfiles(conf.Profiles); err != nil {
+		return nil, err
+	}
 	if conf.AutoThermal {
 		if len(conf.AutoThermalConfig.PluggedIn) == 0 || len(conf.AutoThermalConfig.Unplugged) == 0 {
 			return nil, errors.New("must specify auto thermal profiles if enabled")
 		}
 	}
+	for _, s := range conf.Schedules {
+		if err := ValidateSchedule(s, conf.Profiles); err != nil {
+			return nil, err
+		}
+	}
+	for _, r := range conf.ProcessRules {
+		if err := ValidateProcessRule(r, conf.Profiles); err != nil {
+			return nil, err
+		}
+	}
+	if err := ValidateCycleProfiles(conf.CycleProfiles, conf.Profiles); err != nil {
+		return nil, err
+	}
+	for _, r := range conf.AutoThermalConfig.BatteryRules {
+		if err := ValidateBatteryRule(r, conf.Profiles); err != nil {
+			return nil, err
+		}
+	}
+	if err := ValidateBoost(conf.Boost, conf.Profiles, nil); err != nil {
+		return nil, err
+	}
+	if conf.Clock == nil {
+		conf.Clock = systemClock{}
+	}
+	// references are IDs from here on, so that the name of a profile cannot be taken for the ID of another
+	if err := conf.resolveReferences(); err != nil {
+		return nil, err
+	}
 
 	return &Control{
 		Config:              conf,
@@ -104,124 +185,144 @@ func NewControl(conf Config) (*Control, error) {
 		currentProfileIndex: 0,
 		errorCh:             make(chan error),
 		queue:               make(chan plugin.Notification),
+		hookCh:              make(chan []plugin.HookRequest, hookQueueSize),
+		noticeCh:            make(chan util.Notification, 1),
 	}, nil
 }
 
 // CurrentProfile will return the currently active Profile
 func (c *Control) CurrentProfile() Profile {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.currentProfileLocked()
+}
+
+// currentProfileLocked is CurrentProfile for callers already holding c.mu
+func (c *Control) currentProfileLocked() Profile {
 	return c.Config.Profiles[c.currentProfileIndex]
 }
 
-func (c *Control) findProfileIndexWithName(name string) int {
-	for i, p := range c.Profiles {
-		if p.Name == name {
-			return i
-		}
+// Profiles will return a copy of the configured profiles, safe to read while they are being updated
+func (c *Control) Profiles() []Profile {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	profiles := make([]Profile, len(c.Config.Profiles))
+	copy(profiles, c.Config.Profiles)
+	return profiles
+}
+
+// findProfileIndex returns the index of the profile referred to by its ID or name (from the user), or -1
+func (c *Control) findProfileIndex(ref string) int {
+	return ResolveProfile(c.Config.Profiles, ref)
+}
+
+// setProfile applies the profile with the given ID or name (from the user). The reference is resolved
+// while holding c.mu, so that profiles updated concurrently (e.g. by ConfigUpdate) cannot apply the wrong profile
+func (c *Control) setProfile(ref string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	index := c.findProfileIndex(ref)
+	if index < 0 {
+		return "", errors.New("Cannot find profile: " + ref)
 	}
-	return -1
+	return c.setProfileLocked(index)
 }
 
-func (c *Control) setProfile(index int) (string, error) {
+// setProfileByID applies the profile with the given ID, for references kept by Control (e.g. rules and boost)
+func (c *Control) setProfileByID(id string) (string, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	index := FindProfile(c.Config.Profiles, id)
+	if index < 0 {
+		return "", errors.New("Cannot find profile: " + id)
+	}
+	return c.setProfileLocked(index)
+}
+
+// setProfileLocked applies the profile at index. c.mu must be held
+func (c *Control) setProfileLocked(index int) (string, error) {
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
 
 	nextProfile := c.Config.Profiles[index]
 
-	// note: always set thermal throttle plan first, then override with user fan curve
-	if err := c.setThrottlePlan(nextProfile); err != nil {
+	if err := c.applyProfile(nextProfile, c.applied); err != nil {
 		return "", err
 	}
 
-	if err := c.setFanCurve(nextProfile); err != nil {
-		return "", err
-	}
+	c.currentProfileIndex = index
+	previous := c.applied
+	c.applied = &nextProfile
 
-	if _, err := c.Config.PowerCfg.Set(nextProfile.WindowsPowerPlan); err != nil {
-		return "", err
+	if previous == nil || previous.ID != nextProfile.ID {
+		c.queueHooks(previous, nextProfile)
 	}
 
-	c.currentProfileIndex = index
-
 	return nextProfile.Name, nil
 }
 
-// SwitchToProfile will switch the profile with the given name
-func (c *Control) SwitchToProfile(name string) (string, error) {
-	nextIndex := c.findProfileIndexWithName(name)
-	if nextIndex < 0 {
-		return "", errors.New("Cannot find profile with name: " + name)
-	}
-
-	return c.setProfile(nextIndex)
+// SwitchToProfile will switch the profile with the given ID or name
+func (c *Control) SwitchToProfile(ref string) (string, error) {
+	return c.setProfile(ref)
 }
 
-// NextProfile will cycle to the next profile
+// NextProfile will cycle to the next profile in the cycle list. Negative howMany cycles backward
 func (c *Control) NextProfile(howMany int) (string, error) {
-	nextIndex := (c.currentProfileIndex + howMany) % len(c.Config.Profiles)
-
-	return c.setProfile(nextIndex)
+	id, _ := c.cycleTarget(howMany)
+	return c.setProfileByID(id)
 }
 
 func (c *Control) setThrottlePlan(profile Profile) error {
-	args := make([]byte, 8)
-	binary.LittleEndian.PutUint32(args[0:], atkacpi.DevsThrottleCtrl)
-	binary.LittleEndian.PutUint32(args[4:], profile.ThrottlePlan)
+	if !c.Capabilities.Supports(atkacpi.DevsThrottleCtrl) {
+		log.Println("thermal: throttle plan is not supported by the firmware, skipping")
+		return nil
+	}
 
-	_, err := c.wmi.Evaluate(atkacpi.DEVS, args)
+	_, err := atkacpi.DevsSet(atkacpi.DevsThrottleCtrl, profile.ThrottlePlan).Execute(c.wmi)
 	if err != nil {
 		return err
 	}
 
 	log.Printf("thermal: throttle plan set: 0x%x\n", profile.ThrottlePlan)
 
+	// the profile stays applied, and the error is kept in the applied state for the clients
+	if err := c.readBackThrottlePlan(profile.ThrottlePlan); err != nil {
+		log.Printf("thermal: %s\n", err)
+		c.readBack.Err = err
+	}
 	return nil
 }
 
-func (c *Control) setFanCurve(profile Profile) error {
-
-	if profile.CPUFanCurve != nil {
-		cpuFanCurve := profile.CPUFanCurve.Bytes()
-
-		if len(cpuFanCurve) != 16 {
-			log.Printf("thermal: invalid cpu fan curve\n")
-			return nil
-		}
-
-		cpuArgs := make([]byte, 20)
-		binary.LittleEndian.PutUint32(cpuArgs[0:], atkacpi.DevsCPUFanCurve)
-		copy(cpuArgs[4:], cpuFanCurve)
-
-		if _, err := c.wmi.Evaluate(atkacpi.DEVS, cpuArgs); err != nil {
-			return err
-		}
-
-		log.Printf("thermal: cpu fan curve set to %+v\n", cpuFanCurve)
+func (c *Control) setFanCurve(dev uint32, name string, curve *FanTable) error {
+	if curve == nil {
+		return nil
+	}
+	if !c.Capabilities.Supports(dev) {
+		log.Printf("thermal: %s fan curve is not supported by the firmware, skipping\n", name)
+		return nil
 	}
 
-	time.Sleep(time.Millisecond * 250)
-
-	if profile.GPUFanCurve != nil {
-		gpuFanCurve := profile.GPUFanCurve.Bytes()
-
-		if len(gpuFanCurve) != 16 {
-			log.Printf("thermal: invalid gpu fan curve\n")
-			return nil
-		}
-
-		gpuArgs := make([]byte, 20)
-		binary.LittleEndian.PutUint32(gpuArgs[0:], atkacpi.DevsGPUFanCurve)
-		copy(gpuArgs[4:], gpuFanCurve)
-
-		if _, err := c.wmi.Evaluate(atkacpi.DEVS, gpuArgs); err != nil {
-			return err
-		}
+	// the table as is, as Bytes pads or truncates it to the length the firmware expects
+	table := curve.ByteTable
+	cmd, err := atkacpi.SetFanCurve(dev, table)
+	if err == nil {
+		err = curve.Validate(SafetyFloor{})
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s fan curve: %w", name, err)
+	}
 
-		log.Printf("thermal: gpu fan curve set to %+v\n", gpuFanCurve)
+	if _, err := cmd.Execute(c.wmi); err != nil {
+		return err
 	}
 
+	log.Printf("thermal: %s fan curve set to %+v\n", name, table)
+
+	c.readBackFanCurve(dev)
 	return nil
 }
 
@@ -238,12 +339,36 @@ func (c *Control) loop(haltCtx context.Context, cb chan<- plugin.Callback) {
 		}
 	}()
 
+	interval := scheduleCheckInterval
+	if c.Processes != nil {
+		interval = processCheckInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	boostTicker := time.NewTicker(boostCheckInterval)
+	defer boostTicker.Stop()
+
 	for {
 		select {
 		case t := <-c.queue:
 			switch t.Event {
+			case plugin.EvtSentinelPreviewThermalProfile:
+				counter := t.Value.(int64)
+				_, name := c.cycleTarget(int(counter))
+				cb <- plugin.Callback{
+					Event: plugin.CbNotifyToast,
+					Value: util.Notification{
+						Message:   fmt.Sprintf("Next thermal plan: %s", name),
+						Delay:     previewDelay,
+						Immediate: true,
+					},
+				}
 			case plugin.EvtSentinelCycleThermalProfile:
 				counter := t.Value.(int64)
+				if counter == 0 {
+					// cycled forward and backward by the same steps
+					continue
+				}
 				name, err := c.NextProfile(int(counter))
 				message := fmt.Sprintf("Thermal plan changed to %s", name)
 				if err != nil {
@@ -259,21 +384,43 @@ func (c *Control) loop(haltCtx context.Context, cb chan<- plugin.Callback) {
 				cb <- plugin.Callback{
 					Event: plugin.CbPersistConfig,
 				}
+			case plugin.EvtPowerSourceState:
+				// the profile at start up is restored from the registry, so only the state is updated
+				// for battery rules and the next change of AutoThermal
+				source, ok := t.Value.(shared.PowerSource)
+				if !ok {
+					continue
+				}
+				c.mu.Lock()
+				c.setPowerSourceLocked(source)
+				c.mu.Unlock()
 			case plugin.EvtChargerPluggedIn, plugin.EvtChargerUnplugged:
+				c.mu.Lock()
+				if t.Event == plugin.EvtChargerPluggedIn {
+					// the charger type is unknown if the event has no typed value
+					source, _ := t.Value.(shared.PowerSource)
+					c.setPowerSourceLocked(source)
+				} else {
+					c.setPowerSourceLocked(shared.PowerSourceBattery)
+				}
+				c.mu.Unlock()
+				if t.Event == plugin.EvtChargerUnplugged && c.boosting() {
+					c.notifyBoostEnded(cb, "charger unplugged")
+				}
 				if !c.Config.AutoThermal {
 					continue
 				}
-				var next string
-				var err error
+				if c.boosting() {
+					log.Println("thermal: boost takes precedence over AutoThermal")
+					continue
+				}
 				var message string
-				switch t.Event {
-				case plugin.EvtChargerPluggedIn:
-					next, err = c.SwitchToProfile(c.AutoThermalConfig.PluggedIn)
-				case plugin.EvtChargerUnplugged:
-					next, err = c.SwitchToProfile(c.AutoThermalConfig.Unplugged)
-				default:
+				next, reason, ok := c.desiredProfile(c.Clock.Now())
+				if !ok || reason != autoThermalReason {
+					log.Printf("thermal: %s takes precedence over AutoThermal\n", reason)
 					continue
 				}
+				next, err := c.setProfileByID(next)
 				if err != nil {
 					log.Println(err)
 					message = err.Error()
@@ -286,6 +433,135 @@ func (c *Control) loop(haltCtx context.Context, cb chan<- plugin.Callback) {
 						Message: message,
 					},
 				}
+			case plugin.EvtBatteryLevel:
+				status, ok := t.Value.(battery.Status)
+				if !ok {
+					continue
+				}
+				c.mu.Lock()
+				before, matched := c.batteryRule()
+				c.battery = status
+				c.batteryKnown = true
+				after, matches := c.batteryRule()
+				c.mu.Unlock()
+				// only crossing a threshold is a boundary
+				if !c.Config.AutoThermal || before == after && matched == matches {
+					continue
+				}
+				if c.boosting() {
+					log.Println("thermal: boost takes precedence over battery rules")
+					continue
+				}
+				next, reason, ok := c.desiredProfile(c.Clock.Now())
+				if !ok || reason != autoThermalReason {
+					log.Printf("thermal: %s takes precedence over battery rules\n", reason)
+					continue
+				}
+				if next == c.CurrentProfile().ID {
+					continue
+				}
+				var message string
+				next, err := c.setProfileByID(next)
+				if err != nil {
+					log.Println(err)
+					message = err.Error()
+				} else if matches {
+					message = fmt.Sprintf("Thermal plan changed to %s (battery below %d%%)", next, after.Below)
+				} else {
+					message = fmt.Sprintf("Thermal plan changed to %s", next)
+				}
+				cb <- plugin.Callback{
+					Event: plugin.CbNotifyToast,
+					Value: util.Notification{
+						Message: message,
+					},
+				}
+			case plugin.EvtSentinelUtilityKey:
+				counter, ok := t.Value.(int64)
+				c.mu.RLock()
+				presses := c.Boost.RogKeyPresses
+				c.mu.RUnlock()
+				if !ok || presses == 0 || int(counter) != presses {
+					continue
+				}
+				if c.boosting() {
+					c.notifyBoostEnded(cb, "cancelled")
+					continue
+				}
+				var message string
+				status, err := c.StartBoost("", 0)
+				if err != nil {
+					log.Println(err)
+					message = err.Error()
+				} else {
+					message = fmt.Sprintf("Thermal plan changed to %s for %d min", status.Profile, minutesLeft(status.Until.Sub(c.Clock.Now())))
+				}
+				cb <- plugin.Callback{
+					Event: plugin.CbNotifyToast,
+					Value: util.Notification{
+						Message: message,
+					},
+				}
+				cb <- plugin.Callback{
+					Event: plugin.CbPersistConfig,
+				}
+			case plugin.EvtACPISuspend:
+				if c.boosting() {
+					if _, err := c.endBoost("suspend"); err != nil {
+						log.Println(err)
+					}
+					cb <- plugin.Callback{
+						Event: plugin.CbPersistConfig,
+					}
+				}
+			}
+		case <-boostTicker.C:
+			message, err := c.checkBoost(c.Clock.Now())
+			if err != nil {
+				log.Println(err)
+				message = err.Error()
+			} else if message == "" {
+				continue
+			}
+			cb <- plugin.Callback{
+				Event: plugin.CbNotifyToast,
+				Value: util.Notification{
+					Message:   message,
+					Immediate: true,
+				},
+			}
+			if c.boosting() {
+				continue
+			}
+			cb <- plugin.Callback{
+				Event: plugin.CbPersistConfig,
+			}
+		case requests := <-c.hookCh:
+			cb <- plugin.Callback{
+				Event: plugin.CbRunHooks,
+				Value: requests,
+			}
+		case n := <-c.noticeCh:
+			cb <- plugin.Callback{
+				Event: plugin.CbNotifyToast,
+				Value: n,
+			}
+		case <-ticker.C:
+			next, reason, err := c.checkRules()
+			var message string
+			if err != nil {
+				log.Println(err)
+				message = err.Error()
+			} else if next == "" {
+				continue
+			} else {
+				message = fmt.Sprintf("Thermal plan changed to %s (%s)", next, reason)
+			}
+			cb <- plugin.Callback{
+				Event: plugin.CbNotifyToast,
+				Value: util.Notification{
+					Message: message,
+				},
 			}
 		case <-haltCtx.Done():
 			log.Println("thermal: exiting Plugin run loop")
@@ -294,6 +570,29 @@ func (c *Control) loop(haltCtx context.Context, cb chan<- plugin.Callback) {
 	}
 }
 
+// notifyBoostEnded ends the boost, and shows the profile reverted to
+func (c *Control) notifyBoostEnded(cb chan<- plugin.Callback, why string) {
+	var message string
+	next, err := c.endBoost(why)
+	if err != nil {
+		log.Println(err)
+		message = err.Error()
+	} else if next == "" {
+		message = fmt.Sprintf("Boost ended (%s)", why)
+	} else {
+		message = fmt.Sprintf("Boost ended (%s), thermal plan changed to %s", why, next)
+	}
+	cb <- plugin.Callback{
+		Event: plugin.CbNotifyToast,
+		Value: util.Notification{
+			Message: message,
+		},
+	}
+	cb <- plugin.Callback{
+		Event: plugin.CbPersistConfig,
+	}
+}
+
 // Run satisfies system/plugin.Plugin
 func (c *Control) Run(haltCtx context.Context, cb chan<- plugin.Callback) <-chan error {
 	log.Println("thermal: Starting queue loop")
@@ -321,14 +620,26 @@ func (c *Control) Value() []byte {
 	defer c.mu.RUnlock()
 
 	var buf bytes.Buffer
-	name := c.CurrentProfile().Name
+	current := c.currentProfileLocked()
 	enc := gob.NewEncoder(&buf)
-	if err := enc.Encode(name); err != nil {
+	if err := enc.Encode(persistedProfile{
+		ID:    current.ID,
+		Name:  current.Name,
+		Boost: c.boost,
+	}); err != nil {
 		return nil
 	}
 	return buf.Bytes()
 }
 
+// persistedProfile is the saved current profile. It is resolved by ID, then by name.
+// Boost is nil if not boosting
+type persistedProfile struct {
+	ID    string
+	Name  string
+	Boost *boostState
+}
+
 // Load staisfies persist.Registry
 func (c *Control) Load(v []byte) error {
 	c.mu.Lock()
@@ -337,25 +648,51 @@ func (c *Control) Load(v []byte) error {
 	if len(v) == 0 {
 		return nil
 	}
-	var name string
-	buf := bytes.NewBuffer(v)
-	dec := gob.NewDecoder(buf)
-	if err := dec.Decode(&name); err != nil {
-		return err
+	var p persistedProfile
+	if err := gob.NewDecoder(bytes.NewBuffer(v)).Decode(&p); err != nil {
+		// values saved before profiles had IDs are the name of the profile
+		if legacyErr := gob.NewDecoder(bytes.NewBuffer(v)).Decode(&p.Name); legacyErr != nil {
+			return err
+		}
+	}
+	// values saved before profiles had IDs refer to the profile by name
+	index := FindProfile(c.Config.Profiles, p.ID)
+	if p.ID == "" {
+		index = FindProfileByName(c.Config.Profiles, p.Name)
 	}
-	for i, profile := range c.Profiles {
-		if profile.Name == name {
-			c.currentProfileIndex = i
-			return nil
+	c.boost = nil
+	if b := p.Boost; b != nil && index >= 0 {
+		previous := FindProfile(c.Config.Profiles, b.Previous)
+		switch {
+		case previous < 0:
+			log.Printf("thermal: profile %s before the boost is not found, ending the boost\n", b.Previous)
+		case c.Clock.Now().Before(b.Until):
+			c.boost = b
+		default:
+			// the boost ended while not running
+			log.Printf("thermal: boost ended while not running, reverting to %s\n", c.Config.Profiles[previous].Name)
+			index = previous
 		}
 	}
+	if index < 0 {
+		// the profiles may not be loaded yet, so try again when they are updated
+		c.pendingProfile = p.ID
+		if c.pendingProfile == "" {
+			c.pendingProfile = p.Name
+		}
+		return fmt.Errorf("thermal: saved profile %s is not found, keeping %s", p.Name, c.currentProfileLocked().Name)
+	}
+	c.currentProfileIndex = index
+	c.pendingProfile = ""
 	return nil
 }
 
 // Apply satisfies persist.Registry
 func (c *Control) Apply() error {
-	c.currentProfileIndex-- // drcrement the index so we reapply the current one
-	_, err := c.NextProfile(1)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, err := c.setProfileLocked(c.currentProfileIndex)
 	return err
 }
 
@@ -367,6 +704,15 @@ func (c *Control) Close() error {
 	return c.wmi.Close()
 }
 
+// ApplySetup satisfies system/setup.Device
+func (c *Control) ApplySetup(s shared.Setup) (bool, error) {
+	if s.ThermalProfile == "" {
+		return false, nil
+	}
+	_, err := c.SwitchToProfile(s.ThermalProfile)
+	return true, err
+}
+
 var _ announcement.Updatable = &Control{}
 
 func (c *Control) ConfigUpdate(u announcement.Update) {
@@ -383,13 +729,56 @@ func (c *Control) ConfigUpdate(u announcement.Update) {
 		c.AutoThermal = feats.AutoThermal.Enabled
 		c.AutoThermalConfig.PluggedIn = feats.AutoThermal.PluggedIn
 		c.AutoThermalConfig.Unplugged = feats.AutoThermal.Unplugged
+		c.AutoThermalConfig.Barrel = feats.AutoThermal.Barrel
+		c.AutoThermalConfig.USBCPD = feats.AutoThermal.USBCPD
+		c.AutoThermalConfig.BatteryRules = feats.AutoThermal.BatteryRules
+		c.Schedules = feats.Schedules
+		c.ProcessRules = feats.ProcessRules
+		c.CycleProfiles = feats.CycleProfiles
+		c.Boost = feats.Boost
+		c.configureSoftware(feats.SoftwareFan)
 	case announcement.ProfilesUpdate:
 		profiles, ok := u.Config.([]Profile)
-		if !ok {
+		if !ok || len(profiles) == 0 {
+			return
+		}
+
+		// follow the current profile by ID, as it may have been renamed or moved
+		current := c.currentProfileLocked()
+		missing := current.Name
+		pending := c.pendingProfile
+		c.pendingProfile = ""
+		c.Config.Profiles = profiles
+
+		var index int
+		if pending != "" {
+			missing = pending
+			index = ResolveProfile(profiles, pending)
+		} else {
+			index = FindProfile(profiles, current.ID)
+		}
+		if index >= 0 {
+			c.currentProfileIndex = index
 			return
 		}
 
-		c.Profiles = profiles
+		// the profile was removed, so fall back to the first profile instead of keeping stale settings
+		log.Printf("thermal: profile %s is not found in the updated profiles, using %s\n", missing, profiles[0].Name)
+		message := fmt.Sprintf("Profile %s is not found, thermal plan changed to %s", missing, profiles[0].Name)
+		if _, err := c.setProfileLocked(0); err != nil {
+			log.Println(err)
+			message = err.Error()
+		}
+		c.notify(message)
 	}
 
 }
+
+// notify queues a notification for the loop to send it with CbNotifyToast, for changes made outside of the loop
+func (c *Control) notify(message string) {
+	select {
+	case c.noticeCh <- util.Notification{Message: message}:
+	default:
+		log.Printf("thermal: too many pending notifications, dropping: %s\n", message)
+	}
+}
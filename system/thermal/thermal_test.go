@@ -1,8 +1,12 @@
 package thermal
 
 import (
+	"path/filepath"
 	"testing"
 
+	"github.com/zllovesuki/G14Manager/system/atkacpi"
+	"github.com/zllovesuki/G14Manager/system/power"
+
 	"github.com/stretchr/testify/require"
 )
 
@@ -31,3 +35,98 @@ func TestThermalPersist(t *testing.T) {
 	require.Equal(t, defaultProfiles[1].Name, thermal.CurrentProfile().Name)
 
 }
+
+func TestFactoryCurves(t *testing.T) {
+	sim := atkacpi.NewSimulator()
+
+	curve, err := ReadFactoryCurve(sim, ThrottlePlanSilent)
+	require.NoError(t, err)
+	require.Equal(t, ThrottlePlanSilent, curve.ThrottlePlan)
+	require.Equal(t, "20c:21%,50c:26%,55c:31%,60c:38%,65c:43%,70c:48%,75c:56%,98c:65%", curve.CPUFanCurve.String())
+	require.Equal(t, "20c:25%,50c:28%,55c:34%,60c:40%,65c:44%,70c:49%,75c:61%,98c:70%", curve.GPUFanCurve.String())
+
+	curves, err := ReadFactoryCurves(sim)
+	require.NoError(t, err)
+	require.Len(t, curves, len(ThrottlePlans))
+
+	_, err = ReadFactoryCurve(sim, 0x03)
+	require.Error(t, err)
+}
+
+func TestResetProfileToFactory(t *testing.T) {
+	defaultProfiles := GetDefaultThermalProfiles()
+	thermal, err := NewControl(Config{
+		WMI:      atkacpi.NewSimulator(),
+		PowerCfg: &power.Cfg{},
+		Profiles: defaultProfiles,
+	})
+	require.NoError(t, err)
+
+	// "Quiet" is not the current profile, so nothing is applied
+	profile, err := thermal.ResetProfileToFactory("Quiet")
+	require.NoError(t, err)
+	require.Equal(t, "20c:14%,48c:19%,51c:22%,54c:26%,57c:31%,61c:43%,65c:49%,98c:56%", profile.CPUFanCurve.String())
+
+	index := thermal.findProfileIndex("Quiet")
+	require.Equal(t, profile, thermal.Config.Profiles[index])
+	// the original slice is left untouched
+	require.NotEqual(t, profile.CPUFanCurve, defaultProfiles[index].CPUFanCurve)
+
+	_, err = thermal.ResetProfileToFactory("Nonexistent")
+	require.Error(t, err)
+}
+
+func TestThermalReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.json")
+
+	rec, err := atkacpi.NewRecorder(atkacpi.NewSimulator(), path)
+	require.NoError(t, err)
+	thermal, err := NewControl(Config{
+		WMI:      rec,
+		PowerCfg: &power.Cfg{},
+		Profiles: GetDefaultThermalProfiles(),
+	})
+	require.NoError(t, err)
+
+	_, err = thermal.SwitchToProfile("Fanless")
+	require.NoError(t, err)
+	_, err = thermal.NextProfile(1)
+	require.NoError(t, err)
+	require.NoError(t, thermal.Close())
+
+	replay, err := atkacpi.NewReplayer(path)
+	require.NoError(t, err)
+	thermal, err = NewControl(Config{
+		WMI:      replay,
+		PowerCfg: &power.Cfg{},
+		Profiles: GetDefaultThermalProfiles(),
+	})
+	require.NoError(t, err)
+
+	_, err = thermal.SwitchToProfile("Fanless")
+	require.NoError(t, err)
+	_, err = thermal.NextProfile(1)
+	require.NoError(t, err)
+
+	require.Empty(t, replay.Mismatches())
+	require.Equal(t, 0, replay.Remaining())
+}
+
+func TestResetCurrentProfileToFactory(t *testing.T) {
+	sim := atkacpi.NewSimulator()
+	thermal, err := NewControl(Config{
+		WMI:      sim,
+		PowerCfg: &power.Cfg{},
+		Profiles: GetDefaultThermalProfiles(),
+	})
+	require.NoError(t, err)
+
+	_, err = thermal.SwitchToProfile("Fanless")
+	require.NoError(t, err)
+
+	// the current profile is reapplied by ID
+	profile, err := thermal.ResetProfileToFactory("fanless")
+	require.NoError(t, err)
+	require.Equal(t, profile, thermal.CurrentProfile())
+	require.Equal(t, profile.CPUFanCurve.Bytes(), sim.FanCurve(atkacpi.DevsCPUFanCurve))
+}
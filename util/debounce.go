@@ -42,6 +42,53 @@ func Debounce(haltCtx context.Context, wait time.Duration) (chan<- interface{},
 	return in, out
 }
 
+// DebounceSteps is similar to Debounce, but the Counter of the (clean) output is the sum of the steps
+// sent to the (dirty) input instead of the number of inputs. Steps are int64, either positive (forward) or
+// negative (backward), and other values count as one step forward. The running sum is also sent to the
+// preview output on every input, so the outcome can be previewed before the wait is over.
+func DebounceSteps(haltCtx context.Context, wait time.Duration) (chan<- interface{}, <-chan DebounceEvent, <-chan DebounceEvent) {
+	in := make(chan interface{})
+	out := make(chan DebounceEvent, 1)     // do not block our goroutine
+	preview := make(chan DebounceEvent, 1) // only the latest preview matters
+
+	go func() {
+		var sum int64
+		var data interface{}
+		var timer <-chan time.Time
+
+		for {
+			select {
+			case data = <-in:
+				timer = time.After(wait)
+				step, ok := data.(int64)
+				if !ok {
+					step = 1
+				}
+				sum += step
+				select {
+				case <-preview:
+				default:
+				}
+				preview <- DebounceEvent{
+					Counter: sum,
+					Data:    data,
+				}
+			case <-timer:
+				out <- DebounceEvent{
+					Counter: sum,
+					Data:    data,
+				}
+				timer = nil
+				sum = 0
+			case <-haltCtx.Done():
+				return
+			}
+		}
+	}()
+
+	return in, out, preview
+}
+
 // PassThrough will pipe (dirty) input directly to (clean) output without debouncing.
 func PassThrough(haltCtx context.Context) (chan<- interface{}, <-chan DebounceEvent) {
 	in := make(chan interface{})
@@ -81,3 +81,25 @@ func TestMultipleDebounce(t *testing.T) { // -race passes
 	time.Sleep(time.Millisecond * 200)
 
 }
+
+func TestDebounceSteps(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	in, out, preview := DebounceSteps(ctx, time.Millisecond*25)
+
+	for _, step := range []int64{1, 1, -1, -1, -1} {
+		in <- step
+	}
+	// only the latest preview is kept
+	require.Equal(t, int64(-1), (<-preview).Counter)
+
+	ev := <-out
+	require.Equal(t, int64(-1), ev.Counter)
+	require.Len(t, preview, 0)
+
+	// the sum starts over, and other values count as one step forward
+	in <- struct{}{}
+	require.Equal(t, int64(1), (<-preview).Counter)
+	require.Equal(t, int64(1), (<-out).Counter)
+}